@@ -0,0 +1,111 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/common"
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type AdminUser struct {
+	User
+	DisabledAt *time.Time `json:"disabled_at"`
+}
+
+func newAdminUser(user database.User) AdminUser {
+	adminUser := AdminUser{
+		User: User{
+			ID:          user.ID,
+			CreatedAt:   user.CreatedAt,
+			UpdatedAt:   user.UpdatedAt,
+			Email:       user.Email,
+			IsChirpyRed: user.IsChirpyRed,
+			Role:        user.Role,
+		},
+	}
+	if user.DisabledAt.Valid {
+		adminUser.DisabledAt = &user.DisabledAt.Time
+	}
+	return adminUser
+}
+
+func (cfg *ApiConfig) AdminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := cfg.Store.ListUsers(r.Context())
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not get users from db", err)
+		return
+	}
+
+	response := []AdminUser{}
+	for _, user := range users {
+		response = append(response, newAdminUser(user))
+	}
+
+	common.RespondWithJson(w, http.StatusOK, response)
+}
+
+func (cfg *ApiConfig) AdminDisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInvalidParameter, "userId must be a UUID", err)
+		return
+	}
+
+	var user database.User
+	err = cfg.Store.InTx(r.Context(), func(tx database.Store) error {
+		var err error
+		user, err = tx.DisableUserById(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.RevokeRefreshTokensByUser(r.Context(), user.ID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		common.RespondWithProblem(w, r, common.CodeNotFound, "Could not find user", err)
+		return
+	}
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not disable user", err)
+		return
+	}
+
+	common.RespondWithJson(w, http.StatusOK, newAdminUser(user))
+}
+
+func (cfg *ApiConfig) AdminSetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type parameters struct {
+		Role string `json:"role" validate:"required,oneof=user moderator admin"`
+	}
+
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInvalidParameter, "userId must be a UUID", err)
+		return
+	}
+
+	params := parameters{}
+	if !common.DecodeJSON(w, r, &params) {
+		return
+	}
+
+	user, err := cfg.Store.SetUserRole(r.Context(), database.SetUserRoleParams{
+		Role: params.Role,
+		ID:   userId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		common.RespondWithProblem(w, r, common.CodeNotFound, "Could not find user", err)
+		return
+	}
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not update user", err)
+		return
+	}
+
+	common.RespondWithJson(w, http.StatusOK, newAdminUser(user))
+}
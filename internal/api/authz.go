@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/common"
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/logging"
+)
+
+// authError is a bearer token failure as described by RFC 6750 section 3.
+type authError struct {
+	// problem determines the response status and problem details code.
+	problem common.ErrorCode
+	// code is the RFC 6750 error code. It is empty when the request carried
+	// no credentials at all, in which case the challenge names no error.
+	code        string
+	description string
+	scope       string
+	err         error
+}
+
+func (e *authError) challenge() string {
+	challenge := `Bearer realm="chirpy"`
+	if e.code != "" {
+		challenge += fmt.Sprintf(`, error="%s", error_description="%s"`, e.code, e.description)
+	}
+	if e.scope != "" {
+		challenge += fmt.Sprintf(`, scope="%s"`, e.scope)
+	}
+	return challenge
+}
+
+func respondWithAuthError(w http.ResponseWriter, r *http.Request, e *authError) {
+	if e.problem.Status() < http.StatusInternalServerError {
+		w.Header().Set("WWW-Authenticate", e.challenge())
+	}
+	common.RespondWithProblem(w, r, e.problem, e.description, e.err)
+}
+
+var errNoCredentials = &authError{
+	problem:     common.CodeUnauthorized,
+	description: "Authentication required",
+}
+
+func invalidToken(err error) *authError {
+	return &authError{
+		problem:     common.CodeInvalidToken,
+		code:        "invalid_token",
+		description: "Access token is invalid or expired",
+		err:         err,
+	}
+}
+
+// authenticate validates the request's bearer token, which is either a JWT
+// from a login session or a personal access token. It returns a nil
+// principal and nil error when the request carries no Authorization header.
+func (cfg *ApiConfig) authenticate(r *http.Request) (*auth.Principal, *authError) {
+	token, err := auth.GetBearerToken(r.Header)
+	if errors.Is(err, auth.ErrNoAuthHeader) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &authError{
+			problem:     common.CodeInvalidAuthHeader,
+			code:        "invalid_request",
+			description: "Authorization header must be a bearer token",
+			err:         err,
+		}
+	}
+
+	if auth.IsPersonalAccessToken(token) {
+		return cfg.authenticatePersonalAccessToken(r.Context(), token)
+	}
+
+	claims, err := auth.ParseJWT(token, cfg.Secret)
+	if err != nil {
+		return nil, invalidToken(err)
+	}
+	principal, err := claims.Principal()
+	if err != nil {
+		return nil, invalidToken(err)
+	}
+
+	// Access tokens outlive a disabled or deleted account, so check that
+	// the account is still there.
+	user, err := cfg.Store.GetUserById(r.Context(), principal.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, invalidToken(errors.New("unknown user"))
+	}
+	if err != nil {
+		return nil, &authError{
+			problem:     common.CodeInternal,
+			description: "Could not look up user",
+			err:         err,
+		}
+	}
+	if user.DisabledAt.Valid {
+		return nil, invalidToken(errors.New("account disabled"))
+	}
+	return principal, nil
+}
+
+func (cfg *ApiConfig) authenticatePersonalAccessToken(ctx context.Context, token string) (*auth.Principal, *authError) {
+	pat, err := cfg.Store.GetPersonalAccessTokenByHash(ctx, auth.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, invalidToken(errors.New("unknown personal access token"))
+	}
+	if err != nil {
+		return nil, &authError{
+			problem:     common.CodeInternal,
+			description: "Could not look up access token",
+			err:         err,
+		}
+	}
+
+	switch {
+	case pat.RevokedAt.Valid:
+		return nil, invalidToken(errors.New("personal access token has been revoked"))
+	case pat.ExpiresAt.Valid && time.Now().After(pat.ExpiresAt.Time):
+		return nil, invalidToken(errors.New("personal access token has expired"))
+	case pat.UserDisabledAt.Valid:
+		return nil, invalidToken(errors.New("account disabled"))
+	}
+
+	// Last-used tracking is best effort; it must not fail the request.
+	if err := cfg.Store.TouchPersonalAccessToken(ctx, pat.ID); err != nil {
+		logging.FromContext(ctx).Warn("Could not record personal access token use", "token_id", pat.ID, "error", err)
+	}
+
+	scopes := pat.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return &auth.Principal{
+		UserID:    pat.UserID,
+		Role:      pat.Role,
+		Scopes:    scopes,
+		SessionID: pat.ID.String(),
+	}, nil
+}
+
+func withPrincipal(r *http.Request, principal *auth.Principal) *http.Request {
+	logging.SetUserID(r.Context(), principal.UserID)
+	logging.With(r.Context(), "role", principal.Role)
+	return r.WithContext(auth.NewContext(r.Context(), principal))
+}
+
+// serveAs runs next on behalf of principal. A request that may write opens
+// the caller's read-your-writes window both when it starts and when it
+// finishes, and while the window is open their reads go to the primary.
+func (cfg *ApiConfig) serveAs(w http.ResponseWriter, r *http.Request, principal *auth.Principal, next http.Handler) {
+	r = withPrincipal(r, principal)
+	if cfg.RecentWrites != nil {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			cfg.RecentWrites.Record(principal.UserID)
+			defer cfg.RecentWrites.Record(principal.UserID)
+		}
+		if cfg.RecentWrites.Recent(principal.UserID) {
+			r = r.WithContext(database.WithPrimary(r.Context()))
+		}
+	}
+	next.ServeHTTP(w, r)
+}
+
+// RequireAuth rejects requests without a valid access token and makes the
+// caller available to next through auth.MustPrincipal.
+func (cfg *ApiConfig) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, authErr := cfg.authenticate(r)
+		if authErr == nil && principal == nil {
+			authErr = errNoCredentials
+		}
+		if authErr != nil {
+			respondWithAuthError(w, r, authErr)
+			return
+		}
+		cfg.serveAs(w, r, principal, next)
+	})
+}
+
+// OptionalAuth lets anonymous requests through but still rejects invalid
+// tokens, so a client with a broken token finds out instead of silently
+// being treated as anonymous.
+func (cfg *ApiConfig) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, authErr := cfg.authenticate(r)
+		if authErr != nil {
+			respondWithAuthError(w, r, authErr)
+			return
+		}
+		if principal == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cfg.serveAs(w, r, principal, next)
+	})
+}
+
+// RequireScope rejects callers whose credential does not grant scope.
+// Anonymous requests pass through untouched, so it can sit behind either
+// RequireAuth or OptionalAuth.
+func RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.PrincipalFromContext(r.Context())
+		if ok && !principal.HasScope(scope) {
+			respondWithAuthError(w, r, &authError{
+				problem:     common.CodeInsufficientScope,
+				code:        "insufficient_scope",
+				description: "Token does not grant the required scope",
+				scope:       scope,
+				err:         fmt.Errorf("scope %q required, have %q", scope, principal.Scopes),
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireSession only lets through callers who logged in with a password.
+// Scoped tokens must not be able to mint more tokens or reach admin routes.
+func (cfg *ApiConfig) RequireSession(next http.Handler) http.Handler {
+	return cfg.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.MustPrincipal(r.Context()).IsSession() {
+			respondWithAuthError(w, r, &authError{
+				problem:     common.CodeForbidden,
+				code:        "insufficient_scope",
+				description: "A login session is required",
+				err:         errors.New("scoped token used on a session-only route"),
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// RequireRole only lets requests through whose access token carries role or
+// a role above it. The role comes from the JWT, so a demotion takes effect
+// once the user's current access token expires.
+func (cfg *ApiConfig) RequireRole(role string, next http.Handler) http.Handler {
+	return cfg.RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.MustPrincipal(r.Context())
+		if !principal.HasRole(role) {
+			respondWithAuthError(w, r, &authError{
+				problem:     common.CodeForbidden,
+				code:        "insufficient_scope",
+				description: "Insufficient role",
+				err:         fmt.Errorf("role %q required, have %q", role, principal.Role),
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
@@ -0,0 +1,309 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/database/memory"
+	"github.com/google/uuid"
+)
+
+// newUser creates a user in store and returns their ID.
+func newUser(t *testing.T, store database.Store) uuid.UUID {
+	t.Helper()
+	user, err := store.CreateUser(context.Background(), database.CreateUserParams{
+		Email:          uuid.NewString() + "@example.com",
+		HashedPassword: "x",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user.ID
+}
+
+func TestRequireRole(t *testing.T) {
+	const secret = "test-secret"
+	store := memory.New()
+	cfg := &ApiConfig{Secret: secret, Store: store}
+
+	token := func(role string) string {
+		t.Helper()
+		tok, err := auth.MakeJWT(newUser(t, store), role, "", secret, time.Hour)
+		if err != nil {
+			t.Fatalf("MakeJWT: %v", err)
+		}
+		return "Bearer " + tok
+	}
+
+	tests := []struct {
+		name     string
+		header   string
+		wantCode int
+	}{
+		{name: "Missing token", wantCode: http.StatusUnauthorized},
+		{name: "Bad token", header: "Bearer nonsense", wantCode: http.StatusUnauthorized},
+		{name: "User role", header: token(auth.RoleUser), wantCode: http.StatusForbidden},
+		{name: "Moderator role", header: token(auth.RoleModerator), wantCode: http.StatusForbidden},
+		{name: "Admin role", header: token(auth.RoleAdmin), wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+
+			cfg.RequireRole(auth.RoleAdmin, next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	const secret = "test-secret"
+	store := memory.New()
+	cfg := &ApiConfig{Secret: secret, Store: store}
+	userID, disabledID := newUser(t, store), newUser(t, store)
+	if _, err := store.DisableUserById(context.Background(), disabledID); err != nil {
+		t.Fatalf("DisableUserById: %v", err)
+	}
+
+	valid, err := auth.MakeJWT(userID, auth.RoleUser, "session", secret, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	expired, err := auth.MakeJWT(userID, auth.RoleUser, "", secret, -time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	disabled, err := auth.MakeJWT(disabledID, auth.RoleUser, "", secret, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	deleted, err := auth.MakeJWT(uuid.New(), auth.RoleUser, "", secret, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		header        string
+		optional      bool
+		wantCode      int
+		wantChallenge string
+		wantPrincipal bool
+	}{
+		{
+			name:          "Missing token",
+			wantCode:      http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="chirpy"`,
+		},
+		{
+			name:          "Wrong scheme",
+			header:        "Basic dXNlcjpwYXNz",
+			wantCode:      http.StatusBadRequest,
+			wantChallenge: `Bearer realm="chirpy", error="invalid_request", error_description="Authorization header must be a bearer token"`,
+		},
+		{
+			name:          "Expired token",
+			header:        "Bearer " + expired,
+			wantCode:      http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="chirpy", error="invalid_token", error_description="Access token is invalid or expired"`,
+		},
+		{
+			name:          "Disabled account",
+			header:        "Bearer " + disabled,
+			wantCode:      http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="chirpy", error="invalid_token", error_description="Access token is invalid or expired"`,
+		},
+		{
+			name:          "Deleted account",
+			header:        "Bearer " + deleted,
+			wantCode:      http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="chirpy", error="invalid_token", error_description="Access token is invalid or expired"`,
+		},
+		{
+			name:          "Valid token",
+			header:        "Bearer " + valid,
+			wantCode:      http.StatusOK,
+			wantPrincipal: true,
+		},
+		{
+			name:          "Lowercase scheme",
+			header:        "bearer " + valid,
+			wantCode:      http.StatusOK,
+			wantPrincipal: true,
+		},
+		{
+			name:     "Optional without token",
+			optional: true,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:          "Optional with invalid token",
+			header:        "Bearer nonsense",
+			optional:      true,
+			wantCode:      http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="chirpy", error="invalid_token", error_description="Access token is invalid or expired"`,
+		},
+		{
+			name:          "Optional with valid token",
+			header:        "Bearer " + valid,
+			optional:      true,
+			wantCode:      http.StatusOK,
+			wantPrincipal: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *auth.Principal
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = auth.PrincipalFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+
+			middleware := cfg.RequireAuth
+			if tt.optional {
+				middleware = cfg.OptionalAuth
+			}
+			middleware(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if challenge := rec.Header().Get("WWW-Authenticate"); challenge != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", challenge, tt.wantChallenge)
+			}
+			if (got != nil) != tt.wantPrincipal {
+				t.Fatalf("principal = %+v, want present %v", got, tt.wantPrincipal)
+			}
+			if got != nil && (got.UserID != userID || got.SessionID != "session") {
+				t.Errorf("principal = %+v, want user %s in session %q", got, userID, "session")
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	session := &auth.Principal{UserID: uuid.New(), Role: auth.RoleAdmin}
+	readOnly := &auth.Principal{UserID: uuid.New(), Role: auth.RoleAdmin, Scopes: []string{auth.ScopeChirpsRead}}
+
+	tests := []struct {
+		name          string
+		principal     *auth.Principal
+		wantCode      int
+		wantChallenge string
+	}{
+		{name: "Anonymous", wantCode: http.StatusOK},
+		{name: "Login session", principal: session, wantCode: http.StatusOK},
+		{
+			name:          "Token without scope",
+			principal:     readOnly,
+			wantCode:      http.StatusForbidden,
+			wantChallenge: `Bearer realm="chirpy", error="insufficient_scope", error_description="Token does not grant the required scope", scope="chirps:write"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+			if tt.principal != nil {
+				req = req.WithContext(auth.NewContext(req.Context(), tt.principal))
+			}
+			rec := httptest.NewRecorder()
+
+			RequireScope(auth.ScopeChirpsWrite, next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if challenge := rec.Header().Get("WWW-Authenticate"); challenge != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", challenge, tt.wantChallenge)
+			}
+		})
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	const secret = "test-secret"
+
+	newStore := func(body string) *memory.Store {
+		store := memory.New()
+		ctx := context.Background()
+		user, err := store.CreateUser(ctx, database.CreateUserParams{Email: body + "@example.com", HashedPassword: "x"})
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if _, err := store.CreateChirp(ctx, database.CreateChirpParams{Body: body, UserID: user.ID}); err != nil {
+			t.Fatalf("CreateChirp: %v", err)
+		}
+		return store
+	}
+	primary := newStore("primary")
+	writer, reader := newUser(t, primary), newUser(t, primary)
+	cfg := &ApiConfig{
+		Secret: secret,
+		Store: database.NewReplicaStore(primary, database.Replica{
+			Name:  "replica",
+			Store: newStore("replica"),
+			Ping:  func(context.Context) error { return nil },
+		}),
+		RecentWrites: database.NewRecentWriters(time.Hour),
+	}
+
+	// next reports which database its reads were served from.
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chirps, err := cfg.Store.GetChirps(r.Context())
+		if err != nil || len(chirps) != 1 {
+			t.Fatalf("GetChirps() = %v, %v", chirps, err)
+		}
+		w.Write([]byte(chirps[0].Body))
+	})
+	serve := func(method string, userID uuid.UUID) string {
+		t.Helper()
+		token, err := auth.MakeJWT(userID, auth.RoleUser, "session", secret, time.Hour)
+		if err != nil {
+			t.Fatalf("MakeJWT: %v", err)
+		}
+		req := httptest.NewRequest(method, "/api/chirps", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		cfg.OptionalAuth(next).ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	if got := serve(http.MethodGet, writer); got != "replica" {
+		t.Errorf("Read from %s before writing, want replica", got)
+	}
+	if got := serve(http.MethodPost, writer); got != "primary" {
+		t.Errorf("Write read from %s, want primary", got)
+	}
+	if got := serve(http.MethodGet, writer); got != "primary" {
+		t.Errorf("Read from %s after writing, want primary", got)
+	}
+	if got := serve(http.MethodGet, reader); got != "replica" {
+		t.Errorf("Another user read from %s, want replica", got)
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+)
+
+// chirpETag is a strong validator for one chirp. Every change to a chirp
+// moves its updated_at, which the database keeps to the microsecond.
+func chirpETag(chirp database.Chirp) string {
+	return fmt.Sprintf(`"%s.%x"`, chirp.ID, chirp.UpdatedAt.UnixMicro())
+}
+
+// chirpsETag is a strong validator for a listing of chirps. Creating or
+// editing a chirp moves the newest updated_at and deleting one changes the
+// count, so either invalidates it.
+func chirpsETag(chirps []database.Chirp) string {
+	var newest time.Time
+	for _, chirp := range chirps {
+		if chirp.UpdatedAt.After(newest) {
+			newest = chirp.UpdatedAt
+		}
+	}
+	return fmt.Sprintf(`"%d.%x"`, len(chirps), newest.UnixMicro())
+}
+
+// setValidators sets the validators of a chirp representation. Clients may
+// store it but must revalidate before each use, which is cheap with them.
+// lastModified may be zero.
+func setValidators(w http.ResponseWriter, etag string, lastModified time.Time) {
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+}
+
+// notModified reports whether the client already holds the representation
+// with etag and lastModified, following RFC 9110 section 13.2.2:
+// If-None-Match is compared weakly, and If-Modified-Since is only consulted
+// without it. If so it answers 304 with the validators set by setValidators.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatches(inm, etag, false) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		if err != nil || lastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// ifMatch reports whether the request's If-Match precondition, if any,
+// holds for the current etag. It is compared strongly, as RFC 9110 section
+// 13.1.1 requires.
+func ifMatch(r *http.Request, etag string) bool {
+	im := r.Header.Get("If-Match")
+	return im == "" || etagMatches(im, etag, true)
+}
+
+// etagMatches reports whether the comma separated list of entity tags in
+// header holds etag or is "*". A strong comparison never matches weak tags.
+func etagMatches(header, etag string, strong bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak, ok := strings.CutPrefix(tag, "W/"); ok {
+			if strong {
+				continue
+			}
+			tag = weak
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package api
+
+import "testing"
+
+func TestETagMatches(t *testing.T) {
+	const etag = `"abc.1"`
+
+	tests := []struct {
+		name   string
+		header string
+		strong bool
+		want   bool
+	}{
+		{name: "Exact", header: `"abc.1"`, want: true},
+		{name: "In a list", header: `"x", "abc.1" ,"y"`, want: true},
+		{name: "Wildcard", header: " * ", strong: true, want: true},
+		{name: "Different", header: `"abc.2"`},
+		{name: "Unquoted", header: `abc.1`},
+		{name: "Weak tag, weak comparison", header: `W/"abc.1"`, want: true},
+		{name: "Weak tag, strong comparison", header: `W/"abc.1"`, strong: true},
+		{name: "Strong tag, strong comparison", header: `W/"x", "abc.1"`, strong: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, etag, tt.strong); got != tt.want {
+				t.Errorf("etagMatches(%q, strong=%v) = %v, want %v", tt.header, tt.strong, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"encoding/json"
 	"net/http"
 	"strings"
 
@@ -20,34 +19,17 @@ func (cfg *ApiConfig) CreateChirpsHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	type chirpParameters struct {
-		Body string `json:"body"`
+		Body string `json:"body" validate:"required,max=140"`
 	}
 
 	type chirpResponse struct {
 		Chirp
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		common.RespondWithError(w, http.StatusBadRequest, "Unable to process request header", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.Secret)
-	if err != nil {
-		common.RespondWithError(w, http.StatusUnauthorized, "Unauthorized user", err)
-		return
-	}
+	userID := auth.MustPrincipal(r.Context()).UserID
 
-	decoder := json.NewDecoder(r.Body)
 	params := chirpParameters{}
-	if err := decoder.Decode(&params); err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not decode parameters", err)
-		return
-	}
-
-	if len(params.Body) > 140 {
-		common.RespondWithError(w, 400, "Chirp is too long", nil)
+	if !common.DecodeJSON(w, r, &params) {
 		return
 	}
 
@@ -65,12 +47,14 @@ func (cfg *ApiConfig) CreateChirpsHandler(w http.ResponseWriter, r *http.Request
 		UserID: userID,
 	}
 
-	chirp, err := cfg.DbQueries.CreateChirp(r.Context(), arg)
+	chirp, err := cfg.Store.CreateChirp(r.Context(), arg)
 	if err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not create new user", err)
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not create chirp", err)
 		return
 	}
+	cfg.Metrics.ChirpsCreated.Inc()
 
+	w.Header().Set("ETag", chirpETag(chirp))
 	common.RespondWithJson(w, http.StatusCreated, chirpResponse{
 		Chirp: Chirp{
 			ID:        chirp.ID,
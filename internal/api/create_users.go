@@ -1,7 +1,6 @@
 package api
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/cloudsmyth/chirpy/internal/auth"
@@ -12,20 +11,18 @@ import (
 func (cfg *ApiConfig) AddUserHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required,email"`
+		Password string `json:"password" validate:"required"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	if err := decoder.Decode(&params); err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not decode parameters", err)
+	if !common.DecodeJSON(w, r, &params) {
 		return
 	}
 
 	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not hash password", err)
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not hash password", err)
 		return
 	}
 
@@ -33,9 +30,13 @@ func (cfg *ApiConfig) AddUserHandler(w http.ResponseWriter, r *http.Request) {
 		Email:          params.Email,
 		HashedPassword: hashedPassword,
 	}
-	user, err := cfg.DbQueries.CreateUser(r.Context(), arg)
+	user, err := cfg.Store.CreateUser(r.Context(), arg)
+	if database.IsUniqueViolation(err) {
+		common.RespondWithProblem(w, r, common.CodeEmailTaken, "An account with that email already exists", err)
+		return
+	}
 	if err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not create new user", err)
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not create new user", err)
 		return
 	}
 
@@ -46,6 +47,7 @@ func (cfg *ApiConfig) AddUserHandler(w http.ResponseWriter, r *http.Request) {
 			UpdatedAt:   user.UpdatedAt,
 			Email:       user.Email,
 			IsChirpyRed: user.IsChirpyRed,
+			Role:        user.Role,
 		},
 	})
 }
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 
 	"github.com/cloudsmyth/chirpy/internal/auth"
@@ -9,6 +11,11 @@ import (
 	"github.com/google/uuid"
 )
 
+var (
+	errNotAuthor          = errors.New("not the chirp's author")
+	errPreconditionFailed = errors.New("If-Match does not match the chirp")
+)
+
 func (cfg *ApiConfig) DeleteChirpsHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
@@ -17,37 +24,47 @@ func (cfg *ApiConfig) DeleteChirpsHandler(w http.ResponseWriter, r *http.Request
 	chirpIdString := r.PathValue("chirpId")
 	chirpId, err := uuid.Parse(chirpIdString)
 	if err != nil {
-		common.RespondWithError(w, http.StatusBadRequest, "Bad ChirpId used", err)
-	}
-
-	authHeader, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		common.RespondWithError(w, http.StatusUnauthorized, "Unable to get auth token", err)
+		common.RespondWithProblem(w, r, common.CodeInvalidParameter, "chirpId must be a UUID", err)
 		return
 	}
 
-	validUserId, err := auth.ValidateJWT(authHeader, cfg.Secret)
-	if err != nil {
-		common.RespondWithError(w, http.StatusUnauthorized, "Token not correct", err)
+	principal := auth.MustPrincipal(r.Context())
+
+	err = cfg.Store.InTx(r.Context(), func(tx database.Store) error {
+		chirp, err := tx.GetChirpById(r.Context(), chirpId)
+		if err != nil {
+			return err
+		}
+
+		// Moderators may remove anyone's chirp; everyone else only their own.
+		if chirp.UserID != principal.UserID && !principal.HasRole(auth.RoleModerator) {
+			return errNotAuthor
+		}
+		// Checked in the transaction so the chirp cannot change between the
+		// comparison and the delete.
+		if !ifMatch(r, chirpETag(chirp)) {
+			return errPreconditionFailed
+		}
+
+		return tx.DeleteChirpById(r.Context(), database.DeleteChirpByIdParams{
+			UserID: chirp.UserID,
+			ID:     chirpId,
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		common.RespondWithProblem(w, r, common.CodeNotFound, "Chirp not found", err)
 		return
 	}
-
-	chirp, err := cfg.DbQueries.GetChirpById(r.Context(), chirpId)
-	if err != nil {
-		common.RespondWithError(w, http.StatusNotFound, "Chrip not found", err)
+	if errors.Is(err, errNotAuthor) {
+		common.RespondWithProblem(w, r, common.CodeForbidden, "Only the author can delete this chirp", nil)
 		return
 	}
-
-	if chirp.UserID != validUserId {
-		common.RespondWithError(w, http.StatusForbidden, "Can not delete chirp", err)
+	if errors.Is(err, errPreconditionFailed) {
+		common.RespondWithProblem(w, r, common.CodePreconditionFailed, "The chirp has changed since it was fetched", err)
 		return
 	}
-
-	if err = cfg.DbQueries.DeleteChirpById(r.Context(), database.DeleteChirpByIdParams{
-		UserID: validUserId,
-		ID:     chirpId,
-	}); err != nil {
-		common.RespondWithError(w, http.StatusForbidden, "Could not delete chirp", err)
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not delete chirp", err)
 		return
 	}
 
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/common"
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// FollowUserHandler makes the caller follow userId. Following someone twice
+// is not an error.
+func (cfg *ApiConfig) FollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	type response struct{}
+
+	principal := auth.MustPrincipal(r.Context())
+
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInvalidParameter, "userId must be a UUID", err)
+		return
+	}
+	if userId == principal.UserID {
+		common.RespondWithProblem(w, r, common.CodeInvalidParameter, "Users cannot follow themselves", nil)
+		return
+	}
+
+	err = cfg.Store.InTx(r.Context(), func(tx database.Store) error {
+		if _, err := tx.GetUserById(r.Context(), userId); err != nil {
+			return err
+		}
+		return tx.FollowUser(r.Context(), database.FollowUserParams{
+			FollowerID: principal.UserID,
+			FolloweeID: userId,
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		common.RespondWithProblem(w, r, common.CodeNotFound, "Could not find user", err)
+		return
+	}
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not follow user", err)
+		return
+	}
+
+	common.RespondWithJson(w, http.StatusNoContent, response{})
+}
+
+func (cfg *ApiConfig) UnfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	type response struct{}
+
+	principal := auth.MustPrincipal(r.Context())
+
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInvalidParameter, "userId must be a UUID", err)
+		return
+	}
+
+	unfollowed, err := cfg.Store.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: principal.UserID,
+		FolloweeID: userId,
+	})
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not unfollow user", err)
+		return
+	}
+	if unfollowed == 0 {
+		common.RespondWithProblem(w, r, common.CodeNotFound, "Not following user", nil)
+		return
+	}
+
+	common.RespondWithJson(w, http.StatusNoContent, response{})
+}
@@ -1,8 +1,11 @@
 package api
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"sort"
+	"time"
 
 	"github.com/cloudsmyth/chirpy/internal/common"
 	"github.com/cloudsmyth/chirpy/internal/database"
@@ -19,18 +22,27 @@ func (cfg *ApiConfig) GetChirpsHandler(w http.ResponseWriter, r *http.Request) {
 	order := r.URL.Query().Get("sort")
 
 	if authorId != "" {
-		authorUUID, err := uuid.Parse(authorId)
+		var authorUUID uuid.UUID
+		authorUUID, err = uuid.Parse(authorId)
 		if err != nil {
-			common.RespondWithError(w, http.StatusBadRequest, "Invalid author_id format", err)
+			common.RespondWithProblem(w, r, common.CodeInvalidParameter, "author_id must be a UUID", err)
 			return
 		}
-		chirps, err = cfg.DbQueries.GetChirpsByAuthor(r.Context(), authorUUID)
+		chirps, err = cfg.Store.GetChirpsByAuthor(r.Context(), authorUUID)
 	} else {
-		chirps, err = cfg.DbQueries.GetChirps(r.Context())
+		chirps, err = cfg.Store.GetChirps(r.Context())
 	}
 
 	if err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not get chirps from db", err)
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not get chirps from db", err)
+		return
+	}
+
+	// Listings change through deletions without moving any updated_at, so
+	// only the ETag can validate them.
+	etag := chirpsETag(chirps)
+	setValidators(w, etag, time.Time{})
+	if notModified(w, r, etag, time.Time{}) {
 		return
 	}
 
@@ -67,12 +79,23 @@ func (cfg *ApiConfig) GetChirpByIdHandler(w http.ResponseWriter, r *http.Request
 	chirpIdString := r.PathValue("chirpId")
 	chirpId, err := uuid.Parse(chirpIdString)
 	if err != nil {
-		common.RespondWithError(w, http.StatusBadRequest, "Bad ChirpId used", err)
+		common.RespondWithProblem(w, r, common.CodeInvalidParameter, "chirpId must be a UUID", err)
+		return
 	}
 
-	chirp, err := cfg.DbQueries.GetChirpById(r.Context(), chirpId)
+	chirp, err := cfg.Store.GetChirpById(r.Context(), chirpId)
+	if errors.Is(err, sql.ErrNoRows) {
+		common.RespondWithProblem(w, r, common.CodeNotFound, "Chirp not found", err)
+		return
+	}
 	if err != nil {
-		common.RespondWithError(w, http.StatusNotFound, "Could not get chirp from db", err)
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not get chirp from db", err)
+		return
+	}
+
+	etag := chirpETag(chirp)
+	setValidators(w, etag, chirp.UpdatedAt)
+	if notModified(w, r, etag, chirp.UpdatedAt) {
 		return
 	}
 
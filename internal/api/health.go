@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/common"
+	"github.com/cloudsmyth/chirpy/internal/logging"
+)
+
+// Health serves the liveness and readiness probes. Liveness only says the
+// process is up; readiness runs every registered dependency check and is
+// forced to fail once shutdown has begun so load balancers stop routing to
+// an instance that is draining.
+type Health struct {
+	Timeout time.Duration
+
+	checks       []healthCheck
+	shuttingDown atomic.Bool
+}
+
+type healthCheck struct {
+	name    string
+	failure string
+	check   func(context.Context) error
+}
+
+type checkResult struct {
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+type readinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// AddCheck registers a named readiness check. The probe is public, so a
+// failing check reports failure, or that it timed out, and its error is only
+// logged.
+func (h *Health) AddCheck(name, failure string, check func(context.Context) error) {
+	h.checks = append(h.checks, healthCheck{name: name, failure: failure, check: check})
+}
+
+// SetShuttingDown makes every later readiness probe fail.
+func (h *Health) SetShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+func (h *Health) LivezHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+func (h *Health) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.Timeout)
+	defer cancel()
+
+	resp := readinessResponse{
+		Status: "ok",
+		Checks: make(map[string]checkResult, len(h.checks)+1),
+	}
+
+	if h.shuttingDown.Load() {
+		resp.Status = "unavailable"
+		resp.Checks["shutdown"] = checkResult{Status: "error", Error: "server is shutting down"}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, hc := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := hc.check(ctx)
+			result := checkResult{
+				Status:     "ok",
+				DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = "error"
+				result.Error = hc.failure
+				if ctx.Err() != nil {
+					result.Error = "timed out"
+				}
+				logging.FromContext(r.Context()).Warn("Readiness check failed", "check", hc.name, "error", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Checks[hc.name] = result
+			if err != nil {
+				resp.Status = "unavailable"
+			}
+		}()
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	if resp.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	common.RespondWithJson(w, code, resp)
+}
+
+// DatabaseCheck pings the database.
+func DatabaseCheck(db *sql.DB) func(context.Context) error {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// MigrationCheck verifies that goose has applied exactly the schema version
+// this binary was built against.
+func MigrationCheck(db *sql.DB, want int64) func(context.Context) error {
+	return func(ctx context.Context) error {
+		var got sql.NullInt64
+		err := db.QueryRowContext(ctx, "select max(version_id) from goose_db_version where is_applied").Scan(&got)
+		if err != nil {
+			return fmt.Errorf("reading schema version: %w", err)
+		}
+		if !got.Valid {
+			return errors.New("no migrations applied")
+		}
+		if got.Int64 != want {
+			return fmt.Errorf("schema version is %d, expected %d", got.Int64, want)
+		}
+		return nil
+	}
+}
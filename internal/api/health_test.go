@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadyzHandler(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	failing := func(context.Context) error { return errors.New("connection refused") }
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name         string
+		checks       map[string]func(context.Context) error
+		shuttingDown bool
+		wantCode     int
+		wantFailed   string
+		wantError    string
+	}{
+		{
+			name:     "All checks pass",
+			checks:   map[string]func(context.Context) error{"database": ok, "migrations": ok},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:       "Failing check",
+			checks:     map[string]func(context.Context) error{"database": failing, "migrations": ok},
+			wantCode:   http.StatusServiceUnavailable,
+			wantFailed: "database",
+			wantError:  "unreachable",
+		},
+		{
+			name:       "Check times out",
+			checks:     map[string]func(context.Context) error{"database": slow},
+			wantCode:   http.StatusServiceUnavailable,
+			wantFailed: "database",
+			wantError:  "timed out",
+		},
+		{
+			name:         "Shutting down",
+			checks:       map[string]func(context.Context) error{"database": ok},
+			shuttingDown: true,
+			wantCode:     http.StatusServiceUnavailable,
+			wantFailed:   "shutdown",
+			wantError:    "server is shutting down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Health{Timeout: 50 * time.Millisecond}
+			for name, check := range tt.checks {
+				h.AddCheck(name, "unreachable", check)
+			}
+			if tt.shuttingDown {
+				h.SetShuttingDown()
+			}
+
+			rr := httptest.NewRecorder()
+			h.ReadyzHandler(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("Expected status %d, got %d", tt.wantCode, rr.Code)
+			}
+
+			var resp readinessResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Could not decode response: %v", err)
+			}
+			for name := range tt.checks {
+				if _, ok := resp.Checks[name]; !ok {
+					t.Errorf("Expected result for check %q", name)
+				}
+			}
+			if got := resp.Checks[tt.wantFailed]; tt.wantFailed != "" && (got.Status != "error" || got.Error != tt.wantError) {
+				t.Errorf("Expected check %q to fail with %q, got %+v", tt.wantFailed, tt.wantError, got)
+			}
+			if strings.Contains(rr.Body.String(), "connection refused") {
+				t.Errorf("Expected the check's error to stay out of the response, got %s", rr.Body)
+			}
+		})
+	}
+}
+
+func TestLivezHandler(t *testing.T) {
+	h := &Health{}
+	h.AddCheck("database", "unreachable", func(context.Context) error { return errors.New("down") })
+
+	rr := httptest.NewRecorder()
+	h.LivezHandler(rr, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "OK" {
+		t.Errorf("Expected 200 OK regardless of dependencies, got %d %q", rr.Code, rr.Body.String())
+	}
+}
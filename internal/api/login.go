@@ -1,64 +1,111 @@
 package api
 
 import (
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/cloudsmyth/chirpy/internal/auth"
 	"github.com/cloudsmyth/chirpy/internal/common"
 	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/logging"
+)
+
+var (
+	errCredentialsChanged = errors.New("credentials changed during login")
+	errAccountDisabled    = errors.New("account disabled during login")
 )
 
 func (cfg *ApiConfig) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required,email"`
+		Password string `json:"password" validate:"required"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	if err := decoder.Decode(&params); err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not decode parameters", err)
+	if !common.DecodeJSON(w, r, &params) {
 		return
 	}
 
-	user, err := cfg.DbQueries.GetUserByEmail(r.Context(), params.Email)
+	user, err := cfg.Store.GetUserByEmail(r.Context(), params.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.Metrics.LoginAttempts.WithLabelValues("failure").Inc()
+		common.RespondWithProblem(w, r, common.CodeInvalidCredentials, "Incorrect email or password", err)
+		return
+	}
 	if err != nil {
-		common.RespondWithError(w, http.StatusBadRequest, "Could not get user with that email", err)
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not get user from db", err)
 		return
 	}
 
-	token, err := auth.MakeJWT(user.ID, cfg.Secret)
-	if err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Error making jwt", err)
+	if err := auth.CheckHashedPassword(user.HashedPassword, params.Password); err != nil {
+		cfg.Metrics.LoginAttempts.WithLabelValues("failure").Inc()
+		common.RespondWithProblem(w, r, common.CodeInvalidCredentials, "Incorrect email or password", err)
+		return
+	}
+	if user.DisabledAt.Valid {
+		cfg.Metrics.LoginAttempts.WithLabelValues("failure").Inc()
+		common.RespondWithProblem(w, r, common.CodeAccountDisabled, "Account disabled", nil)
 		return
 	}
 
+	// The password check is too slow to hold a transaction open for, so the
+	// user is read again inside one: a password change or ban that landed in
+	// between must not be followed by a new session.
 	refreshToken := auth.MakeRefreshToken()
+	var token string
+	err = cfg.Store.InTx(r.Context(), func(tx database.Store) error {
+		current, err := tx.GetUserById(r.Context(), user.ID)
+		if err != nil {
+			return err
+		}
+		if current.HashedPassword != user.HashedPassword {
+			return errCredentialsChanged
+		}
+		if current.DisabledAt.Valid {
+			return errAccountDisabled
+		}
+		user = current
 
-	refresh, err := cfg.DbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refreshToken,
-		UserID:    user.ID,
-		ExpiresAt: time.Now().AddDate(0, 0, 60),
+		token, err = auth.MakeJWT(user.ID, user.Role, auth.SessionID(refreshToken), cfg.Secret, cfg.JWTExpiresIn)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+			Token:     refreshToken,
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(cfg.RefreshExpiresIn),
+		})
+		return err
 	})
-
-	err = auth.CheckHashedPassword(user.HashedPassword, params.Password)
-	if err != nil {
-		common.RespondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
+	switch {
+	case errors.Is(err, errCredentialsChanged), errors.Is(err, sql.ErrNoRows):
+		cfg.Metrics.LoginAttempts.WithLabelValues("failure").Inc()
+		common.RespondWithProblem(w, r, common.CodeInvalidCredentials, "Incorrect email or password", err)
+		return
+	case errors.Is(err, errAccountDisabled):
+		cfg.Metrics.LoginAttempts.WithLabelValues("failure").Inc()
+		common.RespondWithProblem(w, r, common.CodeAccountDisabled, "Account disabled", nil)
+		return
+	case err != nil:
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not create session", err)
 		return
-	} else {
-		common.RespondWithJson(w, http.StatusOK, UserResponse{
-			User: User{
-				ID:           user.ID,
-				CreatedAt:    user.CreatedAt,
-				UpdatedAt:    user.UpdatedAt,
-				Email:        user.Email,
-				Token:        token,
-				RefreshToken: refresh.Token,
-				IsChirpyRed:  user.IsChirpyRed,
-			},
-		})
 	}
+
+	cfg.Metrics.LoginAttempts.WithLabelValues("success").Inc()
+	logging.SetUserID(r.Context(), user.ID)
+	common.RespondWithJson(w, http.StatusOK, UserResponse{
+		User: User{
+			ID:           user.ID,
+			CreatedAt:    user.CreatedAt,
+			UpdatedAt:    user.UpdatedAt,
+			Email:        user.Email,
+			Token:        token,
+			RefreshToken: refreshToken,
+			IsChirpyRed:  user.IsChirpyRed,
+			Role:         user.Role,
+		},
+	})
 }
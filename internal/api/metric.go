@@ -3,44 +3,52 @@ package api
 import (
 	"fmt"
 	"net/http"
-)
 
-func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
-}
+	"github.com/cloudsmyth/chirpy/internal/common"
+)
 
 func (cfg *ApiConfig) MetricShowHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
-	metric := cfg.FileServerHits.Load()
+	m := cfg.Metrics
 	metrics := fmt.Sprintf(`<html>
   <body>
     <h1>Welcome, Chirpy Admin</h1>
     <p>Chirpy has been visited %d times!</p>
+    <p>%d chirps have been created.</p>
+    <p>Logins: %d succeeded, %d failed.</p>
+    <p>Refresh token cleanup has run %d times and purged %d tokens.</p>
   </body>
 </html>
-`, metric)
+`,
+		m.FileServerHitsSinceReset(),
+		int64(m.Value("chirpy_chirps_created_total")),
+		int64(m.Value("chirpy_login_attempts_total", "result", "success")),
+		int64(m.Value("chirpy_login_attempts_total", "result", "failure")),
+		int64(m.Value("chirpy_refresh_token_cleanup_runs_total")),
+		int64(m.Value("chirpy_refresh_tokens_purged_total")),
+	)
 	w.Write([]byte(metrics))
 }
 
 func (cfg *ApiConfig) MetricResetHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	if cfg.Platform != "dev" {
-		w.WriteHeader(http.StatusForbidden)
-		w.Write([]byte("Reset is only allowed in dev!"))
+		common.RespondWithProblem(w, r, common.CodeForbidden, "Reset is only allowed in dev", nil)
+		return
+	}
+	if err := cfg.Store.Reset(r.Context()); err != nil {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not reset the database", err)
 		return
 	}
+	cfg.Metrics.ResetFileServerHits()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	cfg.DbQueries.Reset(r.Context())
-	cfg.FileServerHits.Store(0)
 	w.Write([]byte("Counter reset to 0"))
 }
 
 func (cfg *ApiConfig) IncrementHits(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.FileServerHits.Add(1)
+		cfg.Metrics.FileServerHits.Add(1)
 		next.ServeHTTP(w, r)
 	})
 }
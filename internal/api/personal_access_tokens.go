@@ -0,0 +1,140 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/common"
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	// Token is only set in the response that creates the token; it is
+	// never stored and cannot be retrieved again.
+	Token string `json:"token,omitempty"`
+}
+
+func newPersonalAccessToken(pat database.PersonalAccessToken) PersonalAccessToken {
+	token := PersonalAccessToken{
+		ID:        pat.ID,
+		Name:      pat.Name,
+		Scopes:    pat.Scopes,
+		CreatedAt: pat.CreatedAt,
+	}
+	if pat.ExpiresAt.Valid {
+		token.ExpiresAt = &pat.ExpiresAt.Time
+	}
+	if pat.LastUsedAt.Valid {
+		token.LastUsedAt = &pat.LastUsedAt.Time
+	}
+	return token
+}
+
+func (cfg *ApiConfig) CreatePersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type parameters struct {
+		Name      string     `json:"name" validate:"required,max=100"`
+		Scopes    []string   `json:"scopes" validate:"required"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	principal := auth.MustPrincipal(r.Context())
+
+	params := parameters{}
+	if !common.DecodeJSON(w, r, &params) {
+		return
+	}
+
+	var fieldErrs []common.FieldError
+	for _, scope := range params.Scopes {
+		if !auth.ValidScope(scope) {
+			fieldErrs = append(fieldErrs, common.FieldError{Field: "scopes", Code: "invalid", Detail: fmt.Sprintf("Unknown scope %q", scope)})
+		}
+	}
+	if params.ExpiresAt != nil && !params.ExpiresAt.After(time.Now()) {
+		fieldErrs = append(fieldErrs, common.FieldError{Field: "expires_at", Code: "invalid", Detail: "Must be in the future"})
+	}
+	if fieldErrs != nil {
+		common.RespondWithFieldErrors(w, r, fieldErrs)
+		return
+	}
+	slices.Sort(params.Scopes)
+	params.Scopes = slices.Compact(params.Scopes)
+
+	expiresAt := sql.NullTime{}
+	if params.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: params.ExpiresAt.UTC(), Valid: true}
+	}
+
+	token := auth.MakePersonalAccessToken()
+	pat, err := cfg.Store.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    principal.UserID,
+		Name:      params.Name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    params.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not create token", err)
+		return
+	}
+
+	response := newPersonalAccessToken(pat)
+	response.Token = token
+	common.RespondWithJson(w, http.StatusCreated, response)
+}
+
+func (cfg *ApiConfig) ListPersonalAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	principal := auth.MustPrincipal(r.Context())
+
+	pats, err := cfg.Store.ListPersonalAccessTokensByUser(r.Context(), principal.UserID)
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not get tokens from db", err)
+		return
+	}
+
+	response := []PersonalAccessToken{}
+	for _, pat := range pats {
+		response = append(response, newPersonalAccessToken(pat))
+	}
+
+	common.RespondWithJson(w, http.StatusOK, response)
+}
+
+func (cfg *ApiConfig) RevokePersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	type response struct{}
+
+	principal := auth.MustPrincipal(r.Context())
+
+	tokenId, err := uuid.Parse(r.PathValue("tokenId"))
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInvalidParameter, "tokenId must be a UUID", err)
+		return
+	}
+
+	revoked, err := cfg.Store.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenId,
+		UserID: principal.UserID,
+	})
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not revoke token", err)
+		return
+	}
+	if revoked == 0 {
+		common.RespondWithProblem(w, r, common.CodeNotFound, "Could not find token", nil)
+		return
+	}
+
+	common.RespondWithJson(w, http.StatusNoContent, response{})
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -16,29 +18,48 @@ func (cfg *ApiConfig) RefreshHandler(w http.ResponseWriter, r *http.Request) {
 
 	authHeader, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not get Bearer", err)
+		common.RespondWithProblem(w, r, common.CodeUnauthorized, "A refresh token is required", err)
 		return
 	}
 
-	refreshQuery, err := cfg.DbQueries.GetRefreshByToken(r.Context(), authHeader)
+	refreshQuery, err := cfg.Store.GetRefreshByToken(r.Context(), authHeader)
+	if errors.Is(err, sql.ErrNoRows) {
+		common.RespondWithProblem(w, r, common.CodeInvalidToken, "Unknown refresh token", err)
+		return
+	}
 	if err != nil {
-		common.RespondWithError(w, http.StatusUnauthorized, "Could not find record", err)
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not look up refresh token", err)
 		return
 	}
 
 	if time.Now().After(refreshQuery.ExpiresAt) {
-		common.RespondWithError(w, http.StatusUnauthorized, "Token expired", fmt.Errorf("Refresh token has expired"))
+		common.RespondWithProblem(w, r, common.CodeInvalidToken, "Refresh token has expired", fmt.Errorf("Refresh token has expired"))
 		return
 	}
 
 	if refreshQuery.RevokedAt.Valid {
-		common.RespondWithError(w, http.StatusUnauthorized, "Token revoked", fmt.Errorf("Refresh token has been revoked"))
+		common.RespondWithProblem(w, r, common.CodeInvalidToken, "Refresh token has been revoked", fmt.Errorf("Refresh token has been revoked"))
 		return
 	}
 
-	jwtToken, err := auth.MakeJWT(refreshQuery.UserID, cfg.Secret)
+	user, err := cfg.Store.GetUserById(r.Context(), refreshQuery.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		common.RespondWithProblem(w, r, common.CodeInvalidToken, "Could not find user", err)
+		return
+	}
 	if err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Token could not be created", err)
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not get user from db", err)
+		return
+	}
+
+	if user.DisabledAt.Valid {
+		common.RespondWithProblem(w, r, common.CodeAccountDisabled, "Account disabled", nil)
+		return
+	}
+
+	jwtToken, err := auth.MakeJWT(user.ID, user.Role, auth.SessionID(refreshQuery.Token), cfg.Secret, cfg.JWTExpiresIn)
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Token could not be created", err)
 		return
 	}
 
@@ -50,13 +71,17 @@ func (cfg *ApiConfig) RevokeHandler(w http.ResponseWriter, r *http.Request) {
 
 	authHeader, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not get Bearer", err)
+		common.RespondWithProblem(w, r, common.CodeUnauthorized, "A refresh token is required", err)
 		return
 	}
 
-	_, err = cfg.DbQueries.RevokeRefreshByToken(r.Context(), authHeader)
+	_, err = cfg.Store.RevokeRefreshByToken(r.Context(), authHeader)
+	if errors.Is(err, sql.ErrNoRows) {
+		common.RespondWithProblem(w, r, common.CodeInvalidToken, "Unknown refresh token", err)
+		return
+	}
 	if err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Refresh was not revoked", err)
+		common.RespondWithProblem(w, r, common.CodeInternal, "Refresh was not revoked", err)
 		return
 	}
 
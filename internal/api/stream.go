@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/common"
+	"github.com/cloudsmyth/chirpy/internal/logging"
+	"github.com/cloudsmyth/chirpy/internal/stream"
+	"github.com/google/uuid"
+)
+
+// streamReset tells a resuming client that the events it missed are no
+// longer buffered, so it should refetch the chirps it shows.
+const streamReset = "event: stream.reset\ndata: {}\n\n"
+
+// StreamHandler sends chirp events as Server-Sent Events until the client
+// goes away. author_id, which may be repeated, limits them to those authors,
+// and following=true to the authors the caller follows when the stream
+// opens; given both, a chirp by either is sent. A client reconnecting with
+// Last-Event-ID first gets the events it missed.
+func (cfg *ApiConfig) StreamHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	query := r.URL.Query()
+	authors := map[uuid.UUID]bool{}
+	for _, authorId := range query["author_id"] {
+		authorUUID, err := uuid.Parse(authorId)
+		if err != nil {
+			common.RespondWithProblem(w, r, common.CodeInvalidParameter, "author_id must be a UUID", err)
+			return
+		}
+		authors[authorUUID] = true
+	}
+
+	following := false
+	if value := query.Get("following"); value != "" {
+		var err error
+		following, err = strconv.ParseBool(value)
+		if err != nil {
+			common.RespondWithProblem(w, r, common.CodeInvalidParameter, "following must be true or false", err)
+			return
+		}
+	}
+	if following {
+		principal, ok := auth.PrincipalFromContext(r.Context())
+		if !ok {
+			common.RespondWithProblem(w, r, common.CodeUnauthorized, "following=true needs a logged in caller", nil)
+			return
+		}
+		followed, err := cfg.Store.GetFollowedUserIds(r.Context(), principal.UserID)
+		if err != nil {
+			common.RespondWithProblem(w, r, common.CodeInternal, "Could not get followed users from db", err)
+			return
+		}
+		for _, id := range followed {
+			authors[id] = true
+		}
+	}
+
+	// Following nobody sends nothing rather than everything.
+	filtered := len(query["author_id"]) > 0 || following
+	wanted := func(event stream.Event) bool {
+		return !filtered || authors[event.Chirp.UserID]
+	}
+
+	sub, missed, resumed, err := cfg.Events.Subscribe(r.Header.Get("Last-Event-ID"))
+	if errors.Is(err, stream.ErrTooManySubscribers) {
+		common.RespondWithProblem(w, r, common.CodeUnavailable, "Too many open streams, try again later", err)
+		return
+	}
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not open stream", err)
+		return
+	}
+	defer sub.Close()
+	cfg.Metrics.StreamSubscribers.Inc()
+	defer cfg.Metrics.StreamSubscribers.Dec()
+
+	// The server's read and write timeouts would end every stream, so each
+	// write gets a deadline of its own instead.
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not open stream", err)
+		return
+	}
+	send := func(message string) error {
+		err := rc.SetWriteDeadline(time.Now().Add(cfg.StreamHeartbeat))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		if _, err := io.WriteString(w, message); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// A comment gets the headers to the client before the first event.
+	opening := ": connected\n\n"
+	if !resumed {
+		opening += streamReset
+	}
+	for _, event := range missed {
+		if wanted(event) {
+			opening += formatEvent(event)
+		}
+	}
+	err = send(opening)
+
+	heartbeat := time.NewTicker(cfg.StreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for err == nil {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Dropped by the hub; the client reconnects and resumes.
+				return
+			}
+			if wanted(event) {
+				err = send(formatEvent(event))
+			}
+		case <-heartbeat.C:
+			err = send(": heartbeat\n\n")
+		}
+	}
+	logging.FromContext(r.Context()).Debug("Chirp stream ended", "error", err)
+}
+
+// formatEvent renders event as a Server-Sent Event. Created chirps are sent
+// whole, as GET /api/chirps/{chirpId} would return them; deleted ones as
+// their ID and author.
+func formatEvent(event stream.Event) string {
+	var data any
+	switch event.Type {
+	case stream.ChirpCreated:
+		data = Chirp{
+			ID:        event.Chirp.ID,
+			Body:      event.Chirp.Body,
+			CreatedAt: event.Chirp.CreatedAt,
+			UpdatedAt: event.Chirp.UpdatedAt,
+			UserId:    event.Chirp.UserID,
+		}
+	default:
+		data = struct {
+			ID     uuid.UUID `json:"id"`
+			UserId uuid.UUID `json:"user_id"`
+		}{event.Chirp.ID, event.Chirp.UserID}
+	}
+	body, _ := json.Marshal(data)
+	return fmt.Sprintf("id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, body)
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/database/memory"
+	"github.com/cloudsmyth/chirpy/internal/metrics"
+	"github.com/cloudsmyth/chirpy/internal/stream"
+	"github.com/google/uuid"
+)
+
+func TestStreamHandler(t *testing.T) {
+	cfg := &ApiConfig{
+		Metrics:         metrics.New(nil),
+		Events:          stream.NewHub(10, 4),
+		StreamHeartbeat: 20 * time.Millisecond,
+	}
+	// Timeouts far shorter than the test, which streams must outlive.
+	server := httptest.NewUnstartedServer(http.HandlerFunc(cfg.StreamHandler))
+	server.Config.ReadTimeout = 50 * time.Millisecond
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	alice, bob := uuid.New(), uuid.New()
+	publish := func(id, eventType string, author uuid.UUID) {
+		cfg.Events.Publish(context.Background(), stream.Event{ID: id, Type: eventType, Chirp: database.Chirp{ID: uuid.New(), Body: "hi", UserID: author}})
+	}
+	publish("1", stream.ChirpCreated, alice)
+	publish("2", stream.ChirpCreated, bob)
+
+	// open connects and returns a function reading the next event's lines,
+	// or the next comment.
+	open := func(query, lastEventID string) (func() string, func()) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+query, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", query, err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Content-Type = %q", ct)
+		}
+		lines := bufio.NewScanner(resp.Body)
+		next := func() string {
+			t.Helper()
+			var fields []string
+			for lines.Scan() {
+				line := lines.Text()
+				if line == "" {
+					return strings.Join(fields, " | ")
+				}
+				fields = append(fields, line)
+			}
+			t.Fatalf("Stream ended: %v", lines.Err())
+			return ""
+		}
+		return next, func() { resp.Body.Close() }
+	}
+
+	next, closeAll := open("", "")
+	defer closeAll()
+	if got := next(); got != ": connected" {
+		t.Errorf("Opened with %q", got)
+	}
+
+	byBob, closeBob := open("?author_id="+bob.String(), "")
+	defer closeBob()
+	byBob()
+
+	resumed, closeResumed := open("", "1")
+	defer closeResumed()
+	resumed()
+	if got := resumed(); !strings.HasPrefix(got, "id: 2 | event: chirp.created | data: ") {
+		t.Errorf("Resumed with %q, want event 2", got)
+	}
+
+	gone, closeGone := open("", "missing")
+	defer closeGone()
+	gone()
+	if got := gone(); got != "event: stream.reset | data: {}" {
+		t.Errorf("Resuming from an unknown event got %q, want a reset", got)
+	}
+
+	// Outlive the server timeouts on heartbeats alone.
+	time.Sleep(100 * time.Millisecond)
+	publish("3", stream.ChirpCreated, alice)
+	publish("4", stream.ChirpDeleted, bob)
+
+	var got []string
+	for len(got) < 2 {
+		if event := next(); event != ": heartbeat" {
+			got = append(got, event)
+		}
+	}
+	if !strings.HasPrefix(got[0], "id: 3 | event: chirp.created | data: ") || !strings.Contains(got[0], `"body":"hi"`) {
+		t.Errorf("Received %q, want the created chirp", got[0])
+	}
+	if !strings.HasPrefix(got[1], "id: 4 | event: chirp.deleted | data: ") || strings.Contains(got[1], `"body"`) {
+		t.Errorf("Received %q, want the deleted chirp's ID and author", got[1])
+	}
+	for {
+		if event := byBob(); event != ": heartbeat" {
+			if !strings.HasPrefix(event, "id: 4 ") {
+				t.Errorf("Filtered stream received %q, want only event 4", event)
+			}
+			break
+		}
+	}
+
+	if cfg.Metrics.Value("chirpy_stream_subscribers") != 4 {
+		t.Errorf("Expected 4 subscribers, have %v", cfg.Metrics.Value("chirpy_stream_subscribers"))
+	}
+
+	full, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	full.Body.Close()
+	if full.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Past the subscriber cap: status = %d, want 503", full.StatusCode)
+	}
+
+	resp, err := http.Get(server.URL + "?author_id=nope")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Bad author_id: status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestStreamHandlerFollowing(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	newUser := func(email string) uuid.UUID {
+		t.Helper()
+		user, err := store.CreateUser(ctx, database.CreateUserParams{Email: email, HashedPassword: "x"})
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		return user.ID
+	}
+	alice, bob, carol := newUser("alice@example.com"), newUser("bob@example.com"), newUser("carol@example.com")
+	if err := store.FollowUser(ctx, database.FollowUserParams{FollowerID: alice, FolloweeID: bob}); err != nil {
+		t.Fatalf("FollowUser: %v", err)
+	}
+
+	cfg := &ApiConfig{
+		Metrics:         metrics.New(nil),
+		Store:           store,
+		Events:          stream.NewHub(10, 10),
+		StreamHeartbeat: time.Minute,
+	}
+	for i, author := range []uuid.UUID{alice, bob, carol} {
+		cfg.Events.Publish(ctx, stream.Event{ID: strconv.Itoa(i), Type: stream.ChirpCreated, Chirp: database.Chirp{ID: uuid.New(), UserID: author}})
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		principal uuid.UUID
+		wantCode  int
+		want      []string
+	}{
+		{name: "Followed authors", query: "?following=true", principal: alice, wantCode: http.StatusOK, want: []string{"1"}},
+		{name: "Followed or named authors", query: "?following=true&author_id=" + carol.String(), principal: alice, wantCode: http.StatusOK, want: []string{"1", "2"}},
+		{name: "Following nobody", query: "?following=true", principal: carol, wantCode: http.StatusOK},
+		{name: "Not following", query: "?following=false", principal: carol, wantCode: http.StatusOK, want: []string{"1", "2"}},
+		{name: "Anonymous", query: "?following=true", wantCode: http.StatusUnauthorized},
+		{name: "Not a boolean", query: "?following=maybe", principal: alice, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqCtx := ctx
+			if tt.principal != uuid.Nil {
+				reqCtx = auth.NewContext(ctx, &auth.Principal{UserID: tt.principal})
+			}
+			// A request that has already gone away gets the events it
+			// missed and nothing more.
+			reqCtx, cancel := context.WithCancel(reqCtx)
+			cancel()
+			req := httptest.NewRequestWithContext(reqCtx, http.MethodGet, "/api/stream"+tt.query, nil)
+			req.Header.Set("Last-Event-ID", "0")
+			rec := httptest.NewRecorder()
+			cfg.StreamHandler(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("Status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			var got []string
+			for _, line := range strings.Split(rec.Body.String(), "\n") {
+				if id, ok := strings.CutPrefix(line, "id: "); ok {
+					got = append(got, id)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Received events %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+)
+
+const defaultTokenCleanupBatch = 1000
+
+// PurgeRefreshTokens deletes refresh tokens that have expired or were revoked
+// longer ago than TokenRetention. Rows are removed in batches of
+// TokenCleanupBatch so a large backlog does not hold a long lock on the table.
+func (cfg *ApiConfig) PurgeRefreshTokens(ctx context.Context) (int64, error) {
+	batchSize := cfg.TokenCleanupBatch
+	if batchSize <= 0 {
+		batchSize = defaultTokenCleanupBatch
+	}
+
+	var total int64
+	for {
+		deleted, err := cfg.Store.DeleteStaleRefreshTokens(ctx, database.DeleteStaleRefreshTokensParams{
+			RevokedBefore: time.Now().Add(-cfg.TokenRetention),
+			BatchSize:     batchSize,
+		})
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+		cfg.Metrics.TokensPurged.Add(float64(deleted))
+
+		if deleted < int64(batchSize) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+
+	cfg.Metrics.TokenCleanupRuns.Inc()
+	return total, nil
+}
+
+// RunTokenCleanup purges stale refresh tokens every TokenCleanupInterval until
+// ctx is cancelled. A zero interval disables the task.
+func (cfg *ApiConfig) RunTokenCleanup(ctx context.Context) {
+	if cfg.TokenCleanupInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(cfg.TokenCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := cfg.PurgeRefreshTokens(ctx)
+			if err != nil {
+				slog.Error("Refresh token cleanup failed", "error", err)
+				continue
+			}
+			slog.Info("Purged stale refresh tokens", "count", deleted)
+		}
+	}
+}
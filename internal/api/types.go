@@ -1,19 +1,37 @@
 package api
 
 import (
-	"sync/atomic"
 	"time"
 
 	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/metrics"
+	"github.com/cloudsmyth/chirpy/internal/stream"
 	"github.com/google/uuid"
 )
 
 type ApiConfig struct {
-	FileServerHits atomic.Int32
-	DbQueries      *database.Queries
-	Platform       string
-	Secret         string
-	Polka          string
+	Metrics  *metrics.Metrics
+	Store    database.TxStore
+	Platform string
+	Secret   string
+	Polka    string
+
+	JWTExpiresIn     time.Duration
+	RefreshExpiresIn time.Duration
+
+	TokenCleanupInterval time.Duration
+	TokenRetention       time.Duration
+	TokenCleanupBatch    int32
+
+	// RecentWrites, when set, sends a user's reads to the primary for a
+	// while after they write, so they see their own changes even when the
+	// read replicas lag behind.
+	RecentWrites *database.RecentWriters
+
+	// Events feeds GET /api/stream, whose clients are sent a heartbeat
+	// every StreamHeartbeat so that idle connections stay open.
+	Events          *stream.Hub
+	StreamHeartbeat time.Duration
 }
 
 type Chirp struct {
@@ -32,6 +50,7 @@ type User struct {
 	Token        string    `json:"token"`
 	RefreshToken string    `json:"refresh_token"`
 	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	Role         string    `json:"role"`
 }
 
 type UserResponse struct {
@@ -1,7 +1,8 @@
 package api
 
 import (
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"net/http"
 
 	"github.com/cloudsmyth/chirpy/internal/auth"
@@ -12,42 +13,67 @@ import (
 func (cfg *ApiConfig) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required,email"`
+		Password string `json:"password" validate:"required"`
 	}
 
-	authHeader, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		common.RespondWithError(w, http.StatusUnauthorized, "Unable to get auth token", err)
+	validUserId := auth.MustPrincipal(r.Context()).UserID
+
+	params := parameters{}
+	if !common.DecodeJSON(w, r, &params) {
 		return
 	}
 
-	validUserId, err := auth.ValidateJWT(authHeader, cfg.Secret)
+	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
-		common.RespondWithError(w, http.StatusUnauthorized, "Token not correct", err)
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not hash password", err)
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	if err := decoder.Decode(&params); err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not decode parameters", err)
+	oldUser, err := cfg.Store.GetUserById(r.Context(), validUserId)
+	if errors.Is(err, sql.ErrNoRows) {
+		common.RespondWithProblem(w, r, common.CodeNotFound, "Could not find user", err)
 		return
 	}
-
-	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not hash password", err)
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not get user from db", err)
 		return
 	}
+	samePassword := auth.CheckHashedPassword(oldUser.HashedPassword, params.Password) == nil
 
-	newUser, err := cfg.DbQueries.UpdateUserById(r.Context(), database.UpdateUserByIdParams{
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
-		ID:             validUserId,
+	// A new password signs out every session, and must not be saved without
+	// doing so. The password check is too slow to hold a transaction open
+	// for, so a password that changed in between counts as a new one.
+	var newUser database.User
+	err = cfg.Store.InTx(r.Context(), func(tx database.Store) error {
+		current, err := tx.GetUserById(r.Context(), validUserId)
+		if err != nil {
+			return err
+		}
+		newUser, err = tx.UpdateUserById(r.Context(), database.UpdateUserByIdParams{
+			Email:          params.Email,
+			HashedPassword: hashedPassword,
+			ID:             validUserId,
+		})
+		if err != nil {
+			return err
+		}
+		if samePassword && current.HashedPassword == oldUser.HashedPassword {
+			return nil
+		}
+		_, err = tx.RevokeRefreshTokensByUser(r.Context(), validUserId)
+		return err
 	})
+	if errors.Is(err, sql.ErrNoRows) {
+		common.RespondWithProblem(w, r, common.CodeNotFound, "Could not find user", err)
+		return
+	}
+	if database.IsUniqueViolation(err) {
+		common.RespondWithProblem(w, r, common.CodeEmailTaken, "An account with that email already exists", err)
+		return
+	}
 	if err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not update user", err)
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not update user", err)
 		return
 	}
 
@@ -58,6 +84,7 @@ func (cfg *ApiConfig) UpdateUserHandler(w http.ResponseWriter, r *http.Request)
 			UpdatedAt:   newUser.UpdatedAt,
 			Email:       newUser.Email,
 			IsChirpyRed: newUser.IsChirpyRed,
+			Role:        newUser.Role,
 		},
 	})
 }
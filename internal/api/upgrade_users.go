@@ -1,7 +1,7 @@
 package api
 
 import (
-	"encoding/json"
+	"database/sql"
 	"errors"
 	"net/http"
 
@@ -12,7 +12,7 @@ import (
 )
 
 type webhookRequest struct {
-	Event string `json:"event"`
+	Event string `json:"event" validate:"required"`
 	Data  struct {
 		UserID string `json:"user_id"`
 	} `json:"data"`
@@ -23,19 +23,18 @@ func (cfg *ApiConfig) UpgradeChirpyRedHandler(w http.ResponseWriter, r *http.Req
 
 	apiKey, err := auth.GetApiKey(r.Header)
 	if err != nil {
-		common.RespondWithError(w, http.StatusUnauthorized, "Could not get api key", err)
+		common.RespondWithProblem(w, r, common.CodeUnauthorized, "An API key is required", err)
 		return
 	}
 
 	if apiKey != cfg.Polka {
-		common.RespondWithError(w, http.StatusUnauthorized, "Incorrect API key", errors.New("Incorrect api key"))
+		common.RespondWithProblem(w, r, common.CodeInvalidToken, "Incorrect API key", errors.New("Incorrect api key"))
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := webhookRequest{}
-	if err := decoder.Decode(&params); err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not decode parameters", err)
+	// Polka may add fields to its payloads; we only read the ones we need.
+	if !common.DecodeJSONWith(w, r, &params, common.DecodeOptions{AllowUnknownFields: true}) {
 		return
 	}
 
@@ -46,21 +45,31 @@ func (cfg *ApiConfig) UpgradeChirpyRedHandler(w http.ResponseWriter, r *http.Req
 
 	userUUID, err := uuid.Parse(params.Data.UserID)
 	if err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not parse UUID", err)
+		common.RespondWithFieldErrors(w, r, []common.FieldError{
+			{Field: "data.user_id", Code: "invalid", Detail: "Must be a UUID"},
+		})
 		return
 	}
 
-	user, err := cfg.DbQueries.UpgradeUserById(r.Context(), database.UpgradeUserByIdParams{
-		IsChirpyRed: true,
-		ID:          userUUID,
+	// Polka retries deliveries, so an upgrade that already happened is left
+	// alone rather than bumping updated_at again.
+	err = cfg.Store.InTx(r.Context(), func(tx database.Store) error {
+		user, err := tx.GetUserById(r.Context(), userUUID)
+		if err != nil || user.IsChirpyRed {
+			return err
+		}
+		_, err = tx.UpgradeUserById(r.Context(), database.UpgradeUserByIdParams{
+			IsChirpyRed: true,
+			ID:          userUUID,
+		})
+		return err
 	})
-	if err != nil {
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not update user", err)
+	if errors.Is(err, sql.ErrNoRows) {
+		common.RespondWithProblem(w, r, common.CodeNotFound, "Could not find user", err)
 		return
 	}
-
-	if user.ID == uuid.Nil {
-		common.RespondWithError(w, http.StatusNotFound, "Could not find user", err)
+	if err != nil {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not update user", err)
 		return
 	}
 
@@ -3,6 +3,7 @@ package auth
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -31,18 +32,25 @@ func MakeRefreshToken() string {
 	return hexString
 }
 
+var (
+	ErrNoAuthHeader        = errors.New("No auth token")
+	ErrMalformedAuthHeader = errors.New("Malformed authorization header")
+)
+
+// GetBearerToken returns ErrNoAuthHeader when the request carries no
+// credentials and ErrMalformedAuthHeader when they are not a bearer token.
 func GetBearerToken(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
-		return "", fmt.Errorf("No auth token")
+		return "", ErrNoAuthHeader
 	}
 
-	splitAuth := strings.Split(authHeader, " ")
-	if len(splitAuth) < 2 || splitAuth[0] != "Bearer" {
-		return "", fmt.Errorf("Malformed authorization header")
+	scheme, token, ok := strings.Cut(authHeader, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" || strings.Contains(token, " ") {
+		return "", ErrMalformedAuthHeader
 	}
 
-	return splitAuth[1], nil
+	return token, nil
 }
 
 func HashPassword(password string) (string, error) {
@@ -57,3 +57,19 @@ func TestCheckPasswordHash(t *testing.T) {
 		})
 	}
 }
+
+func TestPersonalAccessToken(t *testing.T) {
+	token := MakePersonalAccessToken()
+	if !IsPersonalAccessToken(token) {
+		t.Errorf("IsPersonalAccessToken(%q) = false, want true", token)
+	}
+	if IsPersonalAccessToken(MakeRefreshToken()) {
+		t.Error("refresh token mistaken for a personal access token")
+	}
+	if HashToken(token) != HashToken(token) {
+		t.Error("HashToken is not deterministic")
+	}
+	if HashToken(token) == HashToken(MakePersonalAccessToken()) {
+		t.Error("distinct tokens share a hash")
+	}
+}
@@ -1,21 +1,63 @@
 package auth
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
+type Claims struct {
+	Role      string `json:"role,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	// Scope and ClientID are only set on tokens issued to OAuth clients.
+	// Scope is space separated as in RFC 9068.
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// SessionID derives a stable, non-secret identifier for the login session
+// behind refreshToken, so access tokens can name their session without
+// carrying the refresh token itself.
+func SessionID(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:8])
+}
+
+func MakeJWT(userID uuid.UUID, role, sessionID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return signJWT(Claims{
+		Role:      role,
+		SessionID: sessionID,
+	}, userID, tokenSecret, expiresIn)
+}
+
+// MakeScopedJWT issues an access token to an OAuth client. The token is only
+// good for scopes and is otherwise validated exactly like a session token.
+func MakeScopedJWT(userID uuid.UUID, role, grantID, clientID string, scopes []string, tokenSecret string, expiresIn time.Duration) (string, error) {
+	if len(scopes) == 0 {
+		return "", fmt.Errorf("scoped token needs at least one scope")
+	}
+	return signJWT(Claims{
+		Role:      role,
+		SessionID: grantID,
+		Scope:     strings.Join(scopes, " "),
+		ClientID:  clientID,
+	}, userID, tokenSecret, expiresIn)
+}
+
+func signJWT(claims Claims, userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
 	if tokenSecret == "" {
 		return "", fmt.Errorf("token secret cannot be empty")
 	}
-	claims := jwt.RegisteredClaims{
+	claims.RegisteredClaims = jwt.RegisteredClaims{
 		Issuer:    "chirpy",
 		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(time.Duration(1) * time.Hour)),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
 		Subject:   userID.String(),
 	}
 
@@ -29,23 +71,54 @@ func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
 	return ss, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
+// ParseJWT validates tokenString and returns its claims. Tokens issued before
+// roles existed carry no role claim and are treated as RoleUser.
+func ParseJWT(tokenString, tokenSecret string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(tokenSecret), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
 
-	id, err := token.Claims.GetSubject()
+	if claims.Role == "" {
+		claims.Role = RoleUser
+	}
+	return claims, nil
+}
+
+// Principal returns the caller described by the claims.
+func (c *Claims) Principal() (*Principal, error) {
+	userID, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return nil, err
+	}
+	principal := &Principal{
+		UserID:    userID,
+		Role:      c.Role,
+		SessionID: c.SessionID,
+		ClientID:  c.ClientID,
+	}
+	if c.ClientID != "" {
+		principal.Scopes = strings.Fields(c.Scope)
+		if principal.Scopes == nil {
+			principal.Scopes = []string{}
+		}
+	}
+	return principal, nil
+}
+
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	claims, err := ParseJWT(tokenString, tokenSecret)
 	if err != nil {
 		return uuid.Nil, err
 	}
 
-	uuID, err := uuid.Parse(id)
+	principal, err := claims.Principal()
 	if err != nil {
 		return uuid.Nil, err
 	}
 
-	return uuID, nil
+	return principal.UserID, nil
 }
@@ -16,7 +16,7 @@ func TestMakeJWT(t *testing.T) {
 
 	// Test successful JWT creation
 	t.Run("Success", func(t *testing.T) {
-		token, err := MakeJWT(userID, tokenSecret, expiresIn)
+		token, err := MakeJWT(userID, RoleUser, "", tokenSecret, expiresIn)
 
 		// Assert no errors
 		if err != nil {
@@ -61,7 +61,7 @@ func TestMakeJWT(t *testing.T) {
 
 	// Test with empty secret
 	t.Run("EmptySecret", func(t *testing.T) {
-		token, err := MakeJWT(userID, "", expiresIn)
+		token, err := MakeJWT(userID, RoleUser, "", "", expiresIn)
 		if err == nil {
 			t.Error("Expected an error with empty secret, got none")
 		}
@@ -80,7 +80,7 @@ func TestValidateJWT(t *testing.T) {
 	// Test successful validation
 	t.Run("Success", func(t *testing.T) {
 		// Create a token first
-		token, err := MakeJWT(userID, tokenSecret, expiresIn)
+		token, err := MakeJWT(userID, RoleUser, "", tokenSecret, expiresIn)
 		if err != nil {
 			t.Fatalf("Failed to create test token: %v", err)
 		}
@@ -99,7 +99,7 @@ func TestValidateJWT(t *testing.T) {
 
 	// Test with wrong secret
 	t.Run("WrongSecret", func(t *testing.T) {
-		token, err := MakeJWT(userID, tokenSecret, expiresIn)
+		token, err := MakeJWT(userID, RoleUser, "", tokenSecret, expiresIn)
 		if err != nil {
 			t.Fatalf("Failed to create test token: %v", err)
 		}
@@ -116,7 +116,7 @@ func TestValidateJWT(t *testing.T) {
 	// Test with expired token
 	t.Run("ExpiredToken", func(t *testing.T) {
 		// Create a token that expires immediately
-		token, err := MakeJWT(userID, tokenSecret, -1*time.Hour)
+		token, err := MakeJWT(userID, RoleUser, "", tokenSecret, -1*time.Hour)
 		if err != nil {
 			t.Fatalf("Failed to create test token: %v", err)
 		}
@@ -166,3 +166,112 @@ func TestValidateJWT(t *testing.T) {
 		}
 	})
 }
+
+func TestParseJWTRole(t *testing.T) {
+	userID := uuid.New()
+	tokenSecret := "test-secret"
+
+	t.Run("RoleClaim", func(t *testing.T) {
+		token, err := MakeJWT(userID, RoleModerator, "", tokenSecret, time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to create test token: %v", err)
+		}
+
+		claims, err := ParseJWT(token, tokenSecret)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if claims.Role != RoleModerator {
+			t.Errorf("Expected role %q, got %q", RoleModerator, claims.Role)
+		}
+	})
+
+	t.Run("MissingRoleDefaultsToUser", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			Subject:   userID.String(),
+		})
+		tokenString, err := token.SignedString([]byte(tokenSecret))
+		if err != nil {
+			t.Fatalf("Failed to create test token: %v", err)
+		}
+
+		claims, err := ParseJWT(tokenString, tokenSecret)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if claims.Role != RoleUser {
+			t.Errorf("Expected role %q, got %q", RoleUser, claims.Role)
+		}
+	})
+
+	t.Run("RejectsOtherSigningMethods", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS512, Claims{
+			Role: RoleAdmin,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+				Subject:   userID.String(),
+			},
+		})
+		tokenString, err := token.SignedString([]byte(tokenSecret))
+		if err != nil {
+			t.Fatalf("Failed to create test token: %v", err)
+		}
+
+		if _, err := ParseJWT(tokenString, tokenSecret); err == nil {
+			t.Error("Expected an error for an HS512 token, got none")
+		}
+	})
+}
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		role string
+		want string
+		ok   bool
+	}{
+		{role: RoleAdmin, want: RoleModerator, ok: true},
+		{role: RoleModerator, want: RoleModerator, ok: true},
+		{role: RoleUser, want: RoleModerator, ok: false},
+		{role: "root", want: RoleUser, ok: false},
+	}
+
+	for _, tt := range tests {
+		if got := HasRole(tt.role, tt.want); got != tt.ok {
+			t.Errorf("HasRole(%q, %q) = %v, want %v", tt.role, tt.want, got, tt.ok)
+		}
+	}
+}
+
+func TestMakeScopedJWT(t *testing.T) {
+	userID := uuid.New()
+	tokenSecret := "test-secret"
+
+	token, err := MakeScopedJWT(userID, RoleUser, "grant", "client", []string{ScopeChirpsRead, ScopeChirpsWrite}, tokenSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create test token: %v", err)
+	}
+
+	claims, err := ParseJWT(token, tokenSecret)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	principal, err := claims.Principal()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if principal.IsSession() {
+		t.Error("Expected scoped token not to count as a login session")
+	}
+	if !principal.HasScope(ScopeChirpsWrite) || principal.HasScope(ScopeProfileWrite) {
+		t.Errorf("Unexpected scopes %q", principal.Scopes)
+	}
+	if principal.ClientID != "client" || principal.SessionID != "grant" {
+		t.Errorf("Expected client %q and grant %q, got %q and %q", "client", "grant", principal.ClientID, principal.SessionID)
+	}
+
+	if _, err := MakeScopedJWT(userID, RoleUser, "grant", "client", nil, tokenSecret, time.Hour); err == nil {
+		t.Error("Expected an error for a token without scopes, got none")
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID uuid.UUID
+	Role   string
+	// Scopes limits what the credential may do. A nil slice means the
+	// credential is an interactive session and is not limited by scope.
+	Scopes []string
+	// SessionID identifies the login session, personal access token or
+	// OAuth grant the credential belongs to.
+	SessionID string
+	// ClientID is the OAuth client acting for the user, if any.
+	ClientID string
+}
+
+// HasRole reports whether the principal may act as want.
+func (p *Principal) HasRole(want string) bool {
+	return HasRole(p.Role, want)
+}
+
+// IsSession reports whether the principal logged in with a password rather
+// than presenting a personal access token or OAuth access token.
+func (p *Principal) IsSession() bool {
+	return p.Scopes == nil
+}
+
+// HasScope reports whether the principal's credential grants scope.
+func (p *Principal) HasScope(scope string) bool {
+	return p.Scopes == nil || slices.Contains(p.Scopes, scope)
+}
+
+type principalKey struct{}
+
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored by the auth middleware,
+// if the request was authenticated.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// MustPrincipal is for handlers mounted behind RequireAuth; reaching it
+// without a principal is a routing bug.
+func MustPrincipal(ctx context.Context) *Principal {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		panic("auth: handler requires an authenticated principal")
+	}
+	return p
+}
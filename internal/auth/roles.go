@@ -0,0 +1,25 @@
+package auth
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// roleRank orders roles so that each one includes the permissions of the
+// roles below it.
+var roleRank = map[string]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// HasRole reports whether a user holding role may act as want.
+func HasRole(role, want string) bool {
+	return ValidRole(role) && roleRank[role] >= roleRank[want]
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+var validScopes = map[string]bool{
+	ScopeChirpsRead:   true,
+	ScopeChirpsWrite:  true,
+	ScopeProfileWrite: true,
+}
+
+func ValidScope(scope string) bool {
+	return validScopes[scope]
+}
+
+// PersonalAccessTokenPrefix marks personal access tokens so the auth layer
+// can tell them apart from JWTs without trying to parse them, and so leaked
+// tokens are easy to spot in logs and secret scanners.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+func MakePersonalAccessToken() string {
+	return PersonalAccessTokenPrefix + MakeRefreshToken()
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// HashToken hashes a high-entropy token for storage. Unlike passwords these
+// tokens are random, so a fast hash is enough and keeps lookups indexable.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,221 @@
+// Package cache keeps hot chirp reads out of the database. Store sits in
+// front of a database.TxStore, serving GetChirpById and GetChirpsByAuthor
+// from a Cache and dropping the affected entries whenever chirps are
+// created or deleted through it. Concurrent misses on the same key share a
+// single query.
+//
+// Writes made by other processes, such as the admin commands, are not seen,
+// so entries may be stale for up to the TTL.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/metrics"
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache stores encoded values under string keys. LRU keeps them in process
+// memory; an implementation backed by a shared cache server lets several
+// instances share entries. Store treats errors from Get and Set as misses.
+type Cache interface {
+	// Get returns the value stored under key, or false if there is none or
+	// it has expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	// Clear deletes every entry.
+	Clear(ctx context.Context) error
+}
+
+// Store caches chirp reads for TTL. Reads whose context came through
+// database.WithPrimary skip the cache, since their caller has just written
+// and must see the result, but still refresh it.
+//
+// Misses load through the wrapped store, so they may be served by a read
+// replica. For replicaLag after a write, a replica may not have caught up
+// and could put back, for a whole TTL, what the write's invalidation
+// removed, so only loads from the primary fill the entries it touched.
+type Store struct {
+	database.TxStore
+
+	cache      Cache
+	ttl        time.Duration
+	replicaLag time.Duration
+	metrics    *metrics.Metrics
+
+	loads singleflight.Group
+	// generation counts invalidations. A load only fills the cache if none
+	// happened while it ran, so it cannot put back what a write removed.
+	// mu keeps an invalidation from landing between that check and the
+	// fill, and guards written and cleared.
+	generation atomic.Uint64
+	mu         sync.RWMutex
+	// written holds when each key was last invalidated, for keys
+	// invalidated within replicaLag; cleared is when Reset last ran.
+	written map[string]time.Time
+	cleared time.Time
+	swept   time.Time
+}
+
+var _ database.TxStore = (*Store)(nil)
+
+// NewStore caches the chirp reads of store in c, dropping entries once the
+// chirp writes made through it commit. replicaLag is how far store's read
+// replicas may fall behind, and zero if it has none. m may be nil.
+func NewStore(store database.TxStore, c Cache, ttl, replicaLag time.Duration, m *metrics.Metrics) *Store {
+	s := &Store{cache: c, ttl: ttl, replicaLag: replicaLag, metrics: m, written: map[string]time.Time{}}
+	s.TxStore = database.NewHookStore(store, s.invalidate)
+	return s
+}
+
+func chirpKey(id uuid.UUID) string {
+	return "chirp:" + id.String()
+}
+
+func authorKey(userID uuid.UUID) string {
+	return "chirps:author:" + userID.String()
+}
+
+func (s *Store) GetChirpById(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	return cached(ctx, s, "chirp", chirpKey(id), func(ctx context.Context) (database.Chirp, error) {
+		return s.TxStore.GetChirpById(ctx, id)
+	})
+}
+
+func (s *Store) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	return cached(ctx, s, "chirps_by_author", authorKey(userID), func(ctx context.Context) ([]database.Chirp, error) {
+		return s.TxStore.GetChirpsByAuthor(ctx, userID)
+	})
+}
+
+// cached returns the value under key, loading it with load on a miss.
+// Callers missing on the same key at once wait for a single load, which
+// runs without their cancellation so that one caller giving up does not
+// fail the others.
+func cached[T any](ctx context.Context, s *Store, query, key string, load func(context.Context) (T, error)) (T, error) {
+	if database.UsesPrimary(ctx) {
+		s.record(query, "bypass")
+		return loadAndFill(ctx, s, key, load)
+	}
+
+	if data, ok, err := s.cache.Get(ctx, key); err != nil {
+		slog.Warn("Chirp cache read failed", "key", key, "error", err)
+	} else if ok {
+		var value T
+		if err := json.Unmarshal(data, &value); err == nil {
+			s.record(query, "hit")
+			return value, nil
+		}
+	}
+	s.record(query, "miss")
+
+	result := s.loads.DoChan(key, func() (any, error) {
+		return loadAndFill(context.WithoutCancel(ctx), s, key, load)
+	})
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case r := <-result:
+		value, _ := r.Val.(T)
+		return value, r.Err
+	}
+}
+
+// loadAndFill runs load and caches its result, unless the result may be
+// stale.
+func loadAndFill[T any](ctx context.Context, s *Store, key string, load func(context.Context) (T, error)) (T, error) {
+	generation := s.generation.Load()
+	value, err := load(ctx)
+	if err != nil {
+		return value, err
+	}
+
+	data, err := json.Marshal(value)
+	if err == nil {
+		s.mu.RLock()
+		if s.generation.Load() == generation && (database.UsesPrimary(ctx) || !s.recentlyWritten(key)) {
+			err = s.cache.Set(ctx, key, data, s.ttl)
+		}
+		s.mu.RUnlock()
+	}
+	if err != nil {
+		slog.Warn("Chirp cache write failed", "key", key, "error", err)
+	}
+	return value, nil
+}
+
+// recentlyWritten reports whether key was invalidated recently enough that
+// a replica may not have caught up. s.mu must be held.
+func (s *Store) recentlyWritten(key string) bool {
+	if s.replicaLag <= 0 {
+		return false
+	}
+	written, ok := s.written[key]
+	return time.Since(s.cleared) < s.replicaLag || (ok && time.Since(written) < s.replicaLag)
+}
+
+func (s *Store) record(query, result string) {
+	if s.metrics != nil {
+		s.metrics.ChirpCacheRequests.WithLabelValues(query, result).Inc()
+	}
+}
+
+func (s *Store) Reset(ctx context.Context) error {
+	err := s.TxStore.Reset(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation.Add(1)
+	s.cleared = time.Now()
+	if clearErr := s.cache.Clear(ctx); clearErr != nil {
+		slog.Warn("Chirp cache clear failed", "error", clearErr)
+	}
+	return err
+}
+
+// invalidate drops the entries made stale by committed writes.
+func (s *Store) invalidate(ctx context.Context, writes []database.ChirpWrite) {
+	var stale []string
+	for _, w := range writes {
+		if w.Deleted {
+			stale = append(stale, chirpKey(w.Chirp.ID))
+		}
+		if w.Chirp.UserID != uuid.Nil {
+			stale = append(stale, authorKey(w.Chirp.UserID))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generation.Add(1)
+	now := time.Now()
+	for _, key := range stale {
+		s.loads.Forget(key)
+		if s.replicaLag > 0 {
+			s.written[key] = now
+		}
+	}
+	// Drop expired entries once per lag so that written stays bounded by
+	// the keys invalidated within about two lags.
+	if now.Sub(s.swept) >= s.replicaLag {
+		for key, at := range s.written {
+			if now.Sub(at) >= s.replicaLag {
+				delete(s.written, key)
+			}
+		}
+		s.swept = now
+	}
+	if err := s.cache.Delete(ctx, stale...); err != nil {
+		slog.Warn("Chirp cache invalidation failed", "keys", stale, "error", err)
+	}
+}
@@ -0,0 +1,274 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/database/memory"
+	"github.com/cloudsmyth/chirpy/internal/metrics"
+	"github.com/google/uuid"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewLRU(2)
+	c.now = func() time.Time { return now }
+
+	c.Set(ctx, "a", []byte("1"), time.Minute)
+	c.Set(ctx, "b", []byte("2"), time.Minute)
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", []byte("3"), time.Minute)
+
+	tests := []struct {
+		name   string
+		key    string
+		wantOK bool
+		want   string
+	}{
+		{name: "Recently used", key: "a", wantOK: true, want: "1"},
+		{name: "Evicted", key: "b"},
+		{name: "Newest", key: "c", wantOK: true, want: "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok, err := c.Get(ctx, tt.key)
+			if err != nil || ok != tt.wantOK || string(value) != tt.want {
+				t.Errorf("Get(%q) = %q, %v, %v, want %q, %v", tt.key, value, ok, err, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Error("Expected an entry past its TTL to be gone")
+	}
+	if c.Len() != 1 {
+		t.Errorf("Expected the expired entry to be evicted, have %d entries", c.Len())
+	}
+
+	c.Clear(ctx)
+	if c.Len() != 0 {
+		t.Errorf("Expected Clear to empty the cache, have %d entries", c.Len())
+	}
+}
+
+// countingStore counts chirp reads and holds them until release is closed.
+type countingStore struct {
+	database.TxStore
+	reads   atomic.Int64
+	release chan struct{}
+}
+
+func (s *countingStore) GetChirpById(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	s.reads.Add(1)
+	if s.release != nil {
+		<-s.release
+	}
+	return s.TxStore.GetChirpById(ctx, id)
+}
+
+func (s *countingStore) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	s.reads.Add(1)
+	return s.TxStore.GetChirpsByAuthor(ctx, userID)
+}
+
+func newTestStore(t *testing.T) (*Store, *countingStore, *metrics.Metrics, database.User) {
+	t.Helper()
+	db := &countingStore{TxStore: memory.New()}
+	m := metrics.New(nil)
+	user, err := db.CreateUser(context.Background(), database.CreateUserParams{Email: "alice@example.com", HashedPassword: "x"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return NewStore(db, NewLRU(100), time.Minute, 0, m), db, m, user
+}
+
+func TestStoreCachesReads(t *testing.T) {
+	ctx := context.Background()
+	s, db, m, user := newTestStore(t)
+	chirp, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", UserID: user.ID})
+	if err != nil {
+		t.Fatalf("CreateChirp: %v", err)
+	}
+
+	for range 3 {
+		got, err := s.GetChirpById(ctx, chirp.ID)
+		if err != nil || got.ID != chirp.ID || got.Body != "hello" {
+			t.Fatalf("GetChirpById() = %v, %v", got, err)
+		}
+	}
+	if reads := db.reads.Load(); reads != 1 {
+		t.Errorf("Expected 1 database read, got %d", reads)
+	}
+	if hits := m.Value("chirpy_chirp_cache_requests_total", "query", "chirp", "result", "hit"); hits != 2 {
+		t.Errorf("Expected 2 hits, got %v", hits)
+	}
+	if misses := m.Value("chirpy_chirp_cache_requests_total", "query", "chirp", "result", "miss"); misses != 1 {
+		t.Errorf("Expected 1 miss, got %v", misses)
+	}
+
+	if _, err := s.GetChirpById(database.WithPrimary(ctx), chirp.ID); err != nil {
+		t.Fatalf("GetChirpById: %v", err)
+	}
+	if reads := db.reads.Load(); reads != 2 {
+		t.Errorf("Expected a primary read to skip the cache, got %d database reads", reads)
+	}
+}
+
+func TestStoreReplicaFills(t *testing.T) {
+	ctx := context.Background()
+	primary := memory.New()
+	lagging := &countingStore{TxStore: memory.New()}
+	db := database.NewReplicaStore(primary, database.Replica{
+		Name:  "lagging",
+		Store: lagging,
+		Ping:  func(context.Context) error { return nil },
+	})
+	s := NewStore(db, NewLRU(100), time.Minute, time.Hour, nil)
+
+	// Misses on keys nobody wrote to are served by the replica, which fills
+	// the cache.
+	bob := uuid.New()
+	for range 2 {
+		if _, err := s.GetChirpsByAuthor(ctx, bob); err != nil {
+			t.Fatalf("GetChirpsByAuthor: %v", err)
+		}
+	}
+	if reads := lagging.reads.Load(); reads != 1 {
+		t.Errorf("Expected a miss to be read from the replica and then cached, got %d replica reads", reads)
+	}
+
+	user, err := primary.CreateUser(ctx, database.CreateUserParams{Email: "alice@example.com", HashedPassword: "x"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", UserID: user.ID}); err != nil {
+		t.Fatalf("CreateChirp: %v", err)
+	}
+
+	// The replica has not seen the chirp yet, and must not fill the cache.
+	lagging.reads.Store(0)
+	for range 2 {
+		if _, err := s.GetChirpsByAuthor(ctx, user.ID); err != nil {
+			t.Fatalf("GetChirpsByAuthor: %v", err)
+		}
+	}
+	if reads := lagging.reads.Load(); reads != 2 {
+		t.Errorf("Expected reads after a write to skip filling the cache, got %d replica reads", reads)
+	}
+
+	// The primary has, and may.
+	if chirps, err := s.GetChirpsByAuthor(database.WithPrimary(ctx), user.ID); err != nil || len(chirps) != 1 {
+		t.Fatalf("GetChirpsByAuthor() = %v, %v, want the new chirp", chirps, err)
+	}
+	if chirps, err := s.GetChirpsByAuthor(ctx, user.ID); err != nil || len(chirps) != 1 {
+		t.Errorf("GetChirpsByAuthor() = %v, %v, want the new chirp from the cache", chirps, err)
+	}
+}
+
+func TestStoreInvalidation(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		write func(s *Store, chirp database.Chirp) error
+	}{
+		{
+			name: "Create",
+			write: func(s *Store, chirp database.Chirp) error {
+				_, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "again", UserID: chirp.UserID})
+				return err
+			},
+		},
+		{
+			name: "Delete by author",
+			write: func(s *Store, chirp database.Chirp) error {
+				return s.DeleteChirpById(ctx, database.DeleteChirpByIdParams{ID: chirp.ID, UserID: chirp.UserID})
+			},
+		},
+		{
+			name: "Delete by moderator",
+			write: func(s *Store, chirp database.Chirp) error {
+				_, err := s.DeleteChirp(ctx, chirp.ID)
+				return err
+			},
+		},
+		{
+			name: "Delete in transaction",
+			write: func(s *Store, chirp database.Chirp) error {
+				return s.InTx(ctx, func(tx database.Store) error {
+					_, err := tx.DeleteChirp(ctx, chirp.ID)
+					return err
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, _, user := newTestStore(t)
+			chirp, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", UserID: user.ID})
+			if err != nil {
+				t.Fatalf("CreateChirp: %v", err)
+			}
+			// Fill the cache.
+			s.GetChirpById(ctx, chirp.ID)
+			s.GetChirpsByAuthor(ctx, user.ID)
+
+			if err := tt.write(s, chirp); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+
+			fromCache, err := s.GetChirpsByAuthor(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("GetChirpsByAuthor: %v", err)
+			}
+			fromDB, err := s.TxStore.GetChirpsByAuthor(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("GetChirpsByAuthor: %v", err)
+			}
+			if len(fromCache) != len(fromDB) {
+				t.Errorf("Cached listing has %d chirps, database has %d", len(fromCache), len(fromDB))
+			}
+		})
+	}
+}
+
+func TestStoreCoalescesMisses(t *testing.T) {
+	ctx := context.Background()
+	s, db, m, user := newTestStore(t)
+	chirp, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", UserID: user.ID})
+	if err != nil {
+		t.Fatalf("CreateChirp: %v", err)
+	}
+	db.release = make(chan struct{})
+
+	const callers = 10
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.GetChirpById(ctx, chirp.ID); err != nil {
+				t.Errorf("GetChirpById: %v", err)
+			}
+		}()
+	}
+
+	// Let every caller miss and join the load before it finishes.
+	for m.Value("chirpy_chirp_cache_requests_total", "result", "miss") < callers {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(db.release)
+	wg.Wait()
+
+	if reads := db.reads.Load(); reads != 1 {
+		t.Errorf("Expected %d concurrent misses to share 1 database read, got %d", callers, reads)
+	}
+}
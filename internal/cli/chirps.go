@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+)
+
+func chirpsCommand(ctx context.Context, args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "delete" {
+		return fmt.Errorf("%w: chirps needs the delete subcommand", errUsage)
+	}
+
+	fs, _ := newFlagSet("chirps delete", false)
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: chirps delete takes exactly one chirp id", errUsage)
+	}
+	chirpID, err := uuid.Parse(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("%w: invalid chirp id %q", errUsage, fs.Arg(0))
+	}
+
+	e, err := openEnv()
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	deleted, err := e.queries.DeleteChirp(ctx, chirpID)
+	if err != nil {
+		return fmt.Errorf("deleting chirp: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("chirp %s not found", chirpID)
+	}
+	fmt.Fprintf(stdout, "Deleted chirp %s\n", chirpID)
+	return nil
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/cloudsmyth/chirpy/internal/config"
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/database/sqlite"
+	"github.com/cloudsmyth/chirpy/internal/logging"
+)
+
+const usage = `Usage: chirpy <command> [arguments]
+
+Commands:
+  serve                            Run the HTTP server (the default)
+  migrate up|down|status|redo      Manage the database schema
+  users list                       List every user
+  users show <id|email>            Show one user
+  users disable <id|email>         Disable a user and revoke their refresh tokens
+  users grant-red <id|email>       Upgrade a user to Chirpy Red
+  users set-role <id|email> <role> Make a user a user, moderator or admin
+  tokens revoke <token>            Revoke one refresh token
+  tokens revoke -user <id|email>   Revoke every refresh token a user holds
+  tokens cleanup                   Purge expired and revoked refresh tokens
+  chirps delete <id>               Delete a chirp
+  seed                             Insert demo users and chirps (PLATFORM=dev only)
+
+Commands that print records accept -o table (the default) or -o json.
+`
+
+var errUsage = errors.New("invalid usage")
+
+// Run executes the command named by args[0], writing results to stdout.
+func Run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		return serve(ctx, nil)
+	}
+
+	var err error
+	switch args[0] {
+	case "serve":
+		err = serve(ctx, args[1:])
+	case "migrate":
+		err = migrateCommand(ctx, args[1:], stdout)
+	case "users":
+		err = usersCommand(ctx, args[1:], stdout)
+	case "tokens":
+		err = tokensCommand(ctx, args[1:], stdout)
+	case "chirps":
+		err = chirpsCommand(ctx, args[1:], stdout)
+	case "seed":
+		err = seedCommand(ctx, args[1:], stdout)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		err = fmt.Errorf("%w: unknown command %q", errUsage, args[0])
+	}
+
+	if errors.Is(err, errUsage) {
+		fmt.Fprint(stderr, usage)
+	}
+	return err
+}
+
+// env is what every admin command needs: configuration and a database.
+type env struct {
+	cfg     *config.Config
+	db      *sql.DB
+	backend string
+	queries backendStore
+}
+
+func openEnv() (*env, error) {
+	cfg, err := config.LoadCommand()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+
+	db, backend, err := database.Open(cfg.DBURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	return &env{cfg: cfg, db: db, backend: backend, queries: newStore(backend, db, nil)}, nil
+}
+
+// backendStore is everything the server asks of a storage backend.
+type backendStore interface {
+	database.TxStore
+	database.OAuthStore
+}
+
+// newStore returns the queries for backend, which database.Open reported.
+// wrap, if not nil, wraps every connection and transaction they run on.
+func newStore(backend string, db *sql.DB, wrap func(database.DBTX) database.DBTX) backendStore {
+	if backend == database.BackendSQLite {
+		return sqlite.NewStore(db, wrap)
+	}
+	return database.NewDB(db, wrap)
+}
+
+func (e *env) Close() error {
+	return e.db.Close()
+}
+
+// newFlagSet returns a flag set that reports errors instead of exiting and,
+// when withOutput is set, registers the shared -o flag.
+func newFlagSet(name string, withOutput bool) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if !withOutput {
+		return fs, nil
+	}
+	return fs, fs.String("o", "table", "output format: table or json")
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s: %v", errUsage, fs.Name(), err)
+	}
+	if o := fs.Lookup("o"); o != nil && o.Value.String() != "table" && o.Value.String() != "json" {
+		return fmt.Errorf("%w: unknown output format %q", errUsage, o.Value.String())
+	}
+	return nil
+}
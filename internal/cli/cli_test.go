@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestRunUsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "Unknown command", args: []string{"frobnicate"}},
+		{name: "Users without subcommand", args: []string{"users"}},
+		{name: "Unknown users subcommand", args: []string{"users", "promote", "a@b.c"}},
+		{name: "Show without user", args: []string{"users", "show"}},
+		{name: "Bad output format", args: []string{"users", "list", "-o", "xml"}},
+		{name: "Revoke with token and user", args: []string{"tokens", "revoke", "-user", "a@b.c", "abc"}},
+		{name: "Delete with bad chirp id", args: []string{"chirps", "delete", "not-a-uuid"}},
+		{name: "Migrate without direction", args: []string{"migrate"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			err := Run(context.Background(), tt.args, io.Discard, &stderr)
+			if !errors.Is(err, errUsage) {
+				t.Errorf("Expected a usage error, got %v", err)
+			}
+			if !strings.HasPrefix(stderr.String(), "Usage: chirpy") {
+				t.Errorf("Expected usage on stderr, got %q", stderr.String())
+			}
+		})
+	}
+}
+
+func TestPrintUsers(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	users := []database.User{
+		{ID: uuid.New(), Email: "active@example.com", CreatedAt: now, UpdatedAt: now, IsChirpyRed: true},
+		{ID: uuid.New(), Email: "gone@example.com", CreatedAt: now, UpdatedAt: now, DisabledAt: sql.NullTime{Time: now, Valid: true}},
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := printUsers(&out, "json", users); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		var records []map[string]any
+		if err := json.Unmarshal(out.Bytes(), &records); err != nil {
+			t.Fatalf("Expected a JSON array, got %q", out.String())
+		}
+		if len(records) != 2 {
+			t.Fatalf("Expected 2 records, got %d", len(records))
+		}
+		if _, ok := records[0]["hashed_password"]; ok {
+			t.Error("Expected password hash to be omitted")
+		}
+		if records[0]["disabled_at"] != nil || records[1]["disabled_at"] == nil {
+			t.Errorf("Expected disabled_at only on the disabled user, got %v", records)
+		}
+	})
+
+	t.Run("Table", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := printUsers(&out, "table", users); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("Expected header and 2 rows, got %q", out.String())
+		}
+		if !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[2], "gone@example.com") {
+			t.Errorf("Unexpected table output %q", out.String())
+		}
+	})
+}
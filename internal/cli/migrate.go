@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/cloudsmyth/chirpy/internal/migrate"
+)
+
+func migrateCommand(ctx context.Context, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: migrate takes exactly one of up, down, status or redo", errUsage)
+	}
+
+	e, err := openEnv()
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	migrations, err := migrate.NewProvider(e.db, e.backend)
+	if err != nil {
+		return fmt.Errorf("loading migrations: %w", err)
+	}
+	return migrate.Run(ctx, migrations, args[0], stdout)
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type userRecord struct {
+	ID          uuid.UUID  `json:"id"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	IsChirpyRed bool       `json:"is_chirpy_red"`
+	Role        string     `json:"role"`
+	DisabledAt  *time.Time `json:"disabled_at"`
+}
+
+func newUserRecord(user database.User) userRecord {
+	record := userRecord{
+		ID:          user.ID,
+		Email:       user.Email,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		IsChirpyRed: user.IsChirpyRed,
+		Role:        user.Role,
+	}
+	if user.DisabledAt.Valid {
+		record.DisabledAt = &user.DisabledAt.Time
+	}
+	return record
+}
+
+// printUsers writes users as an aligned table or a JSON array.
+func printUsers(w io.Writer, format string, users []database.User) error {
+	records := make([]userRecord, 0, len(users))
+	rows := make([][]string, 0, len(users))
+	for _, user := range users {
+		record := newUserRecord(user)
+		records = append(records, record)
+
+		disabled := "-"
+		if record.DisabledAt != nil {
+			disabled = record.DisabledAt.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{
+			record.ID.String(),
+			record.Email,
+			record.CreatedAt.Format(time.RFC3339),
+			record.Role,
+			fmt.Sprint(record.IsChirpyRed),
+			disabled,
+		})
+	}
+
+	return render(w, format, records, []string{"ID", "EMAIL", "CREATED AT", "ROLE", "CHIRPY RED", "DISABLED AT"}, rows)
+}
+
+func render(w io.Writer, format string, v any, header []string, rows [][]string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("%w: unknown output format %q", errUsage, format)
+	}
+}
@@ -0,0 +1,17 @@
+package cli
+
+import (
+	"os"
+	"testing"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/pgtest"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(pgtest.Main(m))
+}
+
+func TestRoutesPostgres(t *testing.T) {
+	testRoutes(t, database.NewDB(pgtest.DB(t), nil))
+}
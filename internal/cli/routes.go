@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/api"
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/idempotency"
+	"github.com/cloudsmyth/chirpy/internal/oauth"
+	"github.com/cloudsmyth/chirpy/internal/ratelimit"
+	"github.com/cloudsmyth/chirpy/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Rate limit policies. Chirp creation is limited per user; the rest are
+// reachable without an account and so are limited per client address.
+var (
+	createChirpPolicy = ratelimit.Policy{Name: "create_chirp", Limit: 30, Period: time.Minute}
+	signupPolicy      = ratelimit.Policy{Name: "signup", Limit: 10, Period: time.Hour}
+	loginPolicy       = ratelimit.Policy{Name: "login", Limit: 10, Period: time.Minute}
+	oauthPolicy       = ratelimit.Policy{Name: "oauth", Limit: 30, Period: time.Minute}
+	streamPolicy      = ratelimit.Policy{Name: "stream", Limit: 30, Period: time.Minute}
+)
+
+// rateLimitSweepInterval is how often idle rate limit buckets are dropped,
+// and idempotencySweepInterval how often expired idempotency keys are.
+const (
+	rateLimitSweepInterval   = 10 * time.Minute
+	idempotencySweepInterval = 10 * time.Minute
+)
+
+// routes is everything the HTTP routes depend on. serve fills it from the
+// configuration; tests fill it with in-memory backends.
+type routes struct {
+	api     *api.ApiConfig
+	oauth   *oauth.Server
+	limiter *ratelimit.Limiter
+	keys    *idempotency.Keys
+	health  *api.Health
+	tracer  trace.TracerProvider
+}
+
+func (rt *routes) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	apiCfg, oauthServer, health := rt.api, rt.oauth, rt.health
+
+	handle := func(pattern string, handler http.Handler) {
+		mux.Handle(pattern, tracing.Handler(rt.tracer, pattern, handler))
+	}
+
+	// admin routes need an admin login session and session routes any login
+	// session. scoped routes also accept personal access tokens that grant
+	// scope; public routes let anonymous callers in but still hold tokens to
+	// their scope.
+	admin := func(pattern string, handler http.Handler) {
+		handle(pattern, apiCfg.RequireRole(auth.RoleAdmin, handler))
+	}
+	scoped := func(pattern, scope string, handler http.HandlerFunc) {
+		handle(pattern, apiCfg.RequireAuth(api.RequireScope(scope, handler)))
+	}
+	public := func(pattern, scope string, handler http.HandlerFunc) {
+		handle(pattern, apiCfg.OptionalAuth(api.RequireScope(scope, handler)))
+	}
+	session := func(pattern string, handler http.HandlerFunc) {
+		handle(pattern, apiCfg.RequireSession(handler))
+	}
+	limit := func(policy ratelimit.Policy, handler http.HandlerFunc) http.HandlerFunc {
+		return rt.limiter.Limit(policy, handler).ServeHTTP
+	}
+	idempotent := func(handler http.HandlerFunc) http.HandlerFunc {
+		return rt.keys.Wrap(handler).ServeHTTP
+	}
+
+	fileServer := http.StripPrefix("/app", http.FileServer(http.Dir(".")))
+	handle("/app/", apiCfg.IncrementHits(fileServer))
+	handle("GET /api/healthz", http.HandlerFunc(health.LivezHandler))
+	handle("GET /livez", http.HandlerFunc(health.LivezHandler))
+	handle("GET /readyz", http.HandlerFunc(health.ReadyzHandler))
+	handle("GET /metrics", apiCfg.Metrics.Handler())
+	admin("GET /admin/metrics", http.HandlerFunc(apiCfg.MetricShowHandler))
+	admin("POST /admin/reset", http.HandlerFunc(apiCfg.MetricResetHandler))
+	admin("GET /admin/users", http.HandlerFunc(apiCfg.AdminListUsersHandler))
+	admin("POST /admin/users/{userId}/disable", http.HandlerFunc(apiCfg.AdminDisableUserHandler))
+	admin("PUT /admin/users/{userId}/role", http.HandlerFunc(apiCfg.AdminSetUserRoleHandler))
+	scoped("POST /api/chirps", auth.ScopeChirpsWrite, idempotent(limit(createChirpPolicy, apiCfg.CreateChirpsHandler)))
+	handle("POST /api/users", idempotent(limit(signupPolicy, apiCfg.AddUserHandler)))
+	scoped("PUT /api/users", auth.ScopeProfileWrite, apiCfg.UpdateUserHandler)
+	scoped("PUT /api/users/{userId}/follow", auth.ScopeProfileWrite, apiCfg.FollowUserHandler)
+	scoped("DELETE /api/users/{userId}/follow", auth.ScopeProfileWrite, apiCfg.UnfollowUserHandler)
+	public("GET /api/chirps", auth.ScopeChirpsRead, apiCfg.GetChirpsHandler)
+	public("GET /api/chirps/{chirpId}", auth.ScopeChirpsRead, apiCfg.GetChirpByIdHandler)
+	public("GET /api/stream", auth.ScopeChirpsRead, limit(streamPolicy, apiCfg.StreamHandler))
+	handle("POST /api/login", limit(loginPolicy, apiCfg.LoginHandler))
+	handle("POST /api/refresh", http.HandlerFunc(apiCfg.RefreshHandler))
+	handle("POST /api/revoke", http.HandlerFunc(apiCfg.RevokeHandler))
+	scoped("DELETE /api/chirps/{chirpId}", auth.ScopeChirpsWrite, apiCfg.DeleteChirpsHandler)
+	session("POST /api/tokens", apiCfg.CreatePersonalAccessTokenHandler)
+	session("GET /api/tokens", apiCfg.ListPersonalAccessTokensHandler)
+	session("DELETE /api/tokens/{tokenId}", apiCfg.RevokePersonalAccessTokenHandler)
+	session("POST /oauth/clients", oauthServer.RegisterClientHandler)
+	handle("GET /oauth/authorize", http.HandlerFunc(oauthServer.AuthorizeHandler))
+	handle("POST /oauth/authorize", limit(loginPolicy, oauthServer.ConsentHandler))
+	handle("POST /oauth/token", limit(oauthPolicy, oauthServer.TokenHandler))
+	handle("POST /oauth/revoke", http.HandlerFunc(oauthServer.RevokeHandler))
+	handle("POST /api/polka/webhooks", idempotent(apiCfg.UpgradeChirpyRedHandler))
+
+	return mux
+}
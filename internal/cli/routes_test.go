@@ -0,0 +1,643 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/api"
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/cache"
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/database/memory"
+	"github.com/cloudsmyth/chirpy/internal/database/sqlite"
+	"github.com/cloudsmyth/chirpy/internal/idempotency"
+	"github.com/cloudsmyth/chirpy/internal/metrics"
+	"github.com/cloudsmyth/chirpy/internal/migrate"
+	"github.com/cloudsmyth/chirpy/internal/oauth"
+	"github.com/cloudsmyth/chirpy/internal/ratelimit"
+	"github.com/cloudsmyth/chirpy/internal/stream"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	testSecret   = "test-secret"
+	testPolkaKey = "polka-key"
+)
+
+// oauthClients is just enough of an OAuth store to register clients, for
+// stores without OAuth queries; the flows themselves are tested in the oauth
+// package.
+type oauthClients struct {
+	mu      sync.Mutex
+	clients map[string]oauth.Client
+}
+
+func (s *oauthClients) CreateClient(ctx context.Context, client oauth.Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[client.ID] = client
+	return nil
+}
+
+func (s *oauthClients) GetClient(ctx context.Context, id string) (oauth.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client, ok := s.clients[id]
+	if !ok {
+		return oauth.Client{}, oauth.ErrNotFound
+	}
+	return client, nil
+}
+
+func (s *oauthClients) CreateCode(context.Context, oauth.AuthorizationCode) error { return nil }
+func (s *oauthClients) ConsumeCode(context.Context, string, string) (oauth.AuthorizationCode, error) {
+	return oauth.AuthorizationCode{}, oauth.ErrNotFound
+}
+func (s *oauthClients) CreateGrant(ctx context.Context, grant oauth.Grant) (oauth.Grant, error) {
+	return grant, nil
+}
+func (s *oauthClients) GetGrant(context.Context, string) (oauth.Grant, error) {
+	return oauth.Grant{}, oauth.ErrNotFound
+}
+func (s *oauthClients) RevokeGrant(context.Context, uuid.UUID) error { return nil }
+func (s *oauthClients) Authenticate(context.Context, string, string) (oauth.User, error) {
+	return oauth.User{}, oauth.ErrNotFound
+}
+func (s *oauthClients) Get(context.Context, uuid.UUID) (oauth.User, error) {
+	return oauth.User{}, oauth.ErrNotFound
+}
+
+type routeTester struct {
+	t      *testing.T
+	mux    http.Handler
+	store  database.TxStore
+	events *stream.Hub
+}
+
+func newRouteTester(t *testing.T, store database.TxStore) *routeTester {
+	t.Helper()
+	var clients interface {
+		oauth.Store
+		oauth.Users
+	} = &oauthClients{clients: map[string]oauth.Client{}}
+	if q, ok := store.(database.OAuthStore); ok {
+		clients = oauth.NewDatabaseStore(q)
+	}
+	events := stream.NewHub(100, 100)
+	rt := &routes{
+		api: &api.ApiConfig{
+			Metrics:          metrics.New(nil),
+			Store:            stream.NewStore(store, events),
+			Platform:         "dev",
+			Secret:           testSecret,
+			Polka:            testPolkaKey,
+			JWTExpiresIn:     time.Hour,
+			RefreshExpiresIn: 24 * time.Hour,
+			Events:           events,
+			StreamHeartbeat:  time.Minute,
+		},
+		oauth: &oauth.Server{
+			Store:           clients,
+			Users:           clients,
+			Secret:          testSecret,
+			AccessTokenTTL:  time.Hour,
+			RefreshTokenTTL: 24 * time.Hour,
+		},
+		limiter: &ratelimit.Limiter{},
+		keys:    &idempotency.Keys{Store: idempotency.NewMemoryStore(), Retention: time.Hour},
+		health:  &api.Health{Timeout: time.Second},
+		tracer:  noop.NewTracerProvider(),
+	}
+	return &routeTester{t: t, mux: rt.mux(), store: store, events: events}
+}
+
+// send sends body as JSON, or form encoded when it is url.Values, with
+// token as the bearer credential when it is not empty.
+func (rt *routeTester) send(method, path, token string, body any) *httptest.ResponseRecorder {
+	rt.t.Helper()
+	return rt.sendWithHeader(method, path, token, nil, body)
+}
+
+// sendWithHeader is send with extra request headers.
+func (rt *routeTester) sendWithHeader(method, path, token string, header http.Header, body any) *httptest.ResponseRecorder {
+	rt.t.Helper()
+
+	var req *http.Request
+	switch b := body.(type) {
+	case nil:
+		req = httptest.NewRequest(method, path, nil)
+	case url.Values:
+		req = httptest.NewRequest(method, path, strings.NewReader(b.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			rt.t.Fatalf("encoding body: %v", err)
+		}
+		req = httptest.NewRequest(method, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rec := httptest.NewRecorder()
+	rt.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// do sends a request, checks the response status and decodes the JSON
+// response into out when out is not nil.
+func (rt *routeTester) do(method, path, token string, body any, wantStatus int, out any) *httptest.ResponseRecorder {
+	rt.t.Helper()
+	rec := rt.send(method, path, token, body)
+	if rec.Code != wantStatus {
+		rt.t.Fatalf("%s %s: status = %d, want %d; body %s", method, path, rec.Code, wantStatus, rec.Body)
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			rt.t.Fatalf("%s %s: decoding %s: %v", method, path, rec.Body, err)
+		}
+	}
+	return rec
+}
+
+// problem sends a request and checks that the response is a problem with
+// code.
+func (rt *routeTester) problem(method, path, token string, body any, wantCode string) {
+	rt.t.Helper()
+	rec := rt.send(method, path, token, body)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		rt.t.Fatalf("%s %s: Content-Type = %q, want a problem; body %s", method, path, ct, rec.Body)
+	}
+	var problem struct {
+		Status int    `json:"status"`
+		Code   string `json:"code"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		rt.t.Fatalf("%s %s: decoding problem: %v", method, path, err)
+	}
+	if problem.Code != wantCode || problem.Status != rec.Code {
+		rt.t.Fatalf("%s %s: got %d %s, want code %s", method, path, rec.Code, problem.Code, wantCode)
+	}
+}
+
+type testUser struct {
+	ID           uuid.UUID `json:"id"`
+	Email        string    `json:"email"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	Role         string    `json:"role"`
+}
+
+func (rt *routeTester) signup(email string) testUser {
+	rt.t.Helper()
+	var user testUser
+	rt.do("POST", "/api/users", "", map[string]string{"email": email, "password": "hunter2"}, http.StatusCreated, &user)
+	return user
+}
+
+func (rt *routeTester) login(email string) testUser {
+	rt.t.Helper()
+	var user testUser
+	rt.do("POST", "/api/login", "", map[string]string{"email": email, "password": "hunter2"}, http.StatusOK, &user)
+	return user
+}
+
+func TestRoutes(t *testing.T) {
+	testRoutes(t, memory.New())
+}
+
+// TestRoutesCached runs the suite through the chirp cache, so any read that
+// a write fails to invalidate shows up as a stale response.
+func TestRoutesCached(t *testing.T) {
+	testRoutes(t, cache.NewStore(memory.New(), cache.NewLRU(100), time.Minute, 0, nil))
+}
+
+func TestRoutesSQLite(t *testing.T) {
+	db, backend, err := database.Open("sqlite:"+filepath.Join(t.TempDir(), "chirpy.db"), nil)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	migrations, err := migrate.NewProvider(db, backend)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if _, err := migrations.Up(context.Background()); err != nil {
+		t.Fatalf("Failed to apply migrations: %v", err)
+	}
+
+	testRoutes(t, sqlite.NewStore(db, nil))
+}
+
+// failingStore fails the reads a database outage would, to check that
+// handlers report them as server errors.
+type failingStore struct {
+	database.TxStore
+}
+
+var errStoreDown = errors.New("connection refused")
+
+func (s failingStore) GetChirpsByAuthor(context.Context, uuid.UUID) ([]database.Chirp, error) {
+	return nil, errStoreDown
+}
+
+func (s failingStore) GetRefreshByToken(context.Context, string) (database.RefreshToken, error) {
+	return database.RefreshToken{}, errStoreDown
+}
+
+func (s failingStore) Reset(context.Context) error {
+	return errStoreDown
+}
+
+func TestRoutesStoreErrors(t *testing.T) {
+	store := memory.New()
+	rt := newRouteTester(t, failingStore{TxStore: store})
+
+	rt.problem("GET", "/api/chirps?author_id="+uuid.NewString(), "", nil, "internal_error")
+	// An outage must not tell clients to throw their refresh token away.
+	rt.problem("POST", "/api/refresh", "some-refresh-token", nil, "internal_error")
+
+	admin := rt.signup("admin@example.com")
+	if _, err := store.SetUserRole(context.Background(), database.SetUserRoleParams{Role: auth.RoleAdmin, ID: admin.ID}); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+	admin = rt.login(admin.Email)
+	rt.problem("POST", "/admin/reset", admin.Token, nil, "internal_error")
+}
+
+// testRoutes walks every route against store. It runs the steps in order
+// since later ones depend on the users and chirps earlier ones create.
+func testRoutes(t *testing.T, store database.TxStore) {
+	rt := newRouteTester(t, store)
+
+	var alice, bob testUser
+	t.Run("Users", func(t *testing.T) {
+		rt.t = t
+		alice = rt.signup("alice@example.com")
+		bob = rt.signup("bob@example.com")
+		if alice.Role != auth.RoleUser || alice.IsChirpyRed {
+			t.Errorf("new user = %+v", alice)
+		}
+		rt.problem("POST", "/api/users", "", map[string]string{"email": "alice@example.com", "password": "x"}, "email_taken")
+		rt.problem("POST", "/api/users", "", map[string]string{"email": "nope", "password": "x"}, "validation_failed")
+		rt.problem("POST", "/api/users", "", map[string]any{"email": "c@example.com", "password": "x", "admin": true}, "validation_failed")
+	})
+
+	t.Run("Login", func(t *testing.T) {
+		rt.t = t
+		alice = rt.login("alice@example.com")
+		bob = rt.login("bob@example.com")
+		if alice.Token == "" || alice.RefreshToken == "" {
+			t.Fatalf("login returned no tokens: %+v", alice)
+		}
+		rt.problem("POST", "/api/login", "", map[string]string{"email": "alice@example.com", "password": "wrong"}, "invalid_credentials")
+		rt.problem("POST", "/api/login", "", map[string]string{"email": "nobody@example.com", "password": "hunter2"}, "invalid_credentials")
+	})
+
+	t.Run("UpdateUser", func(t *testing.T) {
+		rt.t = t
+		var updated testUser
+		rt.do("PUT", "/api/users", alice.Token, map[string]string{"email": "alice@example.org", "password": "hunter2"}, http.StatusOK, &updated)
+		if updated.Email != "alice@example.org" || updated.ID != alice.ID {
+			t.Errorf("updated user = %+v", updated)
+		}
+		rt.problem("PUT", "/api/users", alice.Token, map[string]string{"email": "bob@example.com", "password": "hunter2"}, "email_taken")
+		rt.problem("PUT", "/api/users", "", map[string]string{"email": "x@example.com", "password": "hunter2"}, "unauthorized")
+		rt.problem("PUT", "/api/users", "not-a-jwt", map[string]string{"email": "x@example.com", "password": "hunter2"}, "invalid_token")
+
+		// Keeping the password keeps the sessions; a new one ends them.
+		rt.do("POST", "/api/refresh", alice.RefreshToken, nil, http.StatusOK, nil)
+		rt.do("PUT", "/api/users", bob.Token, map[string]string{"email": bob.Email, "password": "correct horse"}, http.StatusOK, nil)
+		rt.problem("POST", "/api/refresh", bob.RefreshToken, nil, "invalid_token")
+		rt.problem("POST", "/api/login", "", map[string]string{"email": bob.Email, "password": "hunter2"}, "invalid_credentials")
+		rt.do("PUT", "/api/users", bob.Token, map[string]string{"email": bob.Email, "password": "hunter2"}, http.StatusOK, nil)
+		bob = rt.login(bob.Email)
+	})
+
+	var chirp api.Chirp
+	t.Run("Chirps", func(t *testing.T) {
+		rt.t = t
+		rt.do("POST", "/api/chirps", alice.Token, map[string]string{"body": "I had a kerfuffle today"}, http.StatusCreated, &chirp)
+		if chirp.Body != "I had a **** today" || chirp.UserId != alice.ID {
+			t.Errorf("chirp = %+v", chirp)
+		}
+		rt.do("POST", "/api/chirps", bob.Token, map[string]string{"body": "Hello"}, http.StatusCreated, nil)
+		rt.problem("POST", "/api/chirps", alice.Token, map[string]string{"body": strings.Repeat("a", 141)}, "validation_failed")
+		rt.problem("POST", "/api/chirps", "", map[string]string{"body": "anonymous"}, "unauthorized")
+
+		var chirps []api.Chirp
+		rt.do("GET", "/api/chirps", "", nil, http.StatusOK, &chirps)
+		if len(chirps) != 2 || chirps[0].ID != chirp.ID {
+			t.Errorf("chirps = %+v", chirps)
+		}
+		rt.do("GET", "/api/chirps?sort=desc", "", nil, http.StatusOK, &chirps)
+		if len(chirps) != 2 || chirps[1].ID != chirp.ID {
+			t.Errorf("chirps sorted desc = %+v", chirps)
+		}
+		rt.do("GET", "/api/chirps?author_id="+bob.ID.String(), "", nil, http.StatusOK, &chirps)
+		if len(chirps) != 1 || chirps[0].UserId != bob.ID {
+			t.Errorf("bob's chirps = %+v", chirps)
+		}
+		rt.problem("GET", "/api/chirps?author_id=nope", "", nil, "invalid_parameter")
+
+		var got api.Chirp
+		rt.do("GET", "/api/chirps/"+chirp.ID.String(), "", nil, http.StatusOK, &got)
+		if got.ID != chirp.ID {
+			t.Errorf("chirp = %+v, want %s", got, chirp.ID)
+		}
+		rt.problem("GET", "/api/chirps/"+uuid.NewString(), "", nil, "not_found")
+		rt.problem("GET", "/api/chirps/nope", "", nil, "invalid_parameter")
+
+		rt.problem("DELETE", "/api/chirps/"+chirp.ID.String(), bob.Token, nil, "forbidden")
+		rt.do("DELETE", "/api/chirps/"+chirp.ID.String(), alice.Token, nil, http.StatusNoContent, nil)
+		rt.problem("DELETE", "/api/chirps/"+chirp.ID.String(), alice.Token, nil, "not_found")
+	})
+
+	t.Run("ConditionalRequests", func(t *testing.T) {
+		rt.t = t
+		var chirp api.Chirp
+		created := rt.do("POST", "/api/chirps", alice.Token, map[string]string{"body": "Cache me"}, http.StatusCreated, &chirp)
+		path := "/api/chirps/" + chirp.ID.String()
+
+		rec := rt.do("GET", path, "", nil, http.StatusOK, nil)
+		etag, lastModified := rec.Header().Get("ETag"), rec.Header().Get("Last-Modified")
+		if etag == "" || etag != created.Header().Get("ETag") || lastModified == "" {
+			t.Fatalf("ETag = %q, Last-Modified = %q, created with ETag %q", etag, lastModified, created.Header().Get("ETag"))
+		}
+		if cc := rec.Header().Get("Cache-Control"); cc != "no-cache" {
+			t.Errorf("Cache-Control = %q, want no-cache", cc)
+		}
+
+		list := rt.do("GET", "/api/chirps", "", nil, http.StatusOK, nil)
+		listETag := list.Header().Get("ETag")
+
+		conditional := []struct {
+			name       string
+			path       string
+			header     http.Header
+			wantStatus int
+		}{
+			{"Matching ETag", path, http.Header{"If-None-Match": {`"other", ` + etag}}, http.StatusNotModified},
+			{"Weak ETag", path, http.Header{"If-None-Match": {"W/" + etag}}, http.StatusNotModified},
+			{"Stale ETag", path, http.Header{"If-None-Match": {`"other"`}}, http.StatusOK},
+			{"Not modified since", path, http.Header{"If-Modified-Since": {lastModified}}, http.StatusNotModified},
+			{"Modified since", path, http.Header{"If-Modified-Since": {"Mon, 02 Jan 2006 15:04:05 GMT"}}, http.StatusOK},
+			{"ETag wins over date", path, http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {lastModified}}, http.StatusOK},
+			{"Matching listing", "/api/chirps", http.Header{"If-None-Match": {listETag}}, http.StatusNotModified},
+		}
+		for _, tt := range conditional {
+			rec := rt.sendWithHeader("GET", tt.path, "", tt.header, nil)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusNotModified && (rec.Body.Len() != 0 || rec.Header().Get("ETag") == "") {
+				t.Errorf("%s: 304 with body %q and ETag %q", tt.name, rec.Body, rec.Header().Get("ETag"))
+			}
+		}
+
+		rec = rt.sendWithHeader("DELETE", path, alice.Token, http.Header{"If-Match": {`"other"`}}, nil)
+		if rec.Code != http.StatusPreconditionFailed {
+			t.Errorf("DELETE with a stale If-Match: status = %d, want 412", rec.Code)
+		}
+		rec = rt.sendWithHeader("DELETE", path, alice.Token, http.Header{"If-Match": {etag}}, nil)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("DELETE with a matching If-Match: status = %d, want 204", rec.Code)
+		}
+
+		rec = rt.sendWithHeader("GET", "/api/chirps", "", http.Header{"If-None-Match": {listETag}}, nil)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Listing after a delete: status = %d, want 200", rec.Code)
+		}
+	})
+
+	t.Run("ChirpEvents", func(t *testing.T) {
+		rt.t = t
+		sub, _, _, _ := rt.events.Subscribe("")
+		defer sub.Close()
+
+		var chirp api.Chirp
+		rt.do("POST", "/api/chirps", bob.Token, map[string]string{"body": "Streamed"}, http.StatusCreated, &chirp)
+		rt.do("DELETE", "/api/chirps/"+chirp.ID.String(), bob.Token, nil, http.StatusNoContent, nil)
+
+		for _, want := range []string{stream.ChirpCreated, stream.ChirpDeleted} {
+			select {
+			case event := <-sub.Events():
+				if event.Type != want || event.Chirp.ID != chirp.ID || event.Chirp.UserID != bob.ID {
+					t.Errorf("Event = %+v, want %s of %s", event, want, chirp.ID)
+				}
+			default:
+				t.Fatalf("Expected a %s event", want)
+			}
+		}
+		rt.problem("GET", "/api/stream?author_id=nope", "", nil, "invalid_parameter")
+	})
+
+	t.Run("Follows", func(t *testing.T) {
+		rt.t = t
+		path := "/api/users/" + bob.ID.String() + "/follow"
+		rt.do("PUT", path, alice.Token, nil, http.StatusNoContent, nil)
+		rt.do("PUT", path, alice.Token, nil, http.StatusNoContent, nil)
+		followed, err := rt.store.GetFollowedUserIds(context.Background(), alice.ID)
+		if err != nil || len(followed) != 1 || followed[0] != bob.ID {
+			t.Errorf("GetFollowedUserIds() = %v, %v, want bob", followed, err)
+		}
+
+		rt.problem("PUT", "/api/users/"+alice.ID.String()+"/follow", alice.Token, nil, "invalid_parameter")
+		rt.problem("PUT", "/api/users/"+uuid.NewString()+"/follow", alice.Token, nil, "not_found")
+		rt.problem("PUT", "/api/users/nope/follow", alice.Token, nil, "invalid_parameter")
+		rt.problem("PUT", path, "", nil, "unauthorized")
+		rt.problem("GET", "/api/stream?following=true", "", nil, "unauthorized")
+		rt.problem("GET", "/api/stream?following=maybe", alice.Token, nil, "invalid_parameter")
+
+		rt.do("DELETE", path, alice.Token, nil, http.StatusNoContent, nil)
+		rt.problem("DELETE", path, alice.Token, nil, "not_found")
+	})
+
+	t.Run("IdempotencyKeys", func(t *testing.T) {
+		rt.t = t
+		key := http.Header{"Idempotency-Key": {uuid.NewString()}}
+		post := func(body string) *httptest.ResponseRecorder {
+			return rt.sendWithHeader("POST", "/api/chirps", alice.Token, key, map[string]string{"body": body})
+		}
+
+		var before []api.Chirp
+		rt.do("GET", "/api/chirps?author_id="+alice.ID.String(), "", nil, http.StatusOK, &before)
+
+		first, retry := post("Only once"), post("Only once")
+		if first.Code != http.StatusCreated || retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+			t.Fatalf("POST twice: %d %s, then %d %s", first.Code, first.Body, retry.Code, retry.Body)
+		}
+		if retry.Header().Get("Idempotent-Replayed") != "true" {
+			t.Error("Expected the retry to be marked as replayed")
+		}
+		var after []api.Chirp
+		rt.do("GET", "/api/chirps?author_id="+alice.ID.String(), "", nil, http.StatusOK, &after)
+		if len(after) != len(before)+1 {
+			t.Errorf("Expected one chirp to be created, have %d, had %d", len(after), len(before))
+		}
+
+		if rec := post("Something else"); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Reusing the key with another body: status = %d, want 422", rec.Code)
+		}
+	})
+
+	t.Run("RefreshAndRevoke", func(t *testing.T) {
+		rt.t = t
+		var refreshed struct {
+			Token string `json:"token"`
+		}
+		rt.do("POST", "/api/refresh", alice.RefreshToken, nil, http.StatusOK, &refreshed)
+		if refreshed.Token == "" {
+			t.Error("refresh returned no token")
+		}
+		rt.do("POST", "/api/revoke", alice.RefreshToken, nil, http.StatusNoContent, nil)
+		rt.problem("POST", "/api/refresh", alice.RefreshToken, nil, "invalid_token")
+		rt.problem("POST", "/api/refresh", "", nil, "unauthorized")
+		rt.problem("POST", "/api/revoke", "unknown", nil, "invalid_token")
+	})
+
+	t.Run("PersonalAccessTokens", func(t *testing.T) {
+		rt.t = t
+		var pat struct {
+			ID    uuid.UUID `json:"id"`
+			Token string    `json:"token"`
+		}
+		rt.do("POST", "/api/tokens", alice.Token, map[string]any{"name": "reader", "scopes": []string{auth.ScopeChirpsRead}}, http.StatusCreated, &pat)
+		rt.problem("POST", "/api/tokens", alice.Token, map[string]any{"name": "bad", "scopes": []string{"everything"}}, "validation_failed")
+		rt.problem("POST", "/api/tokens", pat.Token, map[string]any{"name": "escalate", "scopes": []string{auth.ScopeChirpsWrite}}, "forbidden")
+
+		var tokens []map[string]any
+		rt.do("GET", "/api/tokens", alice.Token, nil, http.StatusOK, &tokens)
+		if len(tokens) != 1 || tokens[0]["token"] != nil {
+			t.Errorf("tokens = %v", tokens)
+		}
+
+		rt.do("GET", "/api/chirps", pat.Token, nil, http.StatusOK, nil)
+		rt.problem("POST", "/api/chirps", pat.Token, map[string]string{"body": "hi"}, "insufficient_scope")
+
+		rt.do("DELETE", "/api/tokens/"+pat.ID.String(), alice.Token, nil, http.StatusNoContent, nil)
+		rt.problem("DELETE", "/api/tokens/"+pat.ID.String(), alice.Token, nil, "not_found")
+		rt.problem("GET", "/api/chirps", pat.Token, nil, "invalid_token")
+	})
+
+	t.Run("PolkaWebhook", func(t *testing.T) {
+		rt.t = t
+		upgrade := func(key string, userID string, wantStatus int) {
+			t.Helper()
+			body, _ := json.Marshal(map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": userID}})
+			req := httptest.NewRequest("POST", "/api/polka/webhooks", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if key != "" {
+				req.Header.Set("Authorization", "ApiKey "+key)
+			}
+			rec := httptest.NewRecorder()
+			rt.mux.ServeHTTP(rec, req)
+			if rec.Code != wantStatus {
+				t.Fatalf("webhook: status = %d, want %d; body %s", rec.Code, wantStatus, rec.Body)
+			}
+		}
+		upgrade("", alice.ID.String(), http.StatusUnauthorized)
+		upgrade("wrong", alice.ID.String(), http.StatusUnauthorized)
+		upgrade(testPolkaKey, uuid.NewString(), http.StatusNotFound)
+		upgrade(testPolkaKey, alice.ID.String(), http.StatusNoContent)
+
+		if user := rt.login("alice@example.org"); !user.IsChirpyRed {
+			t.Error("alice was not upgraded")
+		}
+	})
+
+	t.Run("Admin", func(t *testing.T) {
+		rt.t = t
+		rt.problem("GET", "/admin/users", alice.Token, nil, "forbidden")
+
+		if _, err := store.SetUserRole(context.Background(), database.SetUserRoleParams{Role: auth.RoleAdmin, ID: alice.ID}); err != nil {
+			t.Fatalf("SetUserRole: %v", err)
+		}
+		admin := rt.login("alice@example.org")
+
+		var users []map[string]any
+		rt.do("GET", "/admin/users", admin.Token, nil, http.StatusOK, &users)
+		if len(users) != 2 {
+			t.Errorf("users = %v", users)
+		}
+		rt.do("PUT", "/admin/users/"+bob.ID.String()+"/role", admin.Token, map[string]string{"role": auth.RoleModerator}, http.StatusOK, nil)
+		rt.problem("PUT", "/admin/users/"+bob.ID.String()+"/role", admin.Token, map[string]string{"role": "root"}, "validation_failed")
+		rt.problem("PUT", "/admin/users/"+uuid.NewString()+"/role", admin.Token, map[string]string{"role": auth.RoleUser}, "not_found")
+
+		rt.do("POST", "/admin/users/"+bob.ID.String()+"/disable", admin.Token, nil, http.StatusOK, nil)
+		rt.problem("POST", "/api/login", "", map[string]string{"email": "bob@example.com", "password": "hunter2"}, "account_disabled")
+		rt.problem("POST", "/api/refresh", bob.RefreshToken, nil, "invalid_token")
+		rt.problem("POST", "/api/chirps", bob.Token, map[string]string{"body": "Still here?"}, "invalid_token")
+
+		rec := rt.do("GET", "/admin/metrics", admin.Token, nil, http.StatusOK, nil)
+		if !strings.Contains(rec.Body.String(), "Chirpy Admin") {
+			t.Errorf("metrics page = %s", rec.Body)
+		}
+
+		// Reset deletes every user and, through the foreign keys, their
+		// chirps and tokens.
+		rt.do("POST", "/admin/reset", admin.Token, nil, http.StatusOK, nil)
+		var chirps []api.Chirp
+		rt.do("GET", "/api/chirps", "", nil, http.StatusOK, &chirps)
+		if len(chirps) != 0 {
+			t.Errorf("chirps after reset = %+v", chirps)
+		}
+		rt.problem("POST", "/api/refresh", admin.RefreshToken, nil, "invalid_token")
+	})
+
+	t.Run("OAuth", func(t *testing.T) {
+		rt.t = t
+		user := rt.signup("carol@example.com")
+		user = rt.login(user.Email)
+
+		var client struct {
+			ClientID string `json:"client_id"`
+		}
+		rt.do("POST", "/oauth/clients", user.Token, map[string]any{"name": "App", "redirect_uris": []string{"https://app.example.com/cb"}}, http.StatusCreated, &client)
+		rt.problem("POST", "/oauth/clients", user.Token, map[string]any{"name": "App"}, "validation_failed")
+
+		rt.do("GET", "/oauth/authorize?client_id=unknown", "", nil, http.StatusBadRequest, nil)
+		rt.do("POST", "/oauth/authorize", "", url.Values{"client_id": {"unknown"}}, http.StatusBadRequest, nil)
+		rt.do("POST", "/oauth/token", "", url.Values{"grant_type": {"password"}}, http.StatusUnauthorized, nil)
+		rt.do("POST", "/oauth/revoke", "", url.Values{"token": {"x"}}, http.StatusUnauthorized, nil)
+	})
+
+	t.Run("IdempotentSignup", func(t *testing.T) {
+		rt.t = t
+		key := http.Header{"Idempotency-Key": {uuid.NewString()}}
+		signup := map[string]string{"email": "dave@example.com", "password": "hunter2"}
+
+		first := rt.sendWithHeader("POST", "/api/users", "", key, signup)
+		retry := rt.sendWithHeader("POST", "/api/users", "", key, signup)
+		if first.Code != http.StatusCreated || retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+			t.Errorf("Signup twice: %d %s, then %d %s", first.Code, first.Body, retry.Code, retry.Body)
+		}
+		// Without the key the same signup is a duplicate.
+		rt.problem("POST", "/api/users", "", signup, "email_taken")
+	})
+
+	t.Run("Operational", func(t *testing.T) {
+		rt.t = t
+		for _, path := range []string{"/api/healthz", "/livez", "/readyz", "/metrics", "/app/"} {
+			rt.do("GET", path, "", nil, http.StatusOK, nil)
+		}
+	})
+}
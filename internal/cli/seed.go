@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/database"
+)
+
+const seedPassword = "password123"
+
+func seedCommand(ctx context.Context, args []string, stdout io.Writer) error {
+	fs, format := newFlagSet("seed", true)
+	userCount := fs.Int("users", 3, "number of demo users")
+	chirpCount := fs.Int("chirps", 5, "chirps per demo user")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *userCount < 1 || *chirpCount < 0 {
+		return fmt.Errorf("%w: seed needs at least one user and a non-negative chirp count", errUsage)
+	}
+
+	e, err := openEnv()
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	if e.cfg.Platform != "dev" {
+		return errors.New("seed is only allowed when PLATFORM=dev")
+	}
+
+	hashedPassword, err := auth.HashPassword(seedPassword)
+	if err != nil {
+		return err
+	}
+
+	users := []database.User{}
+	for i := 1; i <= *userCount; i++ {
+		email := fmt.Sprintf("seed%d@example.com", i)
+		user, err := e.queries.GetUserByEmail(ctx, email)
+		if errors.Is(err, sql.ErrNoRows) {
+			user, err = e.queries.CreateUser(ctx, database.CreateUserParams{
+				Email:          email,
+				HashedPassword: hashedPassword,
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("creating %s: %w", email, err)
+		}
+
+		for j := 1; j <= *chirpCount; j++ {
+			_, err := e.queries.CreateChirp(ctx, database.CreateChirpParams{
+				Body:   fmt.Sprintf("Demo chirp %d from %s", j, email),
+				UserID: user.ID,
+			})
+			if err != nil {
+				return fmt.Errorf("creating chirp for %s: %w", email, err)
+			}
+		}
+		users = append(users, user)
+	}
+
+	if err := printUsers(stdout, *format, users); err != nil {
+		return err
+	}
+	if *format == "table" {
+		fmt.Fprintf(stdout, "\nAll demo users log in with the password %q\n", seedPassword)
+	}
+	return nil
+}
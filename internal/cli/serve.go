@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/api"
+	"github.com/cloudsmyth/chirpy/internal/cache"
+	"github.com/cloudsmyth/chirpy/internal/config"
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/idempotency"
+	"github.com/cloudsmyth/chirpy/internal/logging"
+	"github.com/cloudsmyth/chirpy/internal/metrics"
+	"github.com/cloudsmyth/chirpy/internal/migrate"
+	"github.com/cloudsmyth/chirpy/internal/oauth"
+	"github.com/cloudsmyth/chirpy/internal/ratelimit"
+	"github.com/cloudsmyth/chirpy/internal/stream"
+	"github.com/cloudsmyth/chirpy/internal/tracing"
+)
+
+func serve(ctx context.Context, args []string) error {
+	fs, _ := newFlagSet("serve", false)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	logger.Info("Effective configuration", "config", cfg)
+
+	tp, shutdownTracing, err := tracing.Setup(ctx, cfg.TraceExporter)
+	if err != nil {
+		return fmt.Errorf("setting up tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	db, backend, err := database.Open(cfg.DBURL, tracing.WrapConnector)
+	if err != nil {
+		return fmt.Errorf("opening database: %w", err)
+	}
+	defer db.Close()
+	pool := database.Pool{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+		ConnMaxIdleTime: cfg.DBConnMaxIdleTime,
+	}
+	if backend == database.BackendPostgres {
+		pool.Apply(db)
+	}
+	traced := func(backend string) func(database.DBTX) database.DBTX {
+		return func(conn database.DBTX) database.DBTX { return tracing.WrapDB(tp, backend, conn) }
+	}
+	store := newStore(backend, db, traced(backend))
+
+	var replicas []database.Replica
+	for i, replicaURL := range cfg.DBReplicaURLs {
+		replicaDB, replicaBackend, err := database.Open(replicaURL, tracing.WrapConnector)
+		if err != nil {
+			return fmt.Errorf("opening read replica %d: %w", i+1, err)
+		}
+		defer replicaDB.Close()
+		pool.Apply(replicaDB)
+		replicas = append(replicas, database.NewReplica(replicaName(replicaURL), replicaDB, traced(replicaBackend)))
+	}
+	readStore := database.NewReplicaStore(store, replicas...)
+
+	var replicaLag time.Duration
+	if len(replicas) > 0 {
+		replicaLag = cfg.DBReadYourWritesWindow
+	}
+
+	m := metrics.New(db)
+	var apiStore database.TxStore = readStore
+	if cfg.ChirpCacheSize > 0 {
+		apiStore = cache.NewStore(readStore, cache.NewLRU(cfg.ChirpCacheSize), cfg.ChirpCacheTTL, replicaLag, m)
+	}
+
+	// On Postgres, events go through NOTIFY so that every instance streams
+	// them; a SQLite file has a single instance.
+	events := stream.NewHub(cfg.StreamBufferSize, cfg.StreamMaxSubscribers)
+	var publisher stream.Publisher = events
+	if backend == database.BackendPostgres {
+		publisher = stream.NewPostgresPublisher(database.New(traced(backend)(db)))
+	}
+	apiStore = stream.NewStore(apiStore, publisher)
+
+	migrations, err := migrate.NewProvider(db, backend)
+	if err != nil {
+		return fmt.Errorf("loading migrations: %w", err)
+	}
+	if cfg.AutoMigrate {
+		if _, err := migrations.Up(ctx); err != nil {
+			return fmt.Errorf("applying migrations: %w", err)
+		}
+	}
+	if err := migrate.CheckVersion(ctx, migrations); err != nil {
+		return fmt.Errorf("refusing to start: %w", err)
+	}
+
+	apiCfg := &api.ApiConfig{
+		Metrics:              m,
+		Store:                apiStore,
+		Platform:             cfg.Platform,
+		Secret:               cfg.JWTSecret,
+		Polka:                cfg.PolkaKey,
+		JWTExpiresIn:         cfg.JWTExpiresIn,
+		RefreshExpiresIn:     cfg.RefreshExpiresIn,
+		TokenCleanupInterval: cfg.TokenCleanupInterval,
+		TokenRetention:       cfg.TokenRetention,
+		TokenCleanupBatch:    int32(cfg.TokenCleanupBatch),
+		Events:               events,
+		StreamHeartbeat:      cfg.StreamHeartbeatInterval,
+	}
+	if len(replicas) > 0 {
+		apiCfg.RecentWrites = database.NewRecentWriters(cfg.DBReadYourWritesWindow)
+	}
+
+	oauthStore := oauth.NewDatabaseStore(store)
+	oauthServer := &oauth.Server{
+		Store:           oauthStore,
+		Users:           oauthStore,
+		Secret:          cfg.JWTSecret,
+		AccessTokenTTL:  cfg.JWTExpiresIn,
+		RefreshTokenTTL: cfg.RefreshExpiresIn,
+	}
+
+	limiter := &ratelimit.Limiter{
+		TrustedProxies: cfg.TrustedProxies,
+		Metrics:        apiCfg.Metrics,
+	}
+	switch cfg.RateLimitStore {
+	case "memory":
+		limiter.Store = ratelimit.NewMemoryStore()
+	case "postgres":
+		limiter.Store = ratelimit.NewPostgresStore(database.New(traced(backend)(db)))
+	}
+
+	keys := &idempotency.Keys{Retention: cfg.IdempotencyRetention}
+	switch cfg.IdempotencyStore {
+	case "memory":
+		keys.Store = idempotency.NewMemoryStore()
+	case "postgres":
+		keys.Store = idempotency.NewPostgresStore(database.New(traced(backend)(db)))
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go apiCfg.RunTokenCleanup(ctx)
+	go limiter.Run(ctx, rateLimitSweepInterval)
+	go keys.Run(ctx, idempotencySweepInterval)
+	go readStore.Run(ctx, cfg.DBReplicaCheckInterval)
+	if backend == database.BackendPostgres {
+		go stream.NewListener(cfg.DBURL, events).Run(ctx)
+	}
+
+	health := &api.Health{Timeout: cfg.HealthCheckTimeout}
+	health.AddCheck("database", "unreachable", api.DatabaseCheck(db))
+	health.AddCheck("migrations", "unexpected schema version", api.MigrationCheck(db, migrate.LatestVersion(migrations)))
+
+	rt := &routes{
+		api:     apiCfg,
+		oauth:   oauthServer,
+		limiter: limiter,
+		keys:    keys,
+		health:  health,
+		tracer:  tp,
+	}
+
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           logging.Middleware(logger, apiCfg.Metrics.Middleware(rt.mux())),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	server.RegisterOnShutdown(events.Close)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Starting server", "port", cfg.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("could not start server: %w", err)
+		}
+	case <-ctx.Done():
+		stop()
+		logger.Info("Shutting down server")
+		health.SetShuttingDown()
+		time.Sleep(cfg.ShutdownDelay)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Server did not shut down cleanly", "error", err)
+		}
+	}
+	return nil
+}
+
+// replicaName identifies a replica in logs by its host and database, which
+// leaves out any credentials.
+func replicaName(replicaURL string) string {
+	u, err := url.Parse(replicaURL)
+	if err != nil {
+		return "<invalid>"
+	}
+	return u.Host + u.Path
+}
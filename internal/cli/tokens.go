@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cloudsmyth/chirpy/internal/api"
+	"github.com/cloudsmyth/chirpy/internal/metrics"
+)
+
+func tokensCommand(ctx context.Context, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: tokens needs a subcommand", errUsage)
+	}
+
+	switch args[0] {
+	case "revoke":
+		return revokeTokens(ctx, args[1:], stdout)
+	case "cleanup":
+		return cleanupTokens(ctx, args[1:], stdout)
+	default:
+		return fmt.Errorf("%w: unknown tokens subcommand %q", errUsage, args[0])
+	}
+}
+
+func revokeTokens(ctx context.Context, args []string, stdout io.Writer) error {
+	fs, _ := newFlagSet("tokens revoke", false)
+	userRef := fs.String("user", "", "revoke every refresh token held by this user id or email")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if (*userRef == "") == (fs.NArg() == 0) || fs.NArg() > 1 {
+		return fmt.Errorf("%w: tokens revoke takes either one token or -user", errUsage)
+	}
+
+	e, err := openEnv()
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	if *userRef != "" {
+		user, err := lookupUser(ctx, e.queries, *userRef)
+		if err != nil {
+			return err
+		}
+		revoked, err := e.queries.RevokeRefreshTokensByUser(ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("revoking refresh tokens: %w", err)
+		}
+		fmt.Fprintf(stdout, "Revoked %d refresh tokens for %s\n", revoked, user.Email)
+		return nil
+	}
+
+	_, err = e.queries.RevokeRefreshByToken(ctx, fs.Arg(0))
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("refresh token not found")
+	}
+	if err != nil {
+		return fmt.Errorf("revoking refresh token: %w", err)
+	}
+	fmt.Fprintln(stdout, "Revoked refresh token")
+	return nil
+}
+
+func cleanupTokens(ctx context.Context, args []string, stdout io.Writer) error {
+	fs, _ := newFlagSet("tokens cleanup", false)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	e, err := openEnv()
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	apiCfg := &api.ApiConfig{
+		Metrics:           metrics.New(nil),
+		Store:             e.queries,
+		TokenRetention:    e.cfg.TokenRetention,
+		TokenCleanupBatch: int32(e.cfg.TokenCleanupBatch),
+	}
+	deleted, err := apiCfg.PurgeRefreshTokens(ctx)
+	if err != nil {
+		return fmt.Errorf("purging refresh tokens: %w", err)
+	}
+	fmt.Fprintf(stdout, "Purged %d stale refresh tokens\n", deleted)
+	return nil
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func usersCommand(ctx context.Context, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: users needs a subcommand", errUsage)
+	}
+
+	fs, format := newFlagSet("users "+args[0], true)
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		if fs.NArg() != 0 {
+			return fmt.Errorf("%w: users list takes no arguments", errUsage)
+		}
+	case "show", "disable", "grant-red":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("%w: users %s takes exactly one user id or email", errUsage, args[0])
+		}
+	case "set-role":
+		if fs.NArg() != 2 || !auth.ValidRole(fs.Arg(1)) {
+			return fmt.Errorf("%w: users set-role takes a user id or email and one of user, moderator or admin", errUsage)
+		}
+	default:
+		return fmt.Errorf("%w: unknown users subcommand %q", errUsage, args[0])
+	}
+
+	e, err := openEnv()
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	if args[0] == "list" {
+		users, err := e.queries.ListUsers(ctx)
+		if err != nil {
+			return fmt.Errorf("listing users: %w", err)
+		}
+		return printUsers(stdout, *format, users)
+	}
+
+	user, err := lookupUser(ctx, e.queries, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "disable":
+		err = e.queries.InTx(ctx, func(tx database.Store) error {
+			var err error
+			user, err = tx.DisableUserById(ctx, user.ID)
+			if err != nil {
+				return fmt.Errorf("disabling user: %w", err)
+			}
+			if _, err := tx.RevokeRefreshTokensByUser(ctx, user.ID); err != nil {
+				return fmt.Errorf("revoking refresh tokens: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	case "set-role":
+		user, err = e.queries.SetUserRole(ctx, database.SetUserRoleParams{
+			Role: fs.Arg(1),
+			ID:   user.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("setting role: %w", err)
+		}
+	case "grant-red":
+		user, err = e.queries.UpgradeUserById(ctx, database.UpgradeUserByIdParams{
+			IsChirpyRed: true,
+			ID:          user.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("upgrading user: %w", err)
+		}
+	}
+
+	return printUsers(stdout, *format, []database.User{user})
+}
+
+// lookupUser accepts either a user id or an email address.
+func lookupUser(ctx context.Context, q database.Store, ref string) (database.User, error) {
+	var user database.User
+	var err error
+	if id, parseErr := uuid.Parse(ref); parseErr == nil {
+		user, err = q.GetUserById(ctx, id)
+	} else {
+		user, err = q.GetUserByEmail(ctx, ref)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, fmt.Errorf("user %q not found", ref)
+	}
+	if err != nil {
+		return database.User{}, fmt.Errorf("looking up user: %w", err)
+	}
+	return user, nil
+}
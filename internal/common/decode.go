@@ -0,0 +1,118 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// DefaultMaxBodyBytes bounds request bodies decoded with DecodeJSON. Every
+// JSON body the API accepts is a handful of short fields.
+const DefaultMaxBodyBytes = 64 << 10
+
+// DecodeOptions adjusts DecodeJSONWith. The zero value gives the defaults
+// used by DecodeJSON.
+type DecodeOptions struct {
+	// MaxBytes caps the body size; zero means DefaultMaxBodyBytes.
+	MaxBytes int64
+	// AllowUnknownFields accepts fields dst does not declare. Use it only
+	// for payloads we do not control, such as third-party webhooks.
+	AllowUnknownFields bool
+}
+
+// DecodeJSON decodes the request body into dst, which must be a pointer to
+// a struct, and checks it against the struct's validate tags. On failure it
+// writes a problem response and returns false, so handlers can simply
+// return.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	return DecodeJSONWith(w, r, dst, DecodeOptions{})
+}
+
+// DecodeJSONWith is DecodeJSON with non-default options.
+func DecodeJSONWith(w http.ResponseWriter, r *http.Request, dst any, opts DecodeOptions) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		RespondWithProblem(w, r, CodeUnsupportedMedia, "Content-Type must be application/json", err)
+		return false
+	}
+
+	maxBytes := opts.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBodyBytes
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	decoder := json.NewDecoder(r.Body)
+	if !opts.AllowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(dst); err != nil {
+		respondWithDecodeError(w, r, err, maxBytes)
+		return false
+	}
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		RespondWithProblem(w, r, CodeMalformedBody, "Request body must contain a single JSON object", err)
+		return false
+	}
+
+	if errs := Validate(dst); errs != nil {
+		RespondWithFieldErrors(w, r, errs)
+		return false
+	}
+	return true
+}
+
+func respondWithDecodeError(w http.ResponseWriter, r *http.Request, err error, maxBytes int64) {
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		RespondWithProblem(w, r, CodeBodyTooLarge, fmt.Sprintf("Request body must be at most %d bytes", maxBytes), err)
+	case errors.Is(err, io.EOF):
+		RespondWithProblem(w, r, CodeMalformedBody, "Request body is empty", err)
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		RespondWithProblem(w, r, CodeMalformedBody, "Request body is not valid JSON", err)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		RespondWithFieldErrors(w, r, []FieldError{{
+			Field:  typeErr.Field,
+			Code:   "type",
+			Detail: "Must be " + jsonTypeName(typeErr.Type),
+		}})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for unknown fields.
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		RespondWithFieldErrors(w, r, []FieldError{{
+			Field:  field,
+			Code:   "unknown",
+			Detail: "Unknown field",
+		}})
+	default:
+		RespondWithProblem(w, r, CodeMalformedBody, "Request body is not a JSON object of the expected shape", err)
+	}
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Pointer:
+		return jsonTypeName(t.Elem())
+	default:
+		return "an object"
+	}
+}
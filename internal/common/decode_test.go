@@ -0,0 +1,152 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type signup struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8"`
+	Role     string `json:"role" validate:"oneof=user admin"`
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		maxBytes    int64
+		wantOK      bool
+		wantStatus  int
+		wantCode    ErrorCode
+		wantFields  []string
+	}{
+		{
+			name:        "valid",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"email": "a@example.com", "password": "hunter2hunter2"}`,
+			wantOK:      true,
+		},
+		{
+			name:        "wrong content type",
+			contentType: "text/plain",
+			body:        `{}`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantCode:    CodeUnsupportedMedia,
+		},
+		{
+			name:       "missing content type",
+			body:       `{}`,
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantCode:   CodeUnsupportedMedia,
+		},
+		{
+			name:        "empty body",
+			contentType: "application/json",
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    CodeMalformedBody,
+		},
+		{
+			name:        "syntax error",
+			contentType: "application/json",
+			body:        `{"email": `,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    CodeMalformedBody,
+		},
+		{
+			name:        "trailing data",
+			contentType: "application/json",
+			body:        `{"email": "a@example.com", "password": "hunter2hunter2"} {}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    CodeMalformedBody,
+		},
+		{
+			name:        "unknown field",
+			contentType: "application/json",
+			body:        `{"email": "a@example.com", "password": "hunter2hunter2", "admin": true}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    CodeValidationFailed,
+			wantFields:  []string{"admin"},
+		},
+		{
+			name:        "wrong type",
+			contentType: "application/json",
+			body:        `{"email": 42}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    CodeValidationFailed,
+			wantFields:  []string{"email"},
+		},
+		{
+			name:        "too large",
+			contentType: "application/json",
+			body:        `{"email": "` + strings.Repeat("a", 100) + `@example.com"}`,
+			maxBytes:    64,
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantCode:    CodeBodyTooLarge,
+		},
+		{
+			name:        "validation",
+			contentType: "application/json",
+			body:        `{"email": "not an email", "password": "short", "role": "root"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    CodeValidationFailed,
+			wantFields:  []string{"email", "password", "role"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+
+			var dst signup
+			ok := DecodeJSONWith(rec, req, &dst, DecodeOptions{MaxBytes: tt.maxBytes})
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v (body %s)", ok, tt.wantOK, rec.Body)
+			}
+			if ok {
+				return
+			}
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var problem Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decoding problem: %v", err)
+			}
+			if problem.Code != tt.wantCode {
+				t.Errorf("code = %s, want %s", problem.Code, tt.wantCode)
+			}
+			var fields []string
+			for _, fe := range problem.Errors {
+				fields = append(fields, fe.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONAllowUnknownFields(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(
+		`{"email": "a@example.com", "password": "hunter2hunter2", "extra": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	var dst signup
+	if !DecodeJSONWith(rec, req, &dst, DecodeOptions{AllowUnknownFields: true}) {
+		t.Fatalf("rejected: %s", rec.Body)
+	}
+	if dst.Email != "a@example.com" {
+		t.Errorf("email = %q", dst.Email)
+	}
+}
@@ -2,7 +2,7 @@ package common
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
@@ -20,7 +20,7 @@ type responseBody struct {
 func RespondWithJson(w http.ResponseWriter, code int, resp interface{}) {
 	response, err := json.Marshal(resp)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s\n", err)
+		slog.Error("Error marshalling JSON", "error", err)
 		w.WriteHeader(500)
 		return
 	}
@@ -30,21 +30,6 @@ func RespondWithJson(w http.ResponseWriter, code int, resp interface{}) {
 	w.Write(response)
 }
 
-func RespondWithError(w http.ResponseWriter, code int, msg string, err error) {
-	if err != nil {
-		log.Printf("Error: %s\n", err)
-	}
-	if code > 499 {
-		log.Printf("Responding with 5XX error: %s", msg)
-	}
-	type errorResponse struct {
-		Error string `json:"error"`
-	}
-	RespondWithJson(w, code, errorResponse{
-		Error: msg,
-	})
-}
-
 func StringInMap(s string, m map[string]bool) bool {
 	_, exists := m[s]
 	return exists
@@ -0,0 +1,136 @@
+package common
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/cloudsmyth/chirpy/internal/logging"
+)
+
+// ErrorCode is a stable, machine-readable identifier for a kind of error.
+// Clients may branch on it; the detail text is for humans and may change.
+type ErrorCode string
+
+const (
+	CodeMalformedBody        ErrorCode = "malformed_body"
+	CodeValidationFailed     ErrorCode = "validation_failed"
+	CodeUnsupportedMedia     ErrorCode = "unsupported_media_type"
+	CodeBodyTooLarge         ErrorCode = "body_too_large"
+	CodeInvalidParameter     ErrorCode = "invalid_parameter"
+	CodeInvalidAuthHeader    ErrorCode = "invalid_authorization_header"
+	CodeUnauthorized         ErrorCode = "unauthorized"
+	CodeInvalidToken         ErrorCode = "invalid_token"
+	CodeInvalidCredentials   ErrorCode = "invalid_credentials"
+	CodeForbidden            ErrorCode = "forbidden"
+	CodeInsufficientScope    ErrorCode = "insufficient_scope"
+	CodeAccountDisabled      ErrorCode = "account_disabled"
+	CodeNotFound             ErrorCode = "not_found"
+	CodeEmailTaken           ErrorCode = "email_taken"
+	CodePreconditionFailed   ErrorCode = "precondition_failed"
+	CodeIdempotencyKeyReused ErrorCode = "idempotency_key_reused"
+	CodeIdempotencyKeyInUse  ErrorCode = "idempotency_key_in_use"
+	CodeRateLimited          ErrorCode = "rate_limited"
+	CodeUnavailable          ErrorCode = "service_unavailable"
+	CodeInternal             ErrorCode = "internal_error"
+)
+
+type problemType struct {
+	status int
+	title  string
+}
+
+// problemTypes fixes the status and title for each code so the same code
+// always means the same thing.
+var problemTypes = map[ErrorCode]problemType{
+	CodeMalformedBody:        {http.StatusBadRequest, "Malformed request body"},
+	CodeValidationFailed:     {http.StatusBadRequest, "Request validation failed"},
+	CodeUnsupportedMedia:     {http.StatusUnsupportedMediaType, "Unsupported media type"},
+	CodeBodyTooLarge:         {http.StatusRequestEntityTooLarge, "Request body too large"},
+	CodeInvalidParameter:     {http.StatusBadRequest, "Invalid parameter"},
+	CodeInvalidAuthHeader:    {http.StatusBadRequest, "Malformed authorization header"},
+	CodeUnauthorized:         {http.StatusUnauthorized, "Authentication required"},
+	CodeInvalidToken:         {http.StatusUnauthorized, "Invalid or expired token"},
+	CodeInvalidCredentials:   {http.StatusUnauthorized, "Incorrect email or password"},
+	CodeForbidden:            {http.StatusForbidden, "Forbidden"},
+	CodeInsufficientScope:    {http.StatusForbidden, "Insufficient scope"},
+	CodeAccountDisabled:      {http.StatusForbidden, "Account disabled"},
+	CodeNotFound:             {http.StatusNotFound, "Resource not found"},
+	CodeEmailTaken:           {http.StatusConflict, "Email already registered"},
+	CodePreconditionFailed:   {http.StatusPreconditionFailed, "Precondition failed"},
+	CodeIdempotencyKeyReused: {http.StatusUnprocessableEntity, "Idempotency key reused"},
+	CodeIdempotencyKeyInUse:  {http.StatusConflict, "Idempotency key in use"},
+	CodeRateLimited:          {http.StatusTooManyRequests, "Too many requests"},
+	CodeUnavailable:          {http.StatusServiceUnavailable, "Service unavailable"},
+	CodeInternal:             {http.StatusInternalServerError, "Internal server error"},
+}
+
+// Status returns the HTTP status that always accompanies code.
+func (c ErrorCode) Status() int {
+	return problemTypes[c].status
+}
+
+// Problem is an RFC 9457 problem details object.
+type Problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+	Code   ErrorCode    `json:"code"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes one invalid field of a request body. Field is the
+// JSON name of the field.
+type FieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+func NewProblem(code ErrorCode, detail string) Problem {
+	t, ok := problemTypes[code]
+	if !ok {
+		code, t = CodeInternal, problemTypes[CodeInternal]
+	}
+	return Problem{
+		Type:   "urn:chirpy:problem:" + string(code),
+		Title:  t.title,
+		Status: t.status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// RespondWithProblem writes an application/problem+json response. detail is
+// shown to the client; err is only logged.
+func RespondWithProblem(w http.ResponseWriter, r *http.Request, code ErrorCode, detail string, err error) {
+	WriteProblem(w, r, NewProblem(code, detail), err)
+}
+
+// RespondWithFieldErrors reports a request body that failed validation.
+func RespondWithFieldErrors(w http.ResponseWriter, r *http.Request, errs []FieldError) {
+	problem := NewProblem(CodeValidationFailed, "One or more fields are invalid")
+	problem.Errors = errs
+	WriteProblem(w, r, problem, nil)
+}
+
+func WriteProblem(w http.ResponseWriter, r *http.Request, problem Problem, err error) {
+	logger := logging.FromContext(r.Context())
+	if problem.Status > 499 {
+		logger.Error("Responding with 5XX error", "status", problem.Status, "code", problem.Code, "msg", problem.Detail, "error", err)
+	} else if err != nil || problem.Errors != nil {
+		logger.Info("Request failed", "status", problem.Status, "code", problem.Code, "msg", problem.Detail, "error", err)
+	}
+
+	response, marshalErr := json.Marshal(problem)
+	if marshalErr != nil {
+		slog.Error("Error marshalling JSON", "error", marshalErr)
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(problem.Status)
+	w.Write(response)
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRespondWithProblem(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       ErrorCode
+		wantStatus int
+		wantCode   ErrorCode
+	}{
+		{"not found", CodeNotFound, http.StatusNotFound, CodeNotFound},
+		{"conflict", CodeEmailTaken, http.StatusConflict, CodeEmailTaken},
+		{"malformed body", CodeMalformedBody, http.StatusBadRequest, CodeMalformedBody},
+		{"unknown code", ErrorCode("bogus"), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			RespondWithProblem(rec, req, tt.code, "detail", nil)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", ct)
+			}
+
+			var got Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decoding body: %v", err)
+			}
+			if got.Status != tt.wantStatus || got.Code != tt.wantCode || got.Detail != "detail" {
+				t.Errorf("problem = %+v, want status %d and code %s", got, tt.wantStatus, tt.wantCode)
+			}
+			if got.Type != "urn:chirpy:problem:"+string(tt.wantCode) || got.Title == "" {
+				t.Errorf("type = %q, title = %q", got.Type, got.Title)
+			}
+		})
+	}
+}
+
+func TestRespondWithFieldErrors(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	RespondWithFieldErrors(rec, req, []FieldError{{Field: "body", Code: "too_long", Detail: "too long"}})
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	var got Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	if got.Code != CodeValidationFailed || len(got.Errors) != 1 || got.Errors[0].Field != "body" {
+		t.Errorf("problem = %+v", got)
+	}
+}
+
+func TestProblemTypesComplete(t *testing.T) {
+	for code, pt := range problemTypes {
+		if pt.status < 400 || pt.title == "" {
+			t.Errorf("%s: status %d, title %q", code, pt.status, pt.title)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package common
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validate checks v, a struct or pointer to one, against the rules in its
+// fields' validate tags and returns one FieldError per broken rule, or nil.
+// Nested structs are checked too, with dotted field names.
+//
+// Rules are comma separated:
+//
+//	required   the value must not be empty; strings must not be blank
+//	min=N      strings need N characters, slices N elements, numbers >= N
+//	max=N      strings at most N characters, slices N elements, numbers <= N
+//	email      the string must be a bare email address
+//	oneof=a b  the string must be one of the listed words
+//
+// Rules other than required are skipped for empty values, so optional
+// fields are only checked when present. An unknown rule panics.
+func Validate(v any) []FieldError {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs []FieldError
+	validateStruct(value, "", &errs)
+	return errs
+}
+
+func validateStruct(value reflect.Value, prefix string, errs *[]FieldError) {
+	t := value.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := jsonFieldName(field)
+		if name == "-" {
+			continue
+		}
+		name = prefix + name
+
+		fv := value.Field(i)
+		if tag, ok := field.Tag.Lookup("validate"); ok {
+			if fe, failed := validateField(fv, tag); failed {
+				fe.Field = name
+				*errs = append(*errs, fe)
+				continue
+			}
+		}
+
+		for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if fv.Kind() != reflect.Struct || !isPlainStruct(fv.Type()) {
+			continue
+		}
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			validateStruct(fv, prefix, errs)
+		} else {
+			validateStruct(fv, name+".", errs)
+		}
+	}
+}
+
+// isPlainStruct reports whether t is a struct we should descend into, as
+// opposed to a value type such as time.Time.
+func isPlainStruct(t reflect.Type) bool {
+	for i := range t.NumField() {
+		if t.Field(i).IsExported() {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// validateField applies tag's rules to v in order and reports the first one
+// that fails.
+func validateField(v reflect.Value, tag string) (FieldError, bool) {
+	empty := isEmpty(v)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "required" {
+			if empty {
+				return FieldError{Code: "required", Detail: "Is required"}, true
+			}
+			continue
+		}
+		if empty {
+			continue
+		}
+
+		switch name {
+		case "min", "max":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic(fmt.Sprintf("validate: bad %s rule %q", name, rule))
+			}
+			if fe, failed := checkBound(v, name, n); failed {
+				return fe, true
+			}
+		case "email":
+			addr, err := mail.ParseAddress(v.String())
+			if err != nil || addr.Address != v.String() {
+				return FieldError{Code: "email", Detail: "Must be a valid email address"}, true
+			}
+		case "oneof":
+			allowed := strings.Fields(arg)
+			if !slices.Contains(allowed, v.String()) {
+				return FieldError{Code: "oneof", Detail: "Must be one of " + strings.Join(allowed, ", ")}, true
+			}
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q", rule))
+		}
+	}
+	return FieldError{}, false
+}
+
+func checkBound(v reflect.Value, rule string, bound float64) (FieldError, bool) {
+	var size float64
+	var unit string
+	switch v.Kind() {
+	case reflect.String:
+		size, unit = float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size, unit = float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = v.Float()
+	default:
+		panic(fmt.Sprintf("validate: %s does not apply to %s", rule, v.Type()))
+	}
+
+	limit := strconv.FormatFloat(bound, 'f', -1, 64)
+	if rule == "min" && size < bound {
+		return FieldError{Code: "min", Detail: "Must be at least " + limit + unit}, true
+	}
+	if rule == "max" && size > bound {
+		return FieldError{Code: "max", Detail: "Must be at most " + limit + unit}, true
+	}
+	return FieldError{}, false
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	type data struct {
+		UserID string `json:"user_id" validate:"required"`
+	}
+	type payload struct {
+		Body      string     `json:"body" validate:"required,max=5"`
+		Tags      []string   `json:"tags" validate:"max=2"`
+		Count     int        `json:"count" validate:"min=1,max=10"`
+		Nickname  *string    `json:"nickname" validate:"min=3"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		Data      data       `json:"data"`
+		ignored   string     `validate:"required"`
+	}
+	short := "ab"
+
+	tests := []struct {
+		name  string
+		input payload
+		want  map[string]string
+	}{
+		{
+			name:  "valid",
+			input: payload{Body: "héllo", Count: 3, Data: data{UserID: "x"}},
+			want:  map[string]string{},
+		},
+		{
+			name:  "blank required",
+			input: payload{Body: "   ", Data: data{UserID: "x"}},
+			want:  map[string]string{"body": "required"},
+		},
+		{
+			name: "bounds",
+			input: payload{
+				Body:     "too long",
+				Tags:     []string{"a", "b", "c"},
+				Count:    11,
+				Nickname: &short,
+				Data:     data{UserID: "x"},
+			},
+			want: map[string]string{"body": "max", "tags": "max", "count": "max", "nickname": "min"},
+		},
+		{
+			name:  "nested",
+			input: payload{Body: "ok"},
+			want:  map[string]string{"data.user_id": "required"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]string{}
+			for _, fe := range Validate(&tt.input) {
+				got[fe.Field] = fe.Code
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("errors = %v, want %v", got, tt.want)
+			}
+			for field, code := range tt.want {
+				if got[field] != code {
+					t.Errorf("%s: code = %q, want %q", field, got[field], code)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	type params struct {
+		Email string `json:"email" validate:"email"`
+	}
+	for email, valid := range map[string]bool{
+		"":                        true,
+		"a@example.com":           true,
+		"not an email":            false,
+		"Name <a@example.com>":    false,
+		"a@example.com, b@ex.com": false,
+	} {
+		errs := Validate(params{Email: email})
+		if (errs == nil) != valid {
+			t.Errorf("%q: errors = %v, want valid %v", email, errs, valid)
+		}
+	}
+}
@@ -0,0 +1,581 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the server needs. Values are resolved from, in
+// increasing order of precedence: built-in defaults, the YAML file named by
+// CONFIG_FILE, a .env file in the working directory, and the process
+// environment. Any setting can instead be read from a file by setting
+// <NAME>_FILE, which takes precedence over <NAME>.
+type Config struct {
+	Platform  string
+	Port      string
+	DBURL     string
+	JWTSecret string
+	PolkaKey  string
+
+	AutoMigrate bool
+
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBConnMaxIdleTime time.Duration
+	// DBReplicaURLs lists Postgres read replicas that chirp reads are
+	// spread across. Each user's reads go to DB_URL for
+	// DBReadYourWritesWindow after they write.
+	DBReplicaURLs          []string
+	DBReadYourWritesWindow time.Duration
+	DBReplicaCheckInterval time.Duration
+
+	// ChirpCacheSize is how many chirp reads are cached in process memory.
+	// Zero turns the cache off.
+	ChirpCacheSize int
+	ChirpCacheTTL  time.Duration
+
+	LogFormat     string
+	LogLevel      string
+	TraceExporter string
+
+	JWTExpiresIn     time.Duration
+	RefreshExpiresIn time.Duration
+
+	TokenCleanupInterval time.Duration
+	TokenRetention       time.Duration
+	TokenCleanupBatch    int
+
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	ShutdownDelay     time.Duration
+
+	HealthCheckTimeout time.Duration
+
+	RateLimitStore string
+	// TrustedProxies lists the networks whose X-Forwarded-For headers are
+	// believed when working out a client's address for rate limiting.
+	TrustedProxies []netip.Prefix
+
+	IdempotencyStore     string
+	IdempotencyRetention time.Duration
+
+	// StreamBufferSize is how many recent chirp events are kept for
+	// clients resuming the event stream with Last-Event-ID, and
+	// StreamMaxSubscribers how many streams one instance keeps open.
+	StreamBufferSize        int
+	StreamMaxSubscribers    int
+	StreamHeartbeatInterval time.Duration
+}
+
+// Load resolves the configuration from the process environment and ./.env
+// and validates everything the HTTP server needs.
+func Load() (*Config, error) {
+	cfg, err := load(os.Environ(), ".env")
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadCommand is Load for admin commands, which talk to the database but never
+// sign tokens, so JWT_SECRET and POLKA_KEY may be left unset.
+func LoadCommand() (*Config, error) {
+	cfg, err := load(os.Environ(), ".env")
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(false); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func load(environ []string, dotenvPath string) (*Config, error) {
+	env := map[string]string{}
+	for _, kv := range environ {
+		key, value, ok := strings.Cut(kv, "=")
+		if ok {
+			env[key] = value
+		}
+	}
+
+	dotenv, err := godotenv.Read(dotenvPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading %s: %w", dotenvPath, err)
+	}
+
+	values := map[string]string{}
+	configFile := firstSet("CONFIG_FILE", env, dotenv)
+	if configFile != "" {
+		fileValues, err := readYAML(configFile)
+		if err != nil {
+			return nil, err
+		}
+		merge(values, fileValues)
+	}
+	merge(values, dotenv)
+	merge(values, env)
+
+	l := &loader{values: values}
+	cfg := &Config{
+		Platform:  l.string("PLATFORM", "prod"),
+		Port:      l.string("PORT", "8080"),
+		DBURL:     l.string("DB_URL", ""),
+		JWTSecret: l.string("JWT_SECRET", ""),
+		PolkaKey:  l.string("POLKA_KEY", ""),
+
+		AutoMigrate: l.bool("AUTO_MIGRATE", false),
+
+		DBMaxOpenConns:         l.int("DB_MAX_OPEN_CONNS", 25),
+		DBMaxIdleConns:         l.int("DB_MAX_IDLE_CONNS", 10),
+		DBConnMaxLifetime:      l.duration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+		DBConnMaxIdleTime:      l.duration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+		DBReplicaURLs:          l.list("DB_REPLICA_URLS"),
+		DBReadYourWritesWindow: l.duration("DB_READ_YOUR_WRITES_WINDOW", 5*time.Second),
+		DBReplicaCheckInterval: l.duration("DB_REPLICA_CHECK_INTERVAL", 5*time.Second),
+
+		ChirpCacheSize: l.int("CHIRP_CACHE_SIZE", 10000),
+		ChirpCacheTTL:  l.duration("CHIRP_CACHE_TTL", time.Minute),
+
+		LogFormat: l.string("LOG_FORMAT", "json"),
+		LogLevel:  l.string("LOG_LEVEL", "info"),
+
+		TraceExporter: l.string("TRACE_EXPORTER", "none"),
+
+		JWTExpiresIn:     l.duration("JWT_EXPIRES_IN", time.Hour),
+		RefreshExpiresIn: l.duration("REFRESH_EXPIRES_IN", 60*24*time.Hour),
+
+		TokenCleanupInterval: l.duration("TOKEN_CLEANUP_INTERVAL", time.Hour),
+		TokenRetention:       l.duration("TOKEN_RETENTION", 7*24*time.Hour),
+		TokenCleanupBatch:    l.int("TOKEN_CLEANUP_BATCH", 1000),
+
+		ReadHeaderTimeout: l.duration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       l.duration("HTTP_READ_TIMEOUT", 15*time.Second),
+		WriteTimeout:      l.duration("HTTP_WRITE_TIMEOUT", 15*time.Second),
+		IdleTimeout:       l.duration("HTTP_IDLE_TIMEOUT", 60*time.Second),
+		ShutdownTimeout:   l.duration("SHUTDOWN_TIMEOUT", 10*time.Second),
+		ShutdownDelay:     l.duration("SHUTDOWN_DELAY", 0),
+
+		HealthCheckTimeout: l.duration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+
+		RateLimitStore: l.string("RATE_LIMIT_STORE", "memory"),
+		TrustedProxies: l.prefixes("TRUSTED_PROXIES"),
+
+		IdempotencyStore:     l.string("IDEMPOTENCY_STORE", "memory"),
+		IdempotencyRetention: l.duration("IDEMPOTENCY_RETENTION", 24*time.Hour),
+
+		StreamBufferSize:        l.int("STREAM_BUFFER_SIZE", 1000),
+		StreamMaxSubscribers:    l.int("STREAM_MAX_SUBSCRIBERS", 1000),
+		StreamHeartbeatInterval: l.duration("STREAM_HEARTBEAT_INTERVAL", 15*time.Second),
+	}
+	if len(l.errs) > 0 {
+		return nil, errors.Join(l.errs...)
+	}
+
+	return cfg, nil
+}
+
+// Validate reports every missing or malformed setting at once.
+func (c *Config) Validate() error {
+	return c.validate(true)
+}
+
+func (c *Config) validate(requireSecrets bool) error {
+	var errs []error
+
+	if c.Platform != "dev" && c.Platform != "prod" {
+		errs = append(errs, fmt.Errorf("PLATFORM must be \"dev\" or \"prod\", got %q", c.Platform))
+	}
+
+	port, err := strconv.Atoi(c.Port)
+	if err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be a number between 1 and 65535, got %q", c.Port))
+	}
+
+	if c.DBURL == "" {
+		errs = append(errs, errors.New("DB_URL is required"))
+	} else if backend, err := database.Backend(c.DBURL); err != nil {
+		errs = append(errs, errors.New("DB_URL must be a postgres:// or sqlite: URL"))
+	} else if backend == database.BackendSQLite {
+		if c.RateLimitStore == "postgres" {
+			errs = append(errs, errors.New("RATE_LIMIT_STORE=postgres needs a postgres:// DB_URL"))
+		}
+		if c.IdempotencyStore == "postgres" {
+			errs = append(errs, errors.New("IDEMPOTENCY_STORE=postgres needs a postgres:// DB_URL"))
+		}
+		if len(c.DBReplicaURLs) > 0 {
+			errs = append(errs, errors.New("DB_REPLICA_URLS needs a postgres:// DB_URL"))
+		}
+	}
+	for i, replicaURL := range c.DBReplicaURLs {
+		if backend, err := database.Backend(replicaURL); err != nil || backend != database.BackendPostgres {
+			errs = append(errs, fmt.Errorf("DB_REPLICA_URLS entry %d must be a postgres:// URL", i+1))
+		}
+	}
+
+	if requireSecrets && c.JWTSecret == "" {
+		errs = append(errs, errors.New("JWT_SECRET is required"))
+	}
+	if requireSecrets && c.PolkaKey == "" {
+		errs = append(errs, errors.New("POLKA_KEY is required"))
+	}
+
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be \"json\" or \"text\", got %q", c.LogFormat))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL must be one of debug, info, warn or error, got %q", c.LogLevel))
+	}
+
+	switch c.TraceExporter {
+	case "none", "otlp", "stdout":
+	default:
+		errs = append(errs, fmt.Errorf("TRACE_EXPORTER must be one of none, otlp or stdout, got %q", c.TraceExporter))
+	}
+
+	switch c.RateLimitStore {
+	case "memory", "postgres", "none":
+	default:
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_STORE must be one of memory, postgres or none, got %q", c.RateLimitStore))
+	}
+
+	switch c.IdempotencyStore {
+	case "memory", "postgres", "none":
+	default:
+		errs = append(errs, fmt.Errorf("IDEMPOTENCY_STORE must be one of memory, postgres or none, got %q", c.IdempotencyStore))
+	}
+
+	if c.TokenCleanupBatch <= 0 || c.TokenCleanupBatch > math.MaxInt32 {
+		errs = append(errs, fmt.Errorf("TOKEN_CLEANUP_BATCH must be between 1 and %d, got %d", math.MaxInt32, c.TokenCleanupBatch))
+	}
+	if c.ChirpCacheSize < 0 {
+		errs = append(errs, fmt.Errorf("CHIRP_CACHE_SIZE must not be negative, got %d", c.ChirpCacheSize))
+	}
+	if c.StreamBufferSize <= 0 {
+		errs = append(errs, fmt.Errorf("STREAM_BUFFER_SIZE must be positive, got %d", c.StreamBufferSize))
+	}
+	if c.StreamMaxSubscribers <= 0 {
+		errs = append(errs, fmt.Errorf("STREAM_MAX_SUBSCRIBERS must be positive, got %d", c.StreamMaxSubscribers))
+	}
+	if c.DBMaxOpenConns < 0 {
+		errs = append(errs, fmt.Errorf("DB_MAX_OPEN_CONNS must not be negative, got %d", c.DBMaxOpenConns))
+	}
+	if c.DBMaxIdleConns < 0 {
+		errs = append(errs, fmt.Errorf("DB_MAX_IDLE_CONNS must not be negative, got %d", c.DBMaxIdleConns))
+	}
+
+	positive := map[string]time.Duration{
+		"JWT_EXPIRES_IN":            c.JWTExpiresIn,
+		"REFRESH_EXPIRES_IN":        c.RefreshExpiresIn,
+		"HTTP_READ_HEADER_TIMEOUT":  c.ReadHeaderTimeout,
+		"HTTP_READ_TIMEOUT":         c.ReadTimeout,
+		"HTTP_WRITE_TIMEOUT":        c.WriteTimeout,
+		"HTTP_IDLE_TIMEOUT":         c.IdleTimeout,
+		"SHUTDOWN_TIMEOUT":          c.ShutdownTimeout,
+		"HEALTH_CHECK_TIMEOUT":      c.HealthCheckTimeout,
+		"DB_REPLICA_CHECK_INTERVAL": c.DBReplicaCheckInterval,
+		"CHIRP_CACHE_TTL":           c.ChirpCacheTTL,
+		"IDEMPOTENCY_RETENTION":     c.IdempotencyRetention,
+		"STREAM_HEARTBEAT_INTERVAL": c.StreamHeartbeatInterval,
+	}
+	for _, key := range slices.Sorted(maps.Keys(positive)) {
+		if positive[key] <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", key, positive[key]))
+		}
+	}
+	if c.TokenCleanupInterval < 0 {
+		errs = append(errs, fmt.Errorf("TOKEN_CLEANUP_INTERVAL must not be negative, got %s", c.TokenCleanupInterval))
+	}
+	if c.ShutdownDelay < 0 {
+		errs = append(errs, fmt.Errorf("SHUTDOWN_DELAY must not be negative, got %s", c.ShutdownDelay))
+	}
+	if c.TokenRetention < 0 {
+		errs = append(errs, fmt.Errorf("TOKEN_RETENTION must not be negative, got %s", c.TokenRetention))
+	}
+	nonNegative := map[string]time.Duration{
+		"DB_CONN_MAX_LIFETIME":       c.DBConnMaxLifetime,
+		"DB_CONN_MAX_IDLE_TIME":      c.DBConnMaxIdleTime,
+		"DB_READ_YOUR_WRITES_WINDOW": c.DBReadYourWritesWindow,
+	}
+	for _, key := range slices.Sorted(maps.Keys(nonNegative)) {
+		if nonNegative[key] < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %s", key, nonNegative[key]))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// String renders the effective configuration with secrets redacted so it can
+// be logged at startup.
+func (c *Config) String() string {
+	lines := []string{}
+	for _, setting := range c.redacted() {
+		lines = append(lines, setting[0]+"="+setting[1])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// LogValue implements slog.LogValuer with the same redaction as String.
+func (c *Config) LogValue() slog.Value {
+	attrs := []slog.Attr{}
+	for _, setting := range c.redacted() {
+		attrs = append(attrs, slog.String(setting[0], setting[1]))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func (c *Config) redacted() [][2]string {
+	replicaURLs := make([]string, 0, len(c.DBReplicaURLs))
+	for _, replicaURL := range c.DBReplicaURLs {
+		replicaURLs = append(replicaURLs, redactURL(replicaURL))
+	}
+
+	return [][2]string{
+		{"PLATFORM", c.Platform},
+		{"PORT", c.Port},
+		{"DB_URL", redactURL(c.DBURL)},
+		{"JWT_SECRET", redact(c.JWTSecret)},
+		{"POLKA_KEY", redact(c.PolkaKey)},
+		{"AUTO_MIGRATE", strconv.FormatBool(c.AutoMigrate)},
+		{"DB_MAX_OPEN_CONNS", strconv.Itoa(c.DBMaxOpenConns)},
+		{"DB_MAX_IDLE_CONNS", strconv.Itoa(c.DBMaxIdleConns)},
+		{"DB_CONN_MAX_LIFETIME", c.DBConnMaxLifetime.String()},
+		{"DB_CONN_MAX_IDLE_TIME", c.DBConnMaxIdleTime.String()},
+		{"DB_REPLICA_URLS", strings.Join(replicaURLs, ",")},
+		{"DB_READ_YOUR_WRITES_WINDOW", c.DBReadYourWritesWindow.String()},
+		{"DB_REPLICA_CHECK_INTERVAL", c.DBReplicaCheckInterval.String()},
+		{"CHIRP_CACHE_SIZE", strconv.Itoa(c.ChirpCacheSize)},
+		{"CHIRP_CACHE_TTL", c.ChirpCacheTTL.String()},
+		{"LOG_FORMAT", c.LogFormat},
+		{"LOG_LEVEL", c.LogLevel},
+		{"TRACE_EXPORTER", c.TraceExporter},
+		{"JWT_EXPIRES_IN", c.JWTExpiresIn.String()},
+		{"REFRESH_EXPIRES_IN", c.RefreshExpiresIn.String()},
+		{"TOKEN_CLEANUP_INTERVAL", c.TokenCleanupInterval.String()},
+		{"TOKEN_RETENTION", c.TokenRetention.String()},
+		{"TOKEN_CLEANUP_BATCH", strconv.Itoa(c.TokenCleanupBatch)},
+		{"HTTP_READ_HEADER_TIMEOUT", c.ReadHeaderTimeout.String()},
+		{"HTTP_READ_TIMEOUT", c.ReadTimeout.String()},
+		{"HTTP_WRITE_TIMEOUT", c.WriteTimeout.String()},
+		{"HTTP_IDLE_TIMEOUT", c.IdleTimeout.String()},
+		{"SHUTDOWN_TIMEOUT", c.ShutdownTimeout.String()},
+		{"SHUTDOWN_DELAY", c.ShutdownDelay.String()},
+		{"HEALTH_CHECK_TIMEOUT", c.HealthCheckTimeout.String()},
+		{"RATE_LIMIT_STORE", c.RateLimitStore},
+		{"TRUSTED_PROXIES", joinPrefixes(c.TrustedProxies)},
+		{"IDEMPOTENCY_STORE", c.IdempotencyStore},
+		{"IDEMPOTENCY_RETENTION", c.IdempotencyRetention.String()},
+		{"STREAM_BUFFER_SIZE", strconv.Itoa(c.StreamBufferSize)},
+		{"STREAM_MAX_SUBSCRIBERS", strconv.Itoa(c.StreamMaxSubscribers)},
+		{"STREAM_HEARTBEAT_INTERVAL", c.StreamHeartbeatInterval.String()},
+	}
+}
+
+type loader struct {
+	values map[string]string
+	errs   []error
+}
+
+func (l *loader) lookup(key string) (string, bool) {
+	if path, ok := l.values[key+"_FILE"]; ok && path != "" {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Errorf("%s_FILE: %w", key, err))
+			return "", false
+		}
+		return strings.TrimSpace(string(contents)), true
+	}
+	value, ok := l.values[key]
+	return value, ok && value != ""
+}
+
+func (l *loader) string(key, fallback string) string {
+	value, ok := l.lookup(key)
+	if !ok {
+		return fallback
+	}
+	return value
+}
+
+func (l *loader) duration(key string, fallback time.Duration) time.Duration {
+	value, ok := l.lookup(key)
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s must be a duration such as \"30s\", got %q", key, value))
+		return fallback
+	}
+	return d
+}
+
+func (l *loader) int(key string, fallback int) int {
+	value, ok := l.lookup(key)
+	if !ok {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s must be an integer, got %q", key, value))
+		return fallback
+	}
+	return n
+}
+
+func (l *loader) bool(key string, fallback bool) bool {
+	value, ok := l.lookup(key)
+	if !ok {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s must be true or false, got %q", key, value))
+		return fallback
+	}
+	return b
+}
+
+// list reads a comma separated list, skipping empty entries.
+func (l *loader) list(key string) []string {
+	value, ok := l.lookup(key)
+	if !ok {
+		return nil
+	}
+	var items []string
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			items = append(items, field)
+		}
+	}
+	return items
+}
+
+// prefixes reads a comma separated list of CIDR networks. Bare addresses are
+// accepted as single-host networks.
+func (l *loader) prefixes(key string) []netip.Prefix {
+	value, ok := l.lookup(key)
+	if !ok {
+		return nil
+	}
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(field)
+			if addrErr != nil {
+				l.errs = append(l.errs, fmt.Errorf("%s must be a comma separated list of CIDR networks, got %q", key, field))
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+func joinPrefixes(prefixes []netip.Prefix) string {
+	fields := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		fields = append(fields, prefix.String())
+	}
+	return strings.Join(fields, ",")
+}
+
+// readYAML reads a flat YAML mapping. Keys are matched case-insensitively
+// against the environment variable names, so "db_url" sets DB_URL.
+func readYAML(path string) (map[string]string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	raw := map[string]any{}
+	if err := yaml.Unmarshal(contents, &raw); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	for key, value := range raw {
+		switch value.(type) {
+		case nil:
+			// A key with no value leaves the setting to the layers below.
+			continue
+		case map[string]any, []any:
+			return nil, fmt.Errorf("config file %s: %s must be a scalar value", path, key)
+		}
+		values[strings.ToUpper(key)] = fmt.Sprint(value)
+	}
+	return values, nil
+}
+
+func merge(dst, src map[string]string) {
+	for key, value := range src {
+		dst[key] = value
+	}
+}
+
+func firstSet(key string, layers ...map[string]string) string {
+	for _, layer := range layers {
+		if value := layer[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// secretParams are the connection parameters a database URL may carry
+// secrets in.
+var secretParams = []string{"password", "sslpassword", "sslkey"}
+
+// redactURL hides the password in a database URL, whether in the userinfo
+// or in the query. Anything that is not a URL, such as a key/value DSN, is
+// hidden whole.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return "<redacted>"
+	}
+	query := u.Query()
+	for _, param := range secretParams {
+		if query.Has(param) {
+			query.Set(param, "xxxxx")
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.Redacted()
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
+}
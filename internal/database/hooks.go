@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// ChirpWrite is a chirp created or deleted through a HookStore. A deleted
+// chirp carries its ID and author, or only its ID if it could not be read
+// before the delete.
+type ChirpWrite struct {
+	Deleted bool
+	Chirp   Chirp
+}
+
+// HookStore passes the chirp writes made through it to onCommit once they
+// have committed: straight after a write outside a transaction, and after
+// InTx returns for the writes of a transaction. Rolled back writes are
+// never passed on. Writes made by other processes, such as the admin
+// commands, are not seen.
+type HookStore struct {
+	TxStore
+	onCommit func(context.Context, []ChirpWrite)
+}
+
+var _ TxStore = (*HookStore)(nil)
+
+func NewHookStore(store TxStore, onCommit func(context.Context, []ChirpWrite)) *HookStore {
+	return &HookStore{TxStore: store, onCommit: onCommit}
+}
+
+func (s *HookStore) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
+	w := &hookWrites{Store: s.TxStore}
+	defer s.commit(ctx, w)
+	return w.CreateChirp(ctx, arg)
+}
+
+func (s *HookStore) DeleteChirpById(ctx context.Context, arg DeleteChirpByIdParams) error {
+	w := &hookWrites{Store: s.TxStore}
+	defer s.commit(ctx, w)
+	return w.DeleteChirpById(ctx, arg)
+}
+
+func (s *HookStore) DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	w := &hookWrites{Store: s.TxStore}
+	defer s.commit(ctx, w)
+	return w.DeleteChirp(ctx, id)
+}
+
+func (s *HookStore) InTx(ctx context.Context, fn func(Store) error) error {
+	var w *hookWrites
+	err := s.TxStore.InTx(ctx, func(tx Store) error {
+		// A retried transaction starts over, and so do its writes.
+		w = &hookWrites{Store: tx}
+		return fn(w)
+	})
+	if err == nil && w != nil {
+		s.commit(ctx, w)
+	}
+	return err
+}
+
+func (s *HookStore) commit(ctx context.Context, w *hookWrites) {
+	if len(w.writes) > 0 {
+		s.onCommit(ctx, w.writes)
+	}
+}
+
+// hookWrites wraps the chirp writes of a Store to note the ones that
+// succeeded.
+type hookWrites struct {
+	Store
+	writes []ChirpWrite
+}
+
+func (w *hookWrites) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
+	chirp, err := w.Store.CreateChirp(ctx, arg)
+	if err == nil {
+		w.writes = append(w.writes, ChirpWrite{Chirp: chirp})
+	}
+	return chirp, err
+}
+
+func (w *hookWrites) DeleteChirpById(ctx context.Context, arg DeleteChirpByIdParams) error {
+	err := w.Store.DeleteChirpById(ctx, arg)
+	if err == nil {
+		w.writes = append(w.writes, ChirpWrite{Deleted: true, Chirp: Chirp{ID: arg.ID, UserID: arg.UserID}})
+	}
+	return err
+}
+
+func (w *hookWrites) DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	// Hooks want the author too, and only the chirp knows who that is.
+	chirp, lookupErr := w.Store.GetChirpById(WithPrimary(ctx), id)
+	deleted, err := w.Store.DeleteChirp(ctx, id)
+	if err == nil && deleted > 0 {
+		if lookupErr != nil {
+			chirp = Chirp{ID: id}
+		}
+		w.writes = append(w.writes, ChirpWrite{Deleted: true, Chirp: chirp})
+	}
+	return deleted, err
+}
@@ -0,0 +1,512 @@
+// Package memory is an in-process database.Store for tests. It mirrors the
+// Postgres schema's constraints: unique emails, tokens and token hashes,
+// foreign keys to users and cascading deletes.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Store keeps rows in insertion order, which also serves as the tie-break
+// when two rows share a created_at.
+type Store struct {
+	txMu sync.Mutex
+
+	mu            sync.Mutex
+	users         []database.User
+	chirps        []database.Chirp
+	refreshTokens []database.RefreshToken
+	pats          []database.PersonalAccessToken
+	follows       []database.Follow
+
+	now func() time.Time
+}
+
+var _ database.TxStore = (*Store)(nil)
+
+func New() *Store {
+	return &Store{now: time.Now}
+}
+
+// timestamp mimics a Postgres timestamp column: UTC with microsecond
+// precision.
+func (s *Store) timestamp() time.Time {
+	return s.now().UTC().Truncate(time.Microsecond)
+}
+
+func (s *Store) userIndex(id uuid.UUID) int {
+	return slices.IndexFunc(s.users, func(u database.User) bool { return u.ID == id })
+}
+
+func (s *Store) requireUser(id uuid.UUID) error {
+	if s.userIndex(id) < 0 {
+		return fmt.Errorf("memory: user %s does not exist", id)
+	}
+	return nil
+}
+
+func (s *Store) emailTaken(email string, except uuid.UUID) bool {
+	return slices.ContainsFunc(s.users, func(u database.User) bool { return u.Email == email && u.ID != except })
+}
+
+func sortByCreatedAt[T any](rows []T, createdAt func(T) time.Time) []T {
+	rows = slices.Clone(rows)
+	slices.SortStableFunc(rows, func(a, b T) int { return createdAt(a).Compare(createdAt(b)) })
+	return rows
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.emailTaken(arg.Email, uuid.Nil) {
+		return database.User{}, fmt.Errorf("memory: email %q: %w", arg.Email, database.ErrUniqueViolation)
+	}
+	now := s.timestamp()
+	user := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Role:           auth.RoleUser,
+	}
+	s.users = append(s.users, user)
+	return user, nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.users, func(u database.User) bool { return u.Email == email })
+	if i < 0 {
+		return database.User{}, sql.ErrNoRows
+	}
+	return s.users[i], nil
+}
+
+func (s *Store) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.userIndex(id)
+	if i < 0 {
+		return database.User{}, sql.ErrNoRows
+	}
+	return s.users[i], nil
+}
+
+// updateUser applies fn to the user with id and returns the updated row.
+func (s *Store) updateUser(id uuid.UUID, fn func(*database.User) error) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.userIndex(id)
+	if i < 0 {
+		return database.User{}, sql.ErrNoRows
+	}
+	user := s.users[i]
+	if err := fn(&user); err != nil {
+		return database.User{}, err
+	}
+	user.UpdatedAt = s.timestamp()
+	s.users[i] = user
+	return user, nil
+}
+
+func (s *Store) UpdateUserById(ctx context.Context, arg database.UpdateUserByIdParams) (database.User, error) {
+	return s.updateUser(arg.ID, func(u *database.User) error {
+		if s.emailTaken(arg.Email, arg.ID) {
+			return fmt.Errorf("memory: email %q: %w", arg.Email, database.ErrUniqueViolation)
+		}
+		u.Email = arg.Email
+		u.HashedPassword = arg.HashedPassword
+		return nil
+	})
+}
+
+func (s *Store) UpgradeUserById(ctx context.Context, arg database.UpgradeUserByIdParams) (database.User, error) {
+	return s.updateUser(arg.ID, func(u *database.User) error {
+		u.IsChirpyRed = arg.IsChirpyRed
+		return nil
+	})
+}
+
+func (s *Store) ListUsers(ctx context.Context) ([]database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sortByCreatedAt(s.users, func(u database.User) time.Time { return u.CreatedAt }), nil
+}
+
+func (s *Store) DisableUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return s.updateUser(id, func(u *database.User) error {
+		u.DisabledAt = sql.NullTime{Time: s.timestamp(), Valid: true}
+		return nil
+	})
+}
+
+func (s *Store) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (database.User, error) {
+	return s.updateUser(arg.ID, func(u *database.User) error {
+		if !auth.ValidRole(arg.Role) {
+			return fmt.Errorf("memory: role %q violates users_role_check", arg.Role)
+		}
+		u.Role = arg.Role
+		return nil
+	})
+}
+
+func (s *Store) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.requireUser(arg.UserID); err != nil {
+		return database.Chirp{}, err
+	}
+	now := s.timestamp()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		Body:      arg.Body,
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    arg.UserID,
+	}
+	s.chirps = append(s.chirps, chirp)
+	return chirp, nil
+}
+
+func (s *Store) GetChirps(ctx context.Context) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sortByCreatedAt(s.chirps, func(c database.Chirp) time.Time { return c.CreatedAt }), nil
+}
+
+func (s *Store) GetChirpById(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.chirps, func(c database.Chirp) bool { return c.ID == id })
+	if i < 0 {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return s.chirps[i], nil
+}
+
+func (s *Store) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chirps := []database.Chirp{}
+	for _, c := range s.chirps {
+		if c.UserID == userID {
+			chirps = append(chirps, c)
+		}
+	}
+	return sortByCreatedAt(chirps, func(c database.Chirp) time.Time { return c.CreatedAt }), nil
+}
+
+func (s *Store) DeleteChirpById(ctx context.Context, arg database.DeleteChirpByIdParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.chirps = slices.DeleteFunc(s.chirps, func(c database.Chirp) bool { return c.ID == arg.ID && c.UserID == arg.UserID })
+	return nil
+}
+
+func (s *Store) DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := len(s.chirps)
+	s.chirps = slices.DeleteFunc(s.chirps, func(c database.Chirp) bool { return c.ID == id })
+	return int64(before - len(s.chirps)), nil
+}
+
+func (s *Store) FollowUser(ctx context.Context, arg database.FollowUserParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.requireUser(arg.FollowerID); err != nil {
+		return err
+	}
+	if err := s.requireUser(arg.FolloweeID); err != nil {
+		return err
+	}
+	if arg.FollowerID == arg.FolloweeID {
+		return fmt.Errorf("memory: user %s cannot follow themselves", arg.FollowerID)
+	}
+	if slices.ContainsFunc(s.follows, func(f database.Follow) bool {
+		return f.FollowerID == arg.FollowerID && f.FolloweeID == arg.FolloweeID
+	}) {
+		return nil
+	}
+	s.follows = append(s.follows, database.Follow{
+		FollowerID: arg.FollowerID,
+		FolloweeID: arg.FolloweeID,
+		CreatedAt:  s.timestamp(),
+	})
+	return nil
+}
+
+func (s *Store) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	s.follows = slices.DeleteFunc(s.follows, func(f database.Follow) bool {
+		if f.FollowerID == arg.FollowerID && f.FolloweeID == arg.FolloweeID {
+			deleted++
+			return true
+		}
+		return false
+	})
+	return deleted, nil
+}
+
+func (s *Store) GetFollowedUserIds(ctx context.Context, followerID uuid.UUID) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var follows []database.Follow
+	for _, f := range s.follows {
+		if f.FollowerID == followerID {
+			follows = append(follows, f)
+		}
+	}
+	var ids []uuid.UUID
+	for _, f := range sortByCreatedAt(follows, func(f database.Follow) time.Time { return f.CreatedAt }) {
+		ids = append(ids, f.FolloweeID)
+	}
+	return ids, nil
+}
+
+func (s *Store) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.requireUser(arg.UserID); err != nil {
+		return database.RefreshToken{}, err
+	}
+	if slices.ContainsFunc(s.refreshTokens, func(t database.RefreshToken) bool { return t.Token == arg.Token }) {
+		return database.RefreshToken{}, fmt.Errorf("memory: refresh token: %w", database.ErrUniqueViolation)
+	}
+	now := s.timestamp()
+	token := database.RefreshToken{
+		Token:     arg.Token,
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt.UTC(),
+	}
+	s.refreshTokens = append(s.refreshTokens, token)
+	return token, nil
+}
+
+func (s *Store) GetRefreshByToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.refreshTokens, func(t database.RefreshToken) bool { return t.Token == token })
+	if i < 0 {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return s.refreshTokens[i], nil
+}
+
+func (s *Store) RevokeRefreshByToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.refreshTokens, func(t database.RefreshToken) bool { return t.Token == token })
+	if i < 0 {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	now := s.timestamp()
+	s.refreshTokens[i].RevokedAt = sql.NullTime{Time: now, Valid: true}
+	s.refreshTokens[i].UpdatedAt = now
+	return s.refreshTokens[i], nil
+}
+
+func (s *Store) RevokeRefreshTokensByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timestamp()
+	var revoked int64
+	for i, t := range s.refreshTokens {
+		if t.UserID == userID && !t.RevokedAt.Valid {
+			s.refreshTokens[i].RevokedAt = sql.NullTime{Time: now, Valid: true}
+			s.refreshTokens[i].UpdatedAt = now
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (s *Store) DeleteStaleRefreshTokens(ctx context.Context, arg database.DeleteStaleRefreshTokensParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timestamp()
+	var deleted int64
+	s.refreshTokens = slices.DeleteFunc(s.refreshTokens, func(t database.RefreshToken) bool {
+		if deleted >= int64(arg.BatchSize) {
+			return false
+		}
+		stale := t.ExpiresAt.Before(now) || t.RevokedAt.Valid && t.RevokedAt.Time.Before(arg.RevokedBefore)
+		if stale {
+			deleted++
+		}
+		return stale
+	})
+	return deleted, nil
+}
+
+func (s *Store) CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.PersonalAccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.requireUser(arg.UserID); err != nil {
+		return database.PersonalAccessToken{}, err
+	}
+	if slices.ContainsFunc(s.pats, func(p database.PersonalAccessToken) bool { return p.TokenHash == arg.TokenHash }) {
+		return database.PersonalAccessToken{}, fmt.Errorf("memory: token hash: %w", database.ErrUniqueViolation)
+	}
+	now := s.timestamp()
+	pat := database.PersonalAccessToken{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		Scopes:    slices.Clone(arg.Scopes),
+		ExpiresAt: arg.ExpiresAt,
+	}
+	s.pats = append(s.pats, pat)
+	return pat, nil
+}
+
+func (s *Store) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (database.GetPersonalAccessTokenByHashRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.pats, func(p database.PersonalAccessToken) bool { return p.TokenHash == tokenHash })
+	if i < 0 {
+		return database.GetPersonalAccessTokenByHashRow{}, sql.ErrNoRows
+	}
+	pat := s.pats[i]
+	user := s.users[s.userIndex(pat.UserID)]
+	return database.GetPersonalAccessTokenByHashRow{
+		ID:             pat.ID,
+		CreatedAt:      pat.CreatedAt,
+		UpdatedAt:      pat.UpdatedAt,
+		UserID:         pat.UserID,
+		Name:           pat.Name,
+		TokenHash:      pat.TokenHash,
+		Scopes:         slices.Clone(pat.Scopes),
+		ExpiresAt:      pat.ExpiresAt,
+		LastUsedAt:     pat.LastUsedAt,
+		RevokedAt:      pat.RevokedAt,
+		Role:           user.Role,
+		UserDisabledAt: user.DisabledAt,
+	}, nil
+}
+
+func (s *Store) ListPersonalAccessTokensByUser(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pats := []database.PersonalAccessToken{}
+	for _, p := range s.pats {
+		if p.UserID == userID && !p.RevokedAt.Valid {
+			pats = append(pats, p)
+		}
+	}
+	return sortByCreatedAt(pats, func(p database.PersonalAccessToken) time.Time { return p.CreatedAt }), nil
+}
+
+func (s *Store) RevokePersonalAccessToken(ctx context.Context, arg database.RevokePersonalAccessTokenParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.pats, func(p database.PersonalAccessToken) bool {
+		return p.ID == arg.ID && p.UserID == arg.UserID && !p.RevokedAt.Valid
+	})
+	if i < 0 {
+		return 0, nil
+	}
+	now := s.timestamp()
+	s.pats[i].RevokedAt = sql.NullTime{Time: now, Valid: true}
+	s.pats[i].UpdatedAt = now
+	return 1, nil
+}
+
+func (s *Store) TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timestamp()
+	for i, p := range s.pats {
+		if p.ID == id && (!p.LastUsedAt.Valid || p.LastUsedAt.Time.Before(now.Add(-time.Minute))) {
+			s.pats[i].LastUsedAt = sql.NullTime{Time: now, Valid: true}
+		}
+	}
+	return nil
+}
+
+// Reset deletes every user and, as the foreign keys cascade, everything
+// they own.
+func (s *Store) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		s.deleteOwnedBy(u.ID)
+	}
+	s.users = nil
+	return nil
+}
+
+// InTx runs fn against s and puts every row back if fn fails. Transactions
+// run one at a time, but single queries from outside one are not held back
+// and may see or lose its writes: enough for tests, which do not race
+// transactions against plain queries.
+func (s *Store) InTx(ctx context.Context, fn func(database.Store) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	users, chirps := slices.Clone(s.users), slices.Clone(s.chirps)
+	refreshTokens, pats := slices.Clone(s.refreshTokens), slices.Clone(s.pats)
+	follows := slices.Clone(s.follows)
+	s.mu.Unlock()
+
+	if err := fn(s); err != nil {
+		s.mu.Lock()
+		s.users, s.chirps = users, chirps
+		s.refreshTokens, s.pats = refreshTokens, pats
+		s.follows = follows
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (s *Store) deleteOwnedBy(userID uuid.UUID) {
+	s.chirps = slices.DeleteFunc(s.chirps, func(c database.Chirp) bool { return c.UserID == userID })
+	s.refreshTokens = slices.DeleteFunc(s.refreshTokens, func(t database.RefreshToken) bool { return t.UserID == userID })
+	s.pats = slices.DeleteFunc(s.pats, func(p database.PersonalAccessToken) bool { return p.UserID == userID })
+	s.follows = slices.DeleteFunc(s.follows, func(f database.Follow) bool { return f.FollowerID == userID || f.FolloweeID == userID })
+}
@@ -6,6 +6,7 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,6 +20,75 @@ type Chirp struct {
 	UserID    uuid.UUID
 }
 
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type IdempotencyKey struct {
+	Scope          string
+	Key            string
+	Fingerprint    string
+	ResponseStatus int32
+	ResponseHeader json.RawMessage
+	ResponseBody   []byte
+	CreatedAt      time.Time
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	ClientID      string
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+type OauthClient struct {
+	ID           string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+}
+
+type OauthGrant struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ClientID  string
+	UserID    uuid.UUID
+	TokenHash string
+	Scopes    []string
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	Allowed   bool
+	UpdatedAt time.Time
+}
+
 type RefreshToken struct {
 	Token     string
 	CreatedAt time.Time
@@ -35,4 +105,6 @@ type User struct {
 	Email          string
 	HashedPassword string
 	IsChirpyRed    bool
+	DisabledAt     sql.NullTime
+	Role           string
 }
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// Backends that DB_URL can select by its scheme.
+const (
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+)
+
+// sqlitePragmas are applied to every SQLite connection. SQLite leaves
+// foreign keys off by default, and without them deletes would not cascade.
+var sqlitePragmas = []string{
+	"foreign_keys(1)",
+	"journal_mode(WAL)",
+	"busy_timeout(5000)",
+}
+
+// Backend returns which backend dbURL selects: postgres:// and
+// postgresql:// URLs pick Postgres, sqlite: URLs pick SQLite.
+func Backend(dbURL string) (string, error) {
+	scheme, _, ok := strings.Cut(dbURL, ":")
+	if ok {
+		switch scheme {
+		case "postgres", "postgresql":
+			return BackendPostgres, nil
+		case "sqlite":
+			return BackendSQLite, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported database URL scheme %q", scheme)
+}
+
+// Pool sizes a Postgres connection pool. Zero MaxOpenConns, ConnMaxLifetime
+// and ConnMaxIdleTime mean no limit, as in database/sql.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Apply configures db with p.
+func (p Pool) Apply(db *sql.DB) {
+	db.SetMaxOpenConns(p.MaxOpenConns)
+	db.SetMaxIdleConns(p.MaxIdleConns)
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+}
+
+// dsnConnector opens connections with a driver that has no Connector of
+// its own, as sql.Open does.
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Open opens dbURL with the driver for its backend. SQLite URLs name a file,
+// as in sqlite:chirpy.db or sqlite:///var/lib/chirpy/chirpy.db, and may
+// carry the driver's own query parameters. wrap, if not nil, wraps the
+// driver's connector.
+func Open(dbURL string, wrap func(driver.Connector) driver.Connector) (*sql.DB, string, error) {
+	backend, err := Backend(dbURL)
+	if err != nil {
+		return nil, "", err
+	}
+	if wrap == nil {
+		wrap = func(c driver.Connector) driver.Connector { return c }
+	}
+
+	if backend == BackendPostgres {
+		connector, err := pq.NewConnector(dbURL)
+		if err != nil {
+			return nil, "", err
+		}
+		return sql.OpenDB(wrap(connector)), backend, nil
+	}
+
+	path, query, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(dbURL, "sqlite:"), "//"), "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, "", fmt.Errorf("parsing sqlite URL: %w", err)
+	}
+	for _, pragma := range sqlitePragmas {
+		params.Add("_pragma", pragma)
+	}
+	params.Set("_time_format", "sqlite")
+
+	db := sql.OpenDB(wrap(dsnConnector{dsn: path + "?" + params.Encode(), driver: &sqlite.Driver{}}))
+	// SQLite allows one writer at a time. A single connection serialises
+	// writes in the pool instead of failing them with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	return db, backend, nil
+}
@@ -0,0 +1,433 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/pgtest"
+	"github.com/google/uuid"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(pgtest.Main(m))
+}
+
+func newQueries(t *testing.T) *database.Queries {
+	t.Helper()
+	t.Parallel()
+	return database.New(pgtest.DB(t))
+}
+
+func createUser(t *testing.T, q *database.Queries, email string) database.User {
+	t.Helper()
+	user, err := q.CreateUser(context.Background(), database.CreateUserParams{Email: email, HashedPassword: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser(%q) error = %v", email, err)
+	}
+	return user
+}
+
+func TestUserQueries(t *testing.T) {
+	q := newQueries(t)
+	ctx := context.Background()
+
+	alice := createUser(t, q, "alice@example.com")
+	if alice.ID == uuid.Nil || alice.CreatedAt.IsZero() || alice.Role != "user" || alice.IsChirpyRed || alice.DisabledAt.Valid {
+		t.Errorf("CreateUser() = %+v, want a new plain user", alice)
+	}
+	bob := createUser(t, q, "bob@example.com")
+
+	if _, err := q.CreateUser(ctx, database.CreateUserParams{Email: "alice@example.com", HashedPassword: "hash"}); !database.IsUniqueViolation(err) {
+		t.Errorf("CreateUser() with a taken email error = %v, want a unique violation", err)
+	}
+
+	got, err := q.GetUserByEmail(ctx, "alice@example.com")
+	if err != nil || got.ID != alice.ID {
+		t.Errorf("GetUserByEmail() = %v, %v, want %v", got.ID, err, alice.ID)
+	}
+	got, err = q.GetUserById(ctx, bob.ID)
+	if err != nil || got.Email != bob.Email {
+		t.Errorf("GetUserById() = %q, %v, want %q", got.Email, err, bob.Email)
+	}
+	if _, err := q.GetUserById(ctx, uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserById() for a missing user error = %v, want sql.ErrNoRows", err)
+	}
+
+	updated, err := q.UpdateUserById(ctx, database.UpdateUserByIdParams{Email: "alice@example.org", HashedPassword: "new-hash", ID: alice.ID})
+	if err != nil || updated.Email != "alice@example.org" || updated.HashedPassword != "new-hash" || updated.UpdatedAt.Before(alice.UpdatedAt) {
+		t.Errorf("UpdateUserById() = %+v, %v", updated, err)
+	}
+	if _, err := q.UpdateUserById(ctx, database.UpdateUserByIdParams{Email: bob.Email, HashedPassword: "hash", ID: alice.ID}); !database.IsUniqueViolation(err) {
+		t.Errorf("UpdateUserById() to a taken email error = %v, want a unique violation", err)
+	}
+
+	upgraded, err := q.UpgradeUserById(ctx, database.UpgradeUserByIdParams{IsChirpyRed: true, ID: bob.ID})
+	if err != nil || !upgraded.IsChirpyRed {
+		t.Errorf("UpgradeUserById() = %+v, %v, want Chirpy Red", upgraded, err)
+	}
+
+	promoted, err := q.SetUserRole(ctx, database.SetUserRoleParams{Role: "moderator", ID: bob.ID})
+	if err != nil || promoted.Role != "moderator" {
+		t.Errorf("SetUserRole() = %q, %v, want moderator", promoted.Role, err)
+	}
+	if _, err := q.SetUserRole(ctx, database.SetUserRoleParams{Role: "owner", ID: bob.ID}); err == nil {
+		t.Error("SetUserRole() with an unknown role succeeded, want a check violation")
+	}
+
+	disabled, err := q.DisableUserById(ctx, alice.ID)
+	if err != nil || !disabled.DisabledAt.Valid {
+		t.Errorf("DisableUserById() = %+v, %v, want disabled_at set", disabled, err)
+	}
+
+	users, err := q.ListUsers(ctx)
+	if err != nil {
+		t.Fatalf("ListUsers() error = %v", err)
+	}
+	if len(users) != 2 || users[0].ID != alice.ID || users[1].ID != bob.ID {
+		t.Errorf("ListUsers() = %v, want alice then bob", users)
+	}
+}
+
+func TestChirpQueries(t *testing.T) {
+	q := newQueries(t)
+	ctx := context.Background()
+	alice := createUser(t, q, "alice@example.com")
+	bob := createUser(t, q, "bob@example.com")
+
+	var created []database.Chirp
+	for _, author := range []database.User{alice, bob, alice} {
+		chirp, err := q.CreateChirp(ctx, database.CreateChirpParams{Body: "hello from " + author.Email, UserID: author.ID})
+		if err != nil {
+			t.Fatalf("CreateChirp() error = %v", err)
+		}
+		created = append(created, chirp)
+	}
+	if _, err := q.CreateChirp(ctx, database.CreateChirpParams{Body: "orphan", UserID: uuid.New()}); err == nil {
+		t.Error("CreateChirp() for a missing user succeeded, want a foreign key violation")
+	}
+
+	all, err := q.GetChirps(ctx)
+	if err != nil || len(all) != 3 || all[0].ID != created[0].ID || all[2].ID != created[2].ID {
+		t.Errorf("GetChirps() = %v, %v, want all three in order", all, err)
+	}
+	byAlice, err := q.GetChirpsByAuthor(ctx, alice.ID)
+	if err != nil || len(byAlice) != 2 || byAlice[0].ID != created[0].ID || byAlice[1].ID != created[2].ID {
+		t.Errorf("GetChirpsByAuthor() = %v, %v, want alice's two chirps", byAlice, err)
+	}
+	got, err := q.GetChirpById(ctx, created[1].ID)
+	if err != nil || got.Body != created[1].Body {
+		t.Errorf("GetChirpById() = %+v, %v", got, err)
+	}
+
+	// DeleteChirpById only deletes the author's own chirp.
+	if err := q.DeleteChirpById(ctx, database.DeleteChirpByIdParams{ID: created[1].ID, UserID: alice.ID}); err != nil {
+		t.Fatalf("DeleteChirpById() error = %v", err)
+	}
+	if _, err := q.GetChirpById(ctx, created[1].ID); err != nil {
+		t.Errorf("DeleteChirpById() removed someone else's chirp: %v", err)
+	}
+	if err := q.DeleteChirpById(ctx, database.DeleteChirpByIdParams{ID: created[1].ID, UserID: bob.ID}); err != nil {
+		t.Fatalf("DeleteChirpById() error = %v", err)
+	}
+	if _, err := q.GetChirpById(ctx, created[1].ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetChirpById() after delete error = %v, want sql.ErrNoRows", err)
+	}
+
+	deleted, err := q.DeleteChirp(ctx, created[0].ID)
+	if err != nil || deleted != 1 {
+		t.Errorf("DeleteChirp() = %d, %v, want 1", deleted, err)
+	}
+	deleted, err = q.DeleteChirp(ctx, created[0].ID)
+	if err != nil || deleted != 0 {
+		t.Errorf("DeleteChirp() again = %d, %v, want 0", deleted, err)
+	}
+}
+
+func TestFollowQueries(t *testing.T) {
+	q := newQueries(t)
+	ctx := context.Background()
+	alice := createUser(t, q, "alice@example.com")
+	bob := createUser(t, q, "bob@example.com")
+	carol := createUser(t, q, "carol@example.com")
+
+	for _, followee := range []database.User{carol, bob, carol} {
+		if err := q.FollowUser(ctx, database.FollowUserParams{FollowerID: alice.ID, FolloweeID: followee.ID}); err != nil {
+			t.Fatalf("FollowUser() error = %v", err)
+		}
+	}
+	if err := q.FollowUser(ctx, database.FollowUserParams{FollowerID: alice.ID, FolloweeID: alice.ID}); err == nil {
+		t.Error("FollowUser() of oneself succeeded, want a check violation")
+	}
+	if err := q.FollowUser(ctx, database.FollowUserParams{FollowerID: alice.ID, FolloweeID: uuid.New()}); err == nil {
+		t.Error("FollowUser() of a missing user succeeded, want a foreign key violation")
+	}
+
+	followed, err := q.GetFollowedUserIds(ctx, alice.ID)
+	if err != nil || !slices.Equal(followed, []uuid.UUID{carol.ID, bob.ID}) {
+		t.Errorf("GetFollowedUserIds() = %v, %v, want carol then bob", followed, err)
+	}
+
+	unfollowed, err := q.UnfollowUser(ctx, database.UnfollowUserParams{FollowerID: alice.ID, FolloweeID: carol.ID})
+	if err != nil || unfollowed != 1 {
+		t.Errorf("UnfollowUser() = %d, %v, want 1", unfollowed, err)
+	}
+	unfollowed, err = q.UnfollowUser(ctx, database.UnfollowUserParams{FollowerID: alice.ID, FolloweeID: carol.ID})
+	if err != nil || unfollowed != 0 {
+		t.Errorf("UnfollowUser() again = %d, %v, want 0", unfollowed, err)
+	}
+	followed, err = q.GetFollowedUserIds(ctx, alice.ID)
+	if err != nil || !slices.Equal(followed, []uuid.UUID{bob.ID}) {
+		t.Errorf("GetFollowedUserIds() after unfollowing = %v, %v, want bob", followed, err)
+	}
+}
+
+func TestRefreshTokenQueries(t *testing.T) {
+	q := newQueries(t)
+	ctx := context.Background()
+	alice := createUser(t, q, "alice@example.com")
+
+	create := func(token string, expiresAt time.Time) database.RefreshToken {
+		t.Helper()
+		rt, err := q.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: token, UserID: alice.ID, ExpiresAt: expiresAt})
+		if err != nil {
+			t.Fatalf("CreateRefreshToken(%q) error = %v", token, err)
+		}
+		return rt
+	}
+	live := create("live", time.Now().Add(time.Hour))
+	create("expired", time.Now().Add(-time.Hour))
+	create("revoked", time.Now().Add(time.Hour))
+	create("other", time.Now().Add(time.Hour))
+
+	if _, err := q.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "live", UserID: alice.ID, ExpiresAt: time.Now()}); !database.IsUniqueViolation(err) {
+		t.Errorf("CreateRefreshToken() with a duplicate token error = %v, want a unique violation", err)
+	}
+
+	got, err := q.GetRefreshByToken(ctx, "live")
+	if err != nil || got.UserID != alice.ID || got.RevokedAt.Valid || !got.ExpiresAt.Equal(live.ExpiresAt) {
+		t.Errorf("GetRefreshByToken() = %+v, %v", got, err)
+	}
+
+	revoked, err := q.RevokeRefreshByToken(ctx, "revoked")
+	if err != nil || !revoked.RevokedAt.Valid {
+		t.Errorf("RevokeRefreshByToken() = %+v, %v, want revoked_at set", revoked, err)
+	}
+	if _, err := q.RevokeRefreshByToken(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("RevokeRefreshByToken() for a missing token error = %v, want sql.ErrNoRows", err)
+	}
+
+	// Expired tokens go straight away; revoked ones only once they were
+	// revoked before the cut-off.
+	deleted, err := q.DeleteStaleRefreshTokens(ctx, database.DeleteStaleRefreshTokensParams{RevokedBefore: time.Now().Add(-time.Hour), BatchSize: 10})
+	if err != nil || deleted != 1 {
+		t.Errorf("DeleteStaleRefreshTokens() = %d, %v, want only the expired token", deleted, err)
+	}
+	deleted, err = q.DeleteStaleRefreshTokens(ctx, database.DeleteStaleRefreshTokensParams{RevokedBefore: time.Now().Add(time.Hour), BatchSize: 10})
+	if err != nil || deleted != 1 {
+		t.Errorf("DeleteStaleRefreshTokens() = %d, %v, want the revoked token", deleted, err)
+	}
+
+	n, err := q.RevokeRefreshTokensByUser(ctx, alice.ID)
+	if err != nil || n != 2 {
+		t.Errorf("RevokeRefreshTokensByUser() = %d, %v, want 2", n, err)
+	}
+	n, err = q.RevokeRefreshTokensByUser(ctx, alice.ID)
+	if err != nil || n != 0 {
+		t.Errorf("RevokeRefreshTokensByUser() again = %d, %v, want 0", n, err)
+	}
+}
+
+func TestPersonalAccessTokenQueries(t *testing.T) {
+	q := newQueries(t)
+	ctx := context.Background()
+	alice := createUser(t, q, "alice@example.com")
+	bob := createUser(t, q, "bob@example.com")
+
+	pat, err := q.CreatePersonalAccessToken(ctx, database.CreatePersonalAccessTokenParams{
+		UserID:    alice.ID,
+		Name:      "ci",
+		TokenHash: "hash-1",
+		Scopes:    []string{"chirps:read", "chirps:write"},
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreatePersonalAccessToken() error = %v", err)
+	}
+	if !slices.Equal(pat.Scopes, []string{"chirps:read", "chirps:write"}) {
+		t.Errorf("CreatePersonalAccessToken() scopes = %v", pat.Scopes)
+	}
+	if _, err := q.CreatePersonalAccessToken(ctx, database.CreatePersonalAccessTokenParams{UserID: bob.ID, Name: "dup", TokenHash: "hash-1", Scopes: []string{}}); !database.IsUniqueViolation(err) {
+		t.Errorf("CreatePersonalAccessToken() with a duplicate hash error = %v, want a unique violation", err)
+	}
+
+	row, err := q.GetPersonalAccessTokenByHash(ctx, "hash-1")
+	if err != nil || row.ID != pat.ID || row.Role != "user" || row.UserDisabledAt.Valid || !slices.Equal(row.Scopes, pat.Scopes) {
+		t.Errorf("GetPersonalAccessTokenByHash() = %+v, %v", row, err)
+	}
+
+	if err := q.TouchPersonalAccessToken(ctx, pat.ID); err != nil {
+		t.Fatalf("TouchPersonalAccessToken() error = %v", err)
+	}
+	touched, _ := q.GetPersonalAccessTokenByHash(ctx, "hash-1")
+	if !touched.LastUsedAt.Valid {
+		t.Fatal("TouchPersonalAccessToken() did not set last_used_at")
+	}
+	// A second touch within the minute is skipped to save writes.
+	if err := q.TouchPersonalAccessToken(ctx, pat.ID); err != nil {
+		t.Fatalf("TouchPersonalAccessToken() error = %v", err)
+	}
+	again, _ := q.GetPersonalAccessTokenByHash(ctx, "hash-1")
+	if !again.LastUsedAt.Time.Equal(touched.LastUsedAt.Time) {
+		t.Errorf("TouchPersonalAccessToken() within a minute moved last_used_at from %v to %v", touched.LastUsedAt.Time, again.LastUsedAt.Time)
+	}
+
+	tokens, err := q.ListPersonalAccessTokensByUser(ctx, alice.ID)
+	if err != nil || len(tokens) != 1 || tokens[0].ID != pat.ID {
+		t.Errorf("ListPersonalAccessTokensByUser() = %v, %v, want the one token", tokens, err)
+	}
+
+	n, err := q.RevokePersonalAccessToken(ctx, database.RevokePersonalAccessTokenParams{ID: pat.ID, UserID: bob.ID})
+	if err != nil || n != 0 {
+		t.Errorf("RevokePersonalAccessToken() by another user = %d, %v, want 0", n, err)
+	}
+	n, err = q.RevokePersonalAccessToken(ctx, database.RevokePersonalAccessTokenParams{ID: pat.ID, UserID: alice.ID})
+	if err != nil || n != 1 {
+		t.Errorf("RevokePersonalAccessToken() = %d, %v, want 1", n, err)
+	}
+	tokens, err = q.ListPersonalAccessTokensByUser(ctx, alice.ID)
+	if err != nil || len(tokens) != 0 {
+		t.Errorf("ListPersonalAccessTokensByUser() after revoke = %v, %v, want none", tokens, err)
+	}
+}
+
+func TestOauthQueries(t *testing.T) {
+	q := newQueries(t)
+	ctx := context.Background()
+	alice := createUser(t, q, "alice@example.com")
+
+	client, err := q.CreateOauthClient(ctx, database.CreateOauthClientParams{
+		ID:           "client-1",
+		OwnerID:      alice.ID,
+		Name:         "Test app",
+		SecretHash:   sql.NullString{String: "secret-hash", Valid: true},
+		RedirectUris: []string{"https://app.example.com/callback"},
+	})
+	if err != nil {
+		t.Fatalf("CreateOauthClient() error = %v", err)
+	}
+	got, err := q.GetOauthClient(ctx, "client-1")
+	if err != nil || got.Name != client.Name || !slices.Equal(got.RedirectUris, client.RedirectUris) {
+		t.Errorf("GetOauthClient() = %+v, %v", got, err)
+	}
+
+	err = q.CreateOauthAuthorizationCode(ctx, database.CreateOauthAuthorizationCodeParams{
+		CodeHash:      "code-hash",
+		ClientID:      client.ID,
+		UserID:        alice.ID,
+		RedirectUri:   client.RedirectUris[0],
+		Scopes:        []string{"chirps:read"},
+		CodeChallenge: "challenge",
+		ExpiresAt:     time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("CreateOauthAuthorizationCode() error = %v", err)
+	}
+	consume := database.ConsumeOauthAuthorizationCodeParams{CodeHash: "code-hash", ClientID: client.ID}
+	if _, err := q.ConsumeOauthAuthorizationCode(ctx, database.ConsumeOauthAuthorizationCodeParams{CodeHash: "code-hash", ClientID: "client-2"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("ConsumeOauthAuthorizationCode() by another client error = %v, want sql.ErrNoRows", err)
+	}
+	code, err := q.ConsumeOauthAuthorizationCode(ctx, consume)
+	if err != nil || code.UserID != alice.ID || !slices.Equal(code.Scopes, []string{"chirps:read"}) {
+		t.Errorf("ConsumeOauthAuthorizationCode() = %+v, %v", code, err)
+	}
+	if _, err := q.ConsumeOauthAuthorizationCode(ctx, consume); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("ConsumeOauthAuthorizationCode() twice error = %v, want sql.ErrNoRows", err)
+	}
+
+	grant, err := q.CreateOauthGrant(ctx, database.CreateOauthGrantParams{
+		ClientID:  client.ID,
+		UserID:    alice.ID,
+		TokenHash: "grant-hash",
+		Scopes:    []string{"chirps:read"},
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("CreateOauthGrant() error = %v", err)
+	}
+	if n, err := q.RevokeOauthGrant(ctx, grant.ID); err != nil || n != 1 {
+		t.Fatalf("RevokeOauthGrant() = %d, %v, want 1", n, err)
+	}
+	if n, err := q.RevokeOauthGrant(ctx, grant.ID); err != nil || n != 0 {
+		t.Errorf("RevokeOauthGrant() twice = %d, %v, want 0", n, err)
+	}
+	revoked, err := q.GetOauthGrantByTokenHash(ctx, "grant-hash")
+	if err != nil || revoked.ID != grant.ID || !revoked.RevokedAt.Valid {
+		t.Errorf("GetOauthGrantByTokenHash() after revoke = %+v, %v", revoked, err)
+	}
+}
+
+func TestRateLimitQueries(t *testing.T) {
+	q := newQueries(t)
+	ctx := context.Background()
+
+	// With no refill to speak of, a bucket of two allows two takes.
+	params := database.TakeRateLimitTokenParams{Key: "login:203.0.113.7", Capacity: 2, RefillRate: 0.001}
+	for i, wantAllowed := range []bool{true, true, false} {
+		row, err := q.TakeRateLimitToken(ctx, params)
+		if err != nil {
+			t.Fatalf("TakeRateLimitToken() error = %v", err)
+		}
+		if row.Allowed != wantAllowed {
+			t.Errorf("TakeRateLimitToken() #%d allowed = %v, want %v", i+1, row.Allowed, wantAllowed)
+		}
+	}
+
+	deleted, err := q.DeleteIdleRateLimitBuckets(ctx, 3600)
+	if err != nil || deleted != 0 {
+		t.Errorf("DeleteIdleRateLimitBuckets() for a fresh bucket = %d, %v, want 0", deleted, err)
+	}
+	deleted, err = q.DeleteIdleRateLimitBuckets(ctx, -1)
+	if err != nil || deleted != 1 {
+		t.Errorf("DeleteIdleRateLimitBuckets() = %d, %v, want 1", deleted, err)
+	}
+}
+
+func TestChirpEventQueries(t *testing.T) {
+	q := newQueries(t)
+	if err := q.NotifyChirpEvent(context.Background(), `{"id":"1","type":"chirp.created"}`); err != nil {
+		t.Errorf("NotifyChirpEvent() error = %v", err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	q := newQueries(t)
+	ctx := context.Background()
+	alice := createUser(t, q, "alice@example.com")
+	if _, err := q.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", UserID: alice.ID}); err != nil {
+		t.Fatalf("CreateChirp() error = %v", err)
+	}
+	if _, err := q.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "token", UserID: alice.ID, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("CreateRefreshToken() error = %v", err)
+	}
+
+	if err := q.Reset(ctx); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+
+	// Deleting users cascades to everything they own.
+	if users, _ := q.ListUsers(ctx); len(users) != 0 {
+		t.Errorf("ListUsers() after reset = %v, want none", users)
+	}
+	if chirps, _ := q.GetChirps(ctx); len(chirps) != 0 {
+		t.Errorf("GetChirps() after reset = %v, want none", chirps)
+	}
+	if _, err := q.GetRefreshByToken(ctx, "token"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetRefreshByToken() after reset error = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -44,6 +44,29 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 	return i, err
 }
 
+const deleteStaleRefreshTokens = `-- name: DeleteStaleRefreshTokens :execrows
+delete from refresh_tokens
+where token in (
+	select token from refresh_tokens
+	where expires_at < now()
+	or revoked_at < $1::timestamp
+	limit $2
+)
+`
+
+type DeleteStaleRefreshTokensParams struct {
+	RevokedBefore time.Time
+	BatchSize     int32
+}
+
+func (q *Queries) DeleteStaleRefreshTokens(ctx context.Context, arg DeleteStaleRefreshTokensParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteStaleRefreshTokens, arg.RevokedBefore, arg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getRefreshByToken = `-- name: GetRefreshByToken :one
 select token, created_at, updated_at, user_id, expires_at, revoked_at from refresh_tokens where token = $1
 `
@@ -82,3 +105,17 @@ func (q *Queries) RevokeRefreshByToken(ctx context.Context, token string) (Refre
 	)
 	return i, err
 }
+
+const revokeRefreshTokensByUser = `-- name: RevokeRefreshTokensByUser :execrows
+update refresh_tokens
+set (revoked_at, updated_at) = (now(), now())
+where user_id = $1 and revoked_at is null
+`
+
+func (q *Queries) RevokeRefreshTokensByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeRefreshTokensByUser, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
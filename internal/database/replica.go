@@ -0,0 +1,212 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Replica is a read-only copy of the primary database that chirp reads may
+// be served from.
+type Replica struct {
+	// Name identifies the replica in logs. It must not hold credentials.
+	Name  string
+	Store Store
+	// Ping reports whether the replica can serve queries.
+	Ping func(context.Context) error
+}
+
+// NewReplica returns a Replica that queries db. wrap, if not nil, is applied
+// to the pool as in NewDB.
+func NewReplica(name string, db *sql.DB, wrap func(DBTX) DBTX) Replica {
+	var conn DBTX = db
+	if wrap != nil {
+		conn = wrap(db)
+	}
+	return Replica{Name: name, Store: New(conn), Ping: db.PingContext}
+}
+
+type replicaState struct {
+	Replica
+	healthy atomic.Bool
+}
+
+// ReplicaStore is a TxStore that serves GetChirps, GetChirpById and
+// GetChirpsByAuthor from its replicas in turn. Everything else, including
+// every query in InTx, goes to the primary. Reads also go to the primary
+// when their context came through WithPrimary or no replica is healthy.
+//
+// A replica is marked unhealthy when a query on it fails, and the query is
+// retried on the primary. Run pings the replicas to bring them back.
+type ReplicaStore struct {
+	TxStore
+
+	replicas []*replicaState
+	next     atomic.Uint64
+}
+
+// NewReplicaStore routes reads across replicas, which start out healthy.
+func NewReplicaStore(primary TxStore, replicas ...Replica) *ReplicaStore {
+	s := &ReplicaStore{TxStore: primary}
+	for _, replica := range replicas {
+		state := &replicaState{Replica: replica}
+		state.healthy.Store(true)
+		s.replicas = append(s.replicas, state)
+	}
+	return s
+}
+
+func (s *ReplicaStore) GetChirps(ctx context.Context) ([]Chirp, error) {
+	return readReplica(ctx, s, func(store Store) ([]Chirp, error) {
+		return store.GetChirps(ctx)
+	})
+}
+
+func (s *ReplicaStore) GetChirpById(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	return readReplica(ctx, s, func(store Store) (Chirp, error) {
+		return store.GetChirpById(ctx, id)
+	})
+}
+
+func (s *ReplicaStore) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	return readReplica(ctx, s, func(store Store) ([]Chirp, error) {
+		return store.GetChirpsByAuthor(ctx, userID)
+	})
+}
+
+// readReplica runs query on the next healthy replica and falls back to the
+// primary if there is none or the replica fails. A missing row is an
+// answer, not a failure.
+func readReplica[T any](ctx context.Context, s *ReplicaStore, query func(Store) (T, error)) (T, error) {
+	if replica := s.pick(ctx); replica != nil {
+		result, err := query(replica.Store)
+		if err == nil || errors.Is(err, sql.ErrNoRows) || ctx.Err() != nil {
+			return result, err
+		}
+		if replica.healthy.CompareAndSwap(true, false) {
+			slog.Warn("Read replica failed, reading from the primary", "replica", replica.Name, "error", err)
+		}
+	}
+	return query(s.TxStore)
+}
+
+func (s *ReplicaStore) pick(ctx context.Context) *replicaState {
+	if len(s.replicas) == 0 || UsesPrimary(ctx) {
+		return nil
+	}
+	start := s.next.Add(1)
+	for i := range uint64(len(s.replicas)) {
+		replica := s.replicas[(start+i)%uint64(len(s.replicas))]
+		if replica.healthy.Load() {
+			return replica
+		}
+	}
+	return nil
+}
+
+// CheckReplicas pings every replica and records which are healthy.
+func (s *ReplicaStore) CheckReplicas(ctx context.Context, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, replica := range s.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			err := replica.Ping(pingCtx)
+			if replica.healthy.Swap(err == nil) == (err == nil) {
+				return
+			}
+			if err != nil {
+				slog.Warn("Read replica is unhealthy", "replica", replica.Name, "error", err)
+			} else {
+				slog.Info("Read replica is healthy again", "replica", replica.Name)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Run checks the replicas every interval until ctx is cancelled. Each ping
+// may take up to one interval.
+func (s *ReplicaStore) Run(ctx context.Context, interval time.Duration) {
+	if len(s.replicas) == 0 || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.CheckReplicas(ctx, interval)
+		}
+	}
+}
+
+type primaryKey struct{}
+
+// WithPrimary makes the reads of a ReplicaStore under ctx go to the primary.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsesPrimary reports whether ctx came through WithPrimary.
+func UsesPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// RecentWriters remembers which users wrote within the last window, so
+// their reads can skip replicas that may not have caught up yet. It only
+// knows about writes made through this process.
+type RecentWriters struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	writes map[uuid.UUID]time.Time
+	swept  time.Time
+}
+
+func NewRecentWriters(window time.Duration) *RecentWriters {
+	return &RecentWriters{window: window, writes: map[uuid.UUID]time.Time{}}
+}
+
+// Record starts or extends userID's window.
+func (w *RecentWriters) Record(userID uuid.UUID) {
+	now := time.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.writes[userID] = now
+	// Drop expired entries once per window so the map stays bounded by
+	// the number of users writing within about two windows.
+	if now.Sub(w.swept) >= w.window {
+		for id, at := range w.writes {
+			if now.Sub(at) >= w.window {
+				delete(w.writes, id)
+			}
+		}
+		w.swept = now
+	}
+}
+
+// Recent reports whether userID wrote within the window.
+func (w *RecentWriters) Recent(userID uuid.UUID) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	at, ok := w.writes[userID]
+	return ok && time.Since(at) < w.window
+}
@@ -0,0 +1,139 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/database/memory"
+	"github.com/google/uuid"
+)
+
+// failingStore is a replica whose chirp reads fail.
+type failingStore struct {
+	database.Store
+}
+
+func (failingStore) GetChirps(context.Context) ([]database.Chirp, error) {
+	return nil, errors.New("connection refused")
+}
+
+// storeWithChirp returns a store holding one chirp with body.
+func storeWithChirp(t *testing.T, body string) *memory.Store {
+	t.Helper()
+	ctx := context.Background()
+	store := memory.New()
+	user, err := store.CreateUser(ctx, database.CreateUserParams{Email: body + "@example.com", HashedPassword: "x"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := store.CreateChirp(ctx, database.CreateChirpParams{Body: body, UserID: user.ID}); err != nil {
+		t.Fatalf("CreateChirp: %v", err)
+	}
+	return store
+}
+
+func TestReplicaStore(t *testing.T) {
+	primary := storeWithChirp(t, "primary")
+	replica := storeWithChirp(t, "replica")
+	ping := func(context.Context) error { return nil }
+
+	tests := []struct {
+		name     string
+		replicas []database.Replica
+		ctx      context.Context
+		want     string
+	}{
+		{
+			name: "No replicas",
+			ctx:  context.Background(),
+			want: "primary",
+		},
+		{
+			name:     "Healthy replica",
+			replicas: []database.Replica{{Name: "r1", Store: replica, Ping: ping}},
+			ctx:      context.Background(),
+			want:     "replica",
+		},
+		{
+			name:     "Read your writes",
+			replicas: []database.Replica{{Name: "r1", Store: replica, Ping: ping}},
+			ctx:      database.WithPrimary(context.Background()),
+			want:     "primary",
+		},
+		{
+			name:     "Failing replica",
+			replicas: []database.Replica{{Name: "r1", Store: failingStore{replica}, Ping: ping}},
+			ctx:      context.Background(),
+			want:     "primary",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := database.NewReplicaStore(primary, tt.replicas...)
+
+			chirps, err := store.GetChirps(tt.ctx)
+			if err != nil {
+				t.Fatalf("GetChirps: %v", err)
+			}
+			if len(chirps) != 1 || chirps[0].Body != tt.want {
+				t.Errorf("GetChirps() = %v, want the %s chirp", chirps, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplicaStoreHealth(t *testing.T) {
+	ctx := context.Background()
+	primary := storeWithChirp(t, "primary")
+	replica := storeWithChirp(t, "replica")
+
+	var pingErr error
+	store := database.NewReplicaStore(primary, database.Replica{
+		Name:  "r1",
+		Store: replica,
+		Ping:  func(context.Context) error { return pingErr },
+	})
+
+	read := func() string {
+		t.Helper()
+		chirps, err := store.GetChirps(ctx)
+		if err != nil || len(chirps) != 1 {
+			t.Fatalf("GetChirps() = %v, %v", chirps, err)
+		}
+		return chirps[0].Body
+	}
+
+	pingErr = errors.New("replica down")
+	store.CheckReplicas(ctx, time.Second)
+	if got := read(); got != "primary" {
+		t.Errorf("Read %s chirp with the replica down, want primary", got)
+	}
+
+	pingErr = nil
+	store.CheckReplicas(ctx, time.Second)
+	if got := read(); got != "replica" {
+		t.Errorf("Read %s chirp with the replica back up, want replica", got)
+	}
+}
+
+func TestRecentWriters(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	writers := database.NewRecentWriters(50 * time.Millisecond)
+
+	writers.Record(alice)
+	if !writers.Recent(alice) {
+		t.Error("Expected alice to have written recently")
+	}
+	if writers.Recent(bob) {
+		t.Error("Expected bob not to have written recently")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if writers.Recent(alice) {
+		t.Error("Expected alice's window to have closed")
+	}
+}
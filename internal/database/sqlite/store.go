@@ -0,0 +1,467 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Store adapts the SQLite queries to database.Store and database.OAuthStore.
+// SQLite has no gen_random_uuid, now() or arrays, so Store generates ids and
+// timestamps itself and keeps string lists as JSON text.
+type Store struct {
+	q    *Queries
+	db   *sql.DB
+	wrap func(database.DBTX) database.DBTX
+	now  func() time.Time
+}
+
+var (
+	_ database.TxStore    = (*Store)(nil)
+	_ database.OAuthStore = (*Store)(nil)
+)
+
+// NewStore returns a Store on db. wrap, if not nil, is applied to the pool
+// and to every transaction, for instance to trace their queries.
+func NewStore(db *sql.DB, wrap func(database.DBTX) database.DBTX) *Store {
+	var conn database.DBTX = db
+	if wrap != nil {
+		conn = wrap(db)
+	}
+	return &Store{q: New(conn), db: db, wrap: wrap, now: time.Now}
+}
+
+// InTx needs no retries in practice: the pool's single connection already
+// serialises every transaction.
+func (s *Store) InTx(ctx context.Context, fn func(database.Store) error) error {
+	return database.RunInTx(ctx, s.db, nil, func(tx *sql.Tx) error {
+		var conn database.DBTX = tx
+		if s.wrap != nil {
+			conn = s.wrap(tx)
+		}
+		return fn(&Store{q: New(conn), now: s.now})
+	})
+}
+
+// timestamp mimics a Postgres timestamp column: UTC with microsecond
+// precision. Storing every time in UTC also keeps the text form sortable.
+func (s *Store) timestamp() time.Time {
+	return s.now().UTC().Truncate(time.Microsecond)
+}
+
+func utc(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+func utcNull(t sql.NullTime) sql.NullTime {
+	if t.Valid {
+		t.Time = utc(t.Time)
+	}
+	return t
+}
+
+func encodeList(list []string) (string, error) {
+	if list == nil {
+		list = []string{}
+	}
+	b, err := json.Marshal(list)
+	return string(b), err
+}
+
+func decodeList(text string) ([]string, error) {
+	var list []string
+	if err := json.Unmarshal([]byte(text), &list); err != nil {
+		return nil, fmt.Errorf("decoding string list: %w", err)
+	}
+	return list, nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	u, err := s.q.CreateUser(ctx, CreateUserParams{
+		ID:             uuid.New(),
+		Now:            s.timestamp(),
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+	})
+	return database.User(u), err
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	u, err := s.q.GetUserByEmail(ctx, email)
+	return database.User(u), err
+}
+
+func (s *Store) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	u, err := s.q.GetUserById(ctx, id)
+	return database.User(u), err
+}
+
+func (s *Store) UpdateUserById(ctx context.Context, arg database.UpdateUserByIdParams) (database.User, error) {
+	u, err := s.q.UpdateUserById(ctx, UpdateUserByIdParams{
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Now:            s.timestamp(),
+		ID:             arg.ID,
+	})
+	return database.User(u), err
+}
+
+func (s *Store) UpgradeUserById(ctx context.Context, arg database.UpgradeUserByIdParams) (database.User, error) {
+	u, err := s.q.UpgradeUserById(ctx, UpgradeUserByIdParams{
+		IsChirpyRed: arg.IsChirpyRed,
+		Now:         s.timestamp(),
+		ID:          arg.ID,
+	})
+	return database.User(u), err
+}
+
+func (s *Store) ListUsers(ctx context.Context) ([]database.User, error) {
+	users, err := s.q.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]database.User, len(users))
+	for i, u := range users {
+		out[i] = database.User(u)
+	}
+	return out, nil
+}
+
+func (s *Store) DisableUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	u, err := s.q.DisableUserById(ctx, DisableUserByIdParams{Now: s.timestamp(), ID: id})
+	return database.User(u), err
+}
+
+func (s *Store) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (database.User, error) {
+	u, err := s.q.SetUserRole(ctx, SetUserRoleParams{Role: arg.Role, Now: s.timestamp(), ID: arg.ID})
+	return database.User(u), err
+}
+
+func (s *Store) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	c, err := s.q.CreateChirp(ctx, CreateChirpParams{
+		ID:     uuid.New(),
+		Body:   arg.Body,
+		Now:    s.timestamp(),
+		UserID: arg.UserID,
+	})
+	return database.Chirp(c), err
+}
+
+func chirps(rows []Chirp) []database.Chirp {
+	if rows == nil {
+		return nil
+	}
+	out := make([]database.Chirp, len(rows))
+	for i, c := range rows {
+		out[i] = database.Chirp(c)
+	}
+	return out
+}
+
+func (s *Store) GetChirps(ctx context.Context) ([]database.Chirp, error) {
+	rows, err := s.q.GetChirps(ctx)
+	return chirps(rows), err
+}
+
+func (s *Store) GetChirpById(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	c, err := s.q.GetChirpById(ctx, id)
+	return database.Chirp(c), err
+}
+
+func (s *Store) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	rows, err := s.q.GetChirpsByAuthor(ctx, userID)
+	return chirps(rows), err
+}
+
+func (s *Store) DeleteChirpById(ctx context.Context, arg database.DeleteChirpByIdParams) error {
+	return s.q.DeleteChirpById(ctx, DeleteChirpByIdParams(arg))
+}
+
+func (s *Store) DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	return s.q.DeleteChirp(ctx, id)
+}
+
+func (s *Store) FollowUser(ctx context.Context, arg database.FollowUserParams) error {
+	return s.q.FollowUser(ctx, FollowUserParams{
+		FollowerID: arg.FollowerID,
+		FolloweeID: arg.FolloweeID,
+		Now:        s.timestamp(),
+	})
+}
+
+func (s *Store) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) (int64, error) {
+	return s.q.UnfollowUser(ctx, UnfollowUserParams(arg))
+}
+
+func (s *Store) GetFollowedUserIds(ctx context.Context, followerID uuid.UUID) ([]uuid.UUID, error) {
+	return s.q.GetFollowedUserIds(ctx, followerID)
+}
+
+func (s *Store) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	t, err := s.q.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     arg.Token,
+		Now:       s.timestamp(),
+		UserID:    arg.UserID,
+		ExpiresAt: utc(arg.ExpiresAt),
+	})
+	return database.RefreshToken(t), err
+}
+
+func (s *Store) GetRefreshByToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	t, err := s.q.GetRefreshByToken(ctx, token)
+	return database.RefreshToken(t), err
+}
+
+func (s *Store) RevokeRefreshByToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	t, err := s.q.RevokeRefreshByToken(ctx, RevokeRefreshByTokenParams{Now: s.timestamp(), Token: token})
+	return database.RefreshToken(t), err
+}
+
+func (s *Store) RevokeRefreshTokensByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return s.q.RevokeRefreshTokensByUser(ctx, RevokeRefreshTokensByUserParams{Now: s.timestamp(), UserID: userID})
+}
+
+func (s *Store) DeleteStaleRefreshTokens(ctx context.Context, arg database.DeleteStaleRefreshTokensParams) (int64, error) {
+	return s.q.DeleteStaleRefreshTokens(ctx, DeleteStaleRefreshTokensParams{
+		Now:           s.timestamp(),
+		RevokedBefore: utc(arg.RevokedBefore),
+		BatchSize:     int64(arg.BatchSize),
+	})
+}
+
+func personalAccessToken(p PersonalAccessToken) (database.PersonalAccessToken, error) {
+	scopes, err := decodeList(p.Scopes)
+	if err != nil {
+		return database.PersonalAccessToken{}, err
+	}
+	return database.PersonalAccessToken{
+		ID:         p.ID,
+		CreatedAt:  p.CreatedAt,
+		UpdatedAt:  p.UpdatedAt,
+		UserID:     p.UserID,
+		Name:       p.Name,
+		TokenHash:  p.TokenHash,
+		Scopes:     scopes,
+		ExpiresAt:  p.ExpiresAt,
+		LastUsedAt: p.LastUsedAt,
+		RevokedAt:  p.RevokedAt,
+	}, nil
+}
+
+func (s *Store) CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.PersonalAccessToken, error) {
+	scopes, err := encodeList(arg.Scopes)
+	if err != nil {
+		return database.PersonalAccessToken{}, err
+	}
+	p, err := s.q.CreatePersonalAccessToken(ctx, CreatePersonalAccessTokenParams{
+		ID:        uuid.New(),
+		Now:       s.timestamp(),
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		Scopes:    scopes,
+		ExpiresAt: utcNull(arg.ExpiresAt),
+	})
+	if err != nil {
+		return database.PersonalAccessToken{}, err
+	}
+	return personalAccessToken(p)
+}
+
+func (s *Store) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (database.GetPersonalAccessTokenByHashRow, error) {
+	row, err := s.q.GetPersonalAccessTokenByHash(ctx, tokenHash)
+	if err != nil {
+		return database.GetPersonalAccessTokenByHashRow{}, err
+	}
+	scopes, err := decodeList(row.Scopes)
+	if err != nil {
+		return database.GetPersonalAccessTokenByHashRow{}, err
+	}
+	return database.GetPersonalAccessTokenByHashRow{
+		ID:             row.ID,
+		CreatedAt:      row.CreatedAt,
+		UpdatedAt:      row.UpdatedAt,
+		UserID:         row.UserID,
+		Name:           row.Name,
+		TokenHash:      row.TokenHash,
+		Scopes:         scopes,
+		ExpiresAt:      row.ExpiresAt,
+		LastUsedAt:     row.LastUsedAt,
+		RevokedAt:      row.RevokedAt,
+		Role:           row.Role,
+		UserDisabledAt: row.UserDisabledAt,
+	}, nil
+}
+
+func (s *Store) ListPersonalAccessTokensByUser(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error) {
+	rows, err := s.q.ListPersonalAccessTokensByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var out []database.PersonalAccessToken
+	for _, row := range rows {
+		p, err := personalAccessToken(row)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (s *Store) RevokePersonalAccessToken(ctx context.Context, arg database.RevokePersonalAccessTokenParams) (int64, error) {
+	return s.q.RevokePersonalAccessToken(ctx, RevokePersonalAccessTokenParams{
+		Now:    s.timestamp(),
+		ID:     arg.ID,
+		UserID: arg.UserID,
+	})
+}
+
+func (s *Store) TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error {
+	now := s.timestamp()
+	return s.q.TouchPersonalAccessToken(ctx, TouchPersonalAccessTokenParams{
+		Now:         now,
+		ID:          id,
+		StaleBefore: now.Add(-time.Minute),
+	})
+}
+
+func (s *Store) Reset(ctx context.Context) error {
+	return s.q.Reset(ctx)
+}
+
+func oauthClient(c OauthClient) (database.OauthClient, error) {
+	uris, err := decodeList(c.RedirectUris)
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+	return database.OauthClient{
+		ID:           c.ID,
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+		OwnerID:      c.OwnerID,
+		Name:         c.Name,
+		SecretHash:   c.SecretHash,
+		RedirectUris: uris,
+	}, nil
+}
+
+func oauthGrant(g OauthGrant) (database.OauthGrant, error) {
+	scopes, err := decodeList(g.Scopes)
+	if err != nil {
+		return database.OauthGrant{}, err
+	}
+	return database.OauthGrant{
+		ID:        g.ID,
+		CreatedAt: g.CreatedAt,
+		UpdatedAt: g.UpdatedAt,
+		ClientID:  g.ClientID,
+		UserID:    g.UserID,
+		TokenHash: g.TokenHash,
+		Scopes:    scopes,
+		ExpiresAt: g.ExpiresAt,
+		RevokedAt: g.RevokedAt,
+	}, nil
+}
+
+func (s *Store) CreateOauthClient(ctx context.Context, arg database.CreateOauthClientParams) (database.OauthClient, error) {
+	uris, err := encodeList(arg.RedirectUris)
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+	c, err := s.q.CreateOauthClient(ctx, CreateOauthClientParams{
+		ID:           arg.ID,
+		Now:          s.timestamp(),
+		OwnerID:      arg.OwnerID,
+		Name:         arg.Name,
+		SecretHash:   arg.SecretHash,
+		RedirectUris: uris,
+	})
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+	return oauthClient(c)
+}
+
+func (s *Store) GetOauthClient(ctx context.Context, id string) (database.OauthClient, error) {
+	c, err := s.q.GetOauthClient(ctx, id)
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+	return oauthClient(c)
+}
+
+func (s *Store) CreateOauthAuthorizationCode(ctx context.Context, arg database.CreateOauthAuthorizationCodeParams) error {
+	scopes, err := encodeList(arg.Scopes)
+	if err != nil {
+		return err
+	}
+	return s.q.CreateOauthAuthorizationCode(ctx, CreateOauthAuthorizationCodeParams{
+		CodeHash:      arg.CodeHash,
+		Now:           s.timestamp(),
+		ClientID:      arg.ClientID,
+		UserID:        arg.UserID,
+		RedirectUri:   arg.RedirectUri,
+		Scopes:        scopes,
+		CodeChallenge: arg.CodeChallenge,
+		ExpiresAt:     utc(arg.ExpiresAt),
+	})
+}
+
+func (s *Store) ConsumeOauthAuthorizationCode(ctx context.Context, arg database.ConsumeOauthAuthorizationCodeParams) (database.OauthAuthorizationCode, error) {
+	c, err := s.q.ConsumeOauthAuthorizationCode(ctx, ConsumeOauthAuthorizationCodeParams(arg))
+	if err != nil {
+		return database.OauthAuthorizationCode{}, err
+	}
+	scopes, err := decodeList(c.Scopes)
+	if err != nil {
+		return database.OauthAuthorizationCode{}, err
+	}
+	return database.OauthAuthorizationCode{
+		CodeHash:      c.CodeHash,
+		CreatedAt:     c.CreatedAt,
+		ClientID:      c.ClientID,
+		UserID:        c.UserID,
+		RedirectUri:   c.RedirectUri,
+		Scopes:        scopes,
+		CodeChallenge: c.CodeChallenge,
+		ExpiresAt:     c.ExpiresAt,
+	}, nil
+}
+
+func (s *Store) CreateOauthGrant(ctx context.Context, arg database.CreateOauthGrantParams) (database.OauthGrant, error) {
+	scopes, err := encodeList(arg.Scopes)
+	if err != nil {
+		return database.OauthGrant{}, err
+	}
+	g, err := s.q.CreateOauthGrant(ctx, CreateOauthGrantParams{
+		ID:        uuid.New(),
+		Now:       s.timestamp(),
+		ClientID:  arg.ClientID,
+		UserID:    arg.UserID,
+		TokenHash: arg.TokenHash,
+		Scopes:    scopes,
+		ExpiresAt: utc(arg.ExpiresAt),
+	})
+	if err != nil {
+		return database.OauthGrant{}, err
+	}
+	return oauthGrant(g)
+}
+
+func (s *Store) GetOauthGrantByTokenHash(ctx context.Context, tokenHash string) (database.OauthGrant, error) {
+	g, err := s.q.GetOauthGrantByTokenHash(ctx, tokenHash)
+	if err != nil {
+		return database.OauthGrant{}, err
+	}
+	return oauthGrant(g)
+}
+
+func (s *Store) RevokeOauthGrant(ctx context.Context, id uuid.UUID) (int64, error) {
+	return s.q.RevokeOauthGrant(ctx, RevokeOauthGrantParams{Now: s.timestamp(), ID: id})
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Store is the subset of queries the HTTP handlers and CLI run. *Queries
+// implements it against Postgres; other backends implement it with the
+// same semantics: missing rows are sql.ErrNoRows, duplicate keys satisfy
+// IsUniqueViolation and deleting a user deletes everything they own.
+type Store interface {
+	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserById(ctx context.Context, id uuid.UUID) (User, error)
+	UpdateUserById(ctx context.Context, arg UpdateUserByIdParams) (User, error)
+	UpgradeUserById(ctx context.Context, arg UpgradeUserByIdParams) (User, error)
+	ListUsers(ctx context.Context) ([]User, error)
+	DisableUserById(ctx context.Context, id uuid.UUID) (User, error)
+	SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error)
+
+	CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error)
+	GetChirps(ctx context.Context) ([]Chirp, error)
+	GetChirpById(ctx context.Context, id uuid.UUID) (Chirp, error)
+	GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error)
+	DeleteChirpById(ctx context.Context, arg DeleteChirpByIdParams) error
+	DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error)
+
+	FollowUser(ctx context.Context, arg FollowUserParams) error
+	UnfollowUser(ctx context.Context, arg UnfollowUserParams) (int64, error)
+	GetFollowedUserIds(ctx context.Context, followerID uuid.UUID) ([]uuid.UUID, error)
+
+	CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error)
+	GetRefreshByToken(ctx context.Context, token string) (RefreshToken, error)
+	RevokeRefreshByToken(ctx context.Context, token string) (RefreshToken, error)
+	RevokeRefreshTokensByUser(ctx context.Context, userID uuid.UUID) (int64, error)
+	DeleteStaleRefreshTokens(ctx context.Context, arg DeleteStaleRefreshTokensParams) (int64, error)
+
+	CreatePersonalAccessToken(ctx context.Context, arg CreatePersonalAccessTokenParams) (PersonalAccessToken, error)
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (GetPersonalAccessTokenByHashRow, error)
+	ListPersonalAccessTokensByUser(ctx context.Context, userID uuid.UUID) ([]PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, arg RevokePersonalAccessTokenParams) (int64, error)
+	TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error
+
+	Reset(ctx context.Context) error
+}
+
+// TxStore is a Store that can also run several queries as one transaction.
+type TxStore interface {
+	Store
+
+	// InTx runs fn with a Store whose queries share one transaction, which
+	// is committed when fn returns nil and rolled back otherwise. fn may be
+	// run again after a conflict with a concurrent transaction, so it must
+	// not have effects outside the Store it is given.
+	InTx(ctx context.Context, fn func(Store) error) error
+}
+
+// OAuthStore is the queries behind the OAuth authorization server.
+type OAuthStore interface {
+	CreateOauthClient(ctx context.Context, arg CreateOauthClientParams) (OauthClient, error)
+	GetOauthClient(ctx context.Context, id string) (OauthClient, error)
+	CreateOauthAuthorizationCode(ctx context.Context, arg CreateOauthAuthorizationCodeParams) error
+	ConsumeOauthAuthorizationCode(ctx context.Context, arg ConsumeOauthAuthorizationCodeParams) (OauthAuthorizationCode, error)
+	CreateOauthGrant(ctx context.Context, arg CreateOauthGrantParams) (OauthGrant, error)
+	GetOauthGrantByTokenHash(ctx context.Context, tokenHash string) (OauthGrant, error)
+	RevokeOauthGrant(ctx context.Context, id uuid.UUID) (int64, error)
+
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserById(ctx context.Context, id uuid.UUID) (User, error)
+}
+
+var (
+	_ Store      = (*Queries)(nil)
+	_ OAuthStore = (*Queries)(nil)
+)
+
+// ErrUniqueViolation is returned by stores without a database driver of
+// their own when a write would duplicate a unique key.
+var ErrUniqueViolation = errors.New("unique constraint violation")
+
+// IsUniqueViolation reports whether err is a unique constraint violation,
+// such as a second account with the same email.
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return errors.Is(err, ErrUniqueViolation)
+}
@@ -0,0 +1,32 @@
+package database_test
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/lib/pq"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "Postgres unique violation", err: &pq.Error{Code: "23505"}, want: true},
+		{name: "Wrapped Postgres unique violation", err: fmt.Errorf("create user: %w", &pq.Error{Code: "23505"}), want: true},
+		{name: "Other Postgres error", err: &pq.Error{Code: "23503"}},
+		{name: "Store without a driver", err: fmt.Errorf("memory: email: %w", database.ErrUniqueViolation), want: true},
+		{name: "Missing row", err: sql.ErrNoRows},
+		{name: "No error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := database.IsUniqueViolation(tt.err); got != tt.want {
+				t.Errorf("IsUniqueViolation(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
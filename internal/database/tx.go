@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// txAttempts bounds how often RunInTx retries a transaction that lost a
+// serialization conflict.
+const txAttempts = 5
+
+// DB is the Postgres Store. Its queries run on the pool one at a time, and
+// InTx groups several into a serializable transaction.
+type DB struct {
+	*Queries
+	db   *sql.DB
+	wrap func(DBTX) DBTX
+}
+
+var _ TxStore = (*DB)(nil)
+
+// NewDB returns a Store on db. wrap, if not nil, is applied to the pool and
+// to every transaction, for instance to trace their queries.
+func NewDB(db *sql.DB, wrap func(DBTX) DBTX) *DB {
+	var conn DBTX = db
+	if wrap != nil {
+		conn = wrap(db)
+	}
+	return &DB{Queries: New(conn), db: db, wrap: wrap}
+}
+
+func (d *DB) InTx(ctx context.Context, fn func(Store) error) error {
+	return RunInTx(ctx, d.db, &sql.TxOptions{Isolation: sql.LevelSerializable}, func(tx *sql.Tx) error {
+		if d.wrap != nil {
+			return fn(New(d.wrap(tx)))
+		}
+		return fn(d.Queries.WithTx(tx))
+	})
+}
+
+// RunInTx runs fn in a transaction on db. The transaction is committed when
+// fn returns nil and rolled back otherwise, including when fn panics. If fn
+// or the commit fails with a serialization failure or deadlock, the whole
+// transaction is retried after a short jittered pause, up to txAttempts
+// times in all.
+func RunInTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(*sql.Tx) error) error {
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, db, opts, fn)
+		if err == nil || !IsSerializationFailure(err) || attempt == txAttempts {
+			return err
+		}
+
+		pause := time.Duration(attempt) * 5 * time.Millisecond
+		pause += rand.N(pause)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(pause):
+		}
+	}
+}
+
+func runTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(*sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	// Rollback after a successful commit is a no-op.
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsSerializationFailure reports whether err means a transaction conflicted
+// with a concurrent one and may succeed if run again.
+func IsSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+}
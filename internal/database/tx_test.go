@@ -0,0 +1,87 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/lib/pq"
+)
+
+func TestRunInTx(t *testing.T) {
+	conflict := &pq.Error{Code: "40001"}
+	deadlock := &pq.Error{Code: "40P01"}
+	failure := errors.New("boom")
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantErr      error
+		wantAttempts int
+		wantRows     int
+	}{
+		{
+			name:         "Commits on success",
+			errs:         []error{nil},
+			wantAttempts: 1,
+			wantRows:     1,
+		},
+		{
+			name:         "Rolls back on error",
+			errs:         []error{failure},
+			wantErr:      failure,
+			wantAttempts: 1,
+		},
+		{
+			name:         "Retries serialization failures",
+			errs:         []error{conflict, deadlock, nil},
+			wantAttempts: 3,
+			wantRows:     1,
+		},
+		{
+			name:         "Gives up after five attempts",
+			errs:         []error{conflict, conflict, conflict, conflict, conflict, nil},
+			wantErr:      conflict,
+			wantAttempts: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _, err := database.Open("sqlite:"+filepath.Join(t.TempDir(), "tx.db"), nil)
+			if err != nil {
+				t.Fatalf("Failed to open database: %v", err)
+			}
+			defer db.Close()
+			if _, err := db.Exec("create table writes (n integer)"); err != nil {
+				t.Fatalf("Failed to create table: %v", err)
+			}
+
+			attempts := 0
+			err = database.RunInTx(context.Background(), db, nil, func(tx *sql.Tx) error {
+				attempts++
+				if _, err := tx.Exec("insert into writes (n) values (?)", attempts); err != nil {
+					return err
+				}
+				return tt.errs[attempts-1]
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RunInTx() error = %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("RunInTx() ran fn %d times, want %d", attempts, tt.wantAttempts)
+			}
+
+			var rows int
+			if err := db.QueryRow("select count(*) from writes").Scan(&rows); err != nil {
+				t.Fatalf("Failed to count rows: %v", err)
+			}
+			if rows != tt.wantRows {
+				t.Errorf("Expected %d committed rows, got %d", tt.wantRows, rows)
+			}
+		})
+	}
+}
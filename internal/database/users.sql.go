@@ -20,7 +20,7 @@ values (
 	$1,
 	$2
 )
-returning id, created_at, updated_at, email, hashed_password, is_chirpy_red
+returning id, created_at, updated_at, email, hashed_password, is_chirpy_red, disabled_at, role
 `
 
 type CreateUserParams struct {
@@ -38,12 +38,37 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DisabledAt,
+		&i.Role,
+	)
+	return i, err
+}
+
+const disableUserById = `-- name: DisableUserById :one
+update users
+set (disabled_at, updated_at) = (NOW(), NOW())
+where id = $1
+returning id, created_at, updated_at, email, hashed_password, is_chirpy_red, disabled_at, role
+`
+
+func (q *Queries) DisableUserById(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, disableUserById, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DisabledAt,
+		&i.Role,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-select id, created_at, updated_at, email, hashed_password, is_chirpy_red from users where email = $1
+select id, created_at, updated_at, email, hashed_password, is_chirpy_red, disabled_at, role from users where email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -56,12 +81,14 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DisabledAt,
+		&i.Role,
 	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-select id, created_at, updated_at, email, hashed_password, is_chirpy_red from users where id = $1
+select id, created_at, updated_at, email, hashed_password, is_chirpy_red, disabled_at, role from users where id = $1
 `
 
 func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
@@ -74,6 +101,72 @@ func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DisabledAt,
+		&i.Role,
+	)
+	return i, err
+}
+
+const listUsers = `-- name: ListUsers :many
+select id, created_at, updated_at, email, hashed_password, is_chirpy_red, disabled_at, role from users order by created_at
+`
+
+func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.DisabledAt,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setUserRole = `-- name: SetUserRole :one
+update users
+set (role, updated_at) = ($1, NOW())
+where id = $2
+returning id, created_at, updated_at, email, hashed_password, is_chirpy_red, disabled_at, role
+`
+
+type SetUserRoleParams struct {
+	Role string
+	ID   uuid.UUID
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.Role, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DisabledAt,
+		&i.Role,
 	)
 	return i, err
 }
@@ -82,7 +175,7 @@ const updateUserById = `-- name: UpdateUserById :one
 update users
 set (email, hashed_password, updated_at) = ($1, $2, NOW())
 where id = $3
-returning id, created_at, updated_at, email, hashed_password, is_chirpy_red
+returning id, created_at, updated_at, email, hashed_password, is_chirpy_red, disabled_at, role
 `
 
 type UpdateUserByIdParams struct {
@@ -101,6 +194,8 @@ func (q *Queries) UpdateUserById(ctx context.Context, arg UpdateUserByIdParams)
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DisabledAt,
+		&i.Role,
 	)
 	return i, err
 }
@@ -109,7 +204,7 @@ const upgradeUserById = `-- name: UpgradeUserById :one
 update users
 set (is_chirpy_red, updated_at) = ($1, NOW())
 where id = $2
-returning id, created_at, updated_at, email, hashed_password, is_chirpy_red
+returning id, created_at, updated_at, email, hashed_password, is_chirpy_red, disabled_at, role
 `
 
 type UpgradeUserByIdParams struct {
@@ -127,6 +222,8 @@ func (q *Queries) UpgradeUserById(ctx context.Context, arg UpgradeUserByIdParams
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DisabledAt,
+		&i.Role,
 	)
 	return i, err
 }
@@ -0,0 +1,248 @@
+// Package idempotency lets clients retry POST requests without repeating
+// their effects. The first request carrying an Idempotency-Key header runs
+// as usual and its response is stored; a retry with the same key and the
+// same body gets that response back instead of running again. Records live
+// in process memory for single instances or in Postgres when several
+// replicas must share them.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/common"
+	"github.com/cloudsmyth/chirpy/internal/logging"
+)
+
+// Header is the request header carrying the key.
+const Header = "Idempotency-Key"
+
+// maxKeyLength bounds keys so they cannot be used to store large values.
+const maxKeyLength = 255
+
+// storedHeaders are the response headers replayed with a stored response.
+// The rest describe the original exchange rather than its outcome.
+var storedHeaders = []string{"Content-Type", "Location", "ETag", "Last-Modified"}
+
+// pendingLease is how long a claim holds its key before a response is
+// stored. A retry after that runs afresh, so that a replica which died
+// mid-request does not block the key for the whole retention period.
+const pendingLease = time.Minute
+
+// Record is what a Store holds for one key.
+type Record struct {
+	// Fingerprint identifies the request that claimed the key.
+	Fingerprint string
+	// Status is zero while that request is still running.
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+type Store interface {
+	// Claim records a pending request under key unless a record younger
+	// than retention already holds it; a pending record only holds it for
+	// pendingLease. It returns true when the caller claimed the key, and
+	// the existing record otherwise.
+	Claim(ctx context.Context, scope, key, fingerprint string, retention time.Duration) (Record, bool, error)
+	// Complete stores the response to a claimed key.
+	Complete(ctx context.Context, scope, key string, record Record) error
+	// Release forgets a claimed key so that a retry runs afresh.
+	Release(ctx context.Context, scope, key string) error
+	// Sweep forgets records older than retention.
+	Sweep(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+// Keys applies idempotency keys to routes. Keys without a Store lets every
+// request through untouched.
+type Keys struct {
+	Store Store
+	// Retention is how long a key and its response are kept.
+	Retention time.Duration
+}
+
+// Wrap honours Idempotency-Key on next. Place it behind the auth
+// middleware, so that keys are scoped to the caller, and in front of the
+// rate limiter, so that replays do not use up the caller's allowance.
+func (k *Keys) Wrap(next http.Handler) http.Handler {
+	if k.Store == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			common.RespondWithProblem(w, r, common.CodeInvalidParameter,
+				fmt.Sprintf("%s must be at most %d characters", Header, maxKeyLength), nil)
+			return
+		}
+
+		// Bodies too large to decode are rejected by the handler, so
+		// there is nothing to protect; pass them through whole.
+		body, err := io.ReadAll(io.LimitReader(r.Body, common.DefaultMaxBodyBytes+1))
+		if err != nil {
+			common.RespondWithProblem(w, r, common.CodeMalformedBody, "Could not read request body", err)
+			return
+		}
+		if len(body) > common.DefaultMaxBodyBytes {
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Anonymous callers share a scope per route, so that a signup and
+		// a webhook sent with the same key do not collide.
+		ctx := r.Context()
+		scope := "anonymous:" + r.Method + " " + r.URL.Path
+		if principal, ok := auth.PrincipalFromContext(ctx); ok {
+			scope = "user:" + principal.UserID.String()
+		}
+		fingerprint := fingerprint(r, body)
+
+		record, claimed, err := k.Store.Claim(ctx, scope, key, fingerprint, k.Retention)
+		if err != nil {
+			common.RespondWithProblem(w, r, common.CodeInternal, "Could not check idempotency key", err)
+			return
+		}
+		if !claimed {
+			replay(w, r, record, fingerprint)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w}
+		stored := false
+		defer func() {
+			// Runs on panics too, so a crashed request does not hold
+			// the key until it expires.
+			if !stored {
+				if err := k.Store.Release(context.WithoutCancel(ctx), scope, key); err != nil {
+					logging.FromContext(ctx).Warn("Could not release idempotency key", "error", err)
+				}
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if !replayable(status) {
+			return
+		}
+		record = Record{Fingerprint: fingerprint, Status: status, Header: http.Header{}, Body: rec.body.Bytes()}
+		for _, name := range storedHeaders {
+			if value := rec.Header().Values(name); len(value) > 0 {
+				record.Header[http.CanonicalHeaderKey(name)] = value
+			}
+		}
+		if err := k.Store.Complete(context.WithoutCancel(ctx), scope, key, record); err != nil {
+			logging.FromContext(ctx).Warn("Could not store idempotent response", "error", err)
+			return
+		}
+		stored = true
+	})
+}
+
+// fingerprint identifies a request by its method, path and body, so that a
+// key reused for a different request is caught.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.Path)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, r *http.Request, record Record, fingerprint string) {
+	switch {
+	case record.Fingerprint != fingerprint:
+		common.RespondWithProblem(w, r, common.CodeIdempotencyKeyReused,
+			"This idempotency key was used for a different request", errors.New("request fingerprint differs"))
+	case record.Status == 0:
+		common.RespondWithProblem(w, r, common.CodeIdempotencyKeyInUse,
+			"A request with this idempotency key is still in progress", nil)
+	default:
+		for name, values := range record.Header {
+			w.Header()[name] = slices.Clone(values)
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(record.Status)
+		w.Write(record.Body)
+	}
+}
+
+// replayable reports whether a response is the outcome of the request
+// itself. Server errors, authentication failures and rate limiting depend
+// on when and how the request was sent, so a retry runs afresh.
+func replayable(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return false
+	}
+	return status < http.StatusInternalServerError
+}
+
+// recorder keeps a copy of the response while writing it through.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Run sweeps expired records every interval until ctx is cancelled.
+func (k *Keys) Run(ctx context.Context, interval time.Duration) {
+	if k.Store == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			swept, err := k.Store.Sweep(ctx, k.Retention)
+			if err != nil {
+				slog.Error("Idempotency key sweep failed", "error", err)
+				continue
+			}
+			slog.Debug("Swept expired idempotency keys", "count", swept)
+		}
+	}
+}
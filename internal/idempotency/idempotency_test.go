@@ -0,0 +1,267 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, claimed, _ := store.Claim(ctx, "anonymous", "key", "a", time.Hour); !claimed {
+		t.Fatal("Expected a new key to be claimed")
+	}
+	if record, claimed, _ := store.Claim(ctx, "anonymous", "key", "b", time.Hour); claimed || record.Fingerprint != "a" {
+		t.Fatalf("Claim of a held key = %+v, %v, want the first record", record, claimed)
+	}
+	if _, claimed, _ := store.Claim(ctx, "user:1", "key", "b", time.Hour); !claimed {
+		t.Error("Expected keys to be independent per scope")
+	}
+
+	now = now.Add(time.Hour)
+	if _, claimed, _ := store.Claim(ctx, "anonymous", "key", "b", time.Hour); !claimed {
+		t.Error("Expected an expired key to be claimed again")
+	}
+
+	now = now.Add(time.Minute)
+	swept, _ := store.Sweep(ctx, time.Hour)
+	if swept != 1 || len(store.records) != 1 {
+		t.Errorf("Sweep removed %d records, %d left", swept, len(store.records))
+	}
+}
+
+func TestMemoryStoreLease(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	store.Claim(ctx, "anonymous", "pending", "a", time.Hour)
+	store.Claim(ctx, "anonymous", "done", "a", time.Hour)
+	store.Complete(ctx, "anonymous", "done", Record{Fingerprint: "a", Status: http.StatusCreated})
+
+	now = now.Add(pendingLease - time.Second)
+	if _, claimed, _ := store.Claim(ctx, "anonymous", "pending", "a", time.Hour); claimed {
+		t.Error("Expected a pending key to be held within its lease")
+	}
+
+	now = now.Add(time.Second)
+	if _, claimed, _ := store.Claim(ctx, "anonymous", "pending", "a", time.Hour); !claimed {
+		t.Error("Expected a pending key to be taken over once its lease ran out")
+	}
+	if record, claimed, _ := store.Claim(ctx, "anonymous", "done", "a", time.Hour); claimed || record.Status != http.StatusCreated {
+		t.Errorf("Claim of a completed key = %+v, %v, want its response kept for the retention period", record, claimed)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	alice := &auth.Principal{UserID: uuid.New()}
+	bob := &auth.Principal{UserID: uuid.New()}
+
+	type request struct {
+		principal *auth.Principal
+		key       string
+		body      string
+		// path defaults to /api/chirps.
+		path string
+		// status is what the handler answers if it runs.
+		status int
+	}
+	tests := []struct {
+		name       string
+		requests   []request
+		wantStatus []int
+		wantRuns   int
+	}{
+		{
+			name: "No key",
+			requests: []request{
+				{principal: alice, body: "a", status: http.StatusCreated},
+				{principal: alice, body: "a", status: http.StatusCreated},
+			},
+			wantStatus: []int{http.StatusCreated, http.StatusCreated},
+			wantRuns:   2,
+		},
+		{
+			name: "Retry is replayed",
+			requests: []request{
+				{principal: alice, key: "k", body: "a", status: http.StatusCreated},
+				{principal: alice, key: "k", body: "a", status: http.StatusCreated},
+			},
+			wantStatus: []int{http.StatusCreated, http.StatusCreated},
+			wantRuns:   1,
+		},
+		{
+			name: "Client errors are replayed",
+			requests: []request{
+				{principal: alice, key: "k", body: "a", status: http.StatusBadRequest},
+				{principal: alice, key: "k", body: "a", status: http.StatusCreated},
+			},
+			wantStatus: []int{http.StatusBadRequest, http.StatusBadRequest},
+			wantRuns:   1,
+		},
+		{
+			name: "Different body",
+			requests: []request{
+				{principal: alice, key: "k", body: "a", status: http.StatusCreated},
+				{principal: alice, key: "k", body: "b", status: http.StatusCreated},
+			},
+			wantStatus: []int{http.StatusCreated, http.StatusUnprocessableEntity},
+			wantRuns:   1,
+		},
+		{
+			name: "Different users",
+			requests: []request{
+				{principal: alice, key: "k", body: "a", status: http.StatusCreated},
+				{principal: bob, key: "k", body: "a", status: http.StatusCreated},
+			},
+			wantStatus: []int{http.StatusCreated, http.StatusCreated},
+			wantRuns:   2,
+		},
+		{
+			name: "Anonymous requests to different routes",
+			requests: []request{
+				{key: "k", path: "/api/users", body: "a", status: http.StatusCreated},
+				{key: "k", path: "/api/polka/webhooks", body: "a", status: http.StatusNoContent},
+				{key: "k", path: "/api/users", body: "a", status: http.StatusCreated},
+			},
+			wantStatus: []int{http.StatusCreated, http.StatusNoContent, http.StatusCreated},
+			wantRuns:   2,
+		},
+		{
+			name: "Server errors are retried",
+			requests: []request{
+				{principal: alice, key: "k", body: "a", status: http.StatusInternalServerError},
+				{principal: alice, key: "k", body: "a", status: http.StatusCreated},
+				{principal: alice, key: "k", body: "a", status: http.StatusCreated},
+			},
+			wantStatus: []int{http.StatusInternalServerError, http.StatusCreated, http.StatusCreated},
+			wantRuns:   2,
+		},
+		{
+			name: "Authentication failures are retried",
+			requests: []request{
+				{key: "k", body: "a", status: http.StatusUnauthorized},
+				{key: "k", body: "a", status: http.StatusOK},
+			},
+			wantStatus: []int{http.StatusUnauthorized, http.StatusOK},
+			wantRuns:   2,
+		},
+		{
+			name: "Key too long",
+			requests: []request{
+				{principal: alice, key: strings.Repeat("k", maxKeyLength+1), body: "a", status: http.StatusCreated},
+			},
+			wantStatus: []int{http.StatusBadRequest},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := &Keys{Store: NewMemoryStore(), Retention: time.Hour}
+			runs := 0
+
+			for i, req := range tt.requests {
+				next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					runs++
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(req.status)
+					w.Write([]byte(`{}`))
+				})
+				path := req.path
+				if path == "" {
+					path = "/api/chirps"
+				}
+				r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(req.body))
+				if req.key != "" {
+					r.Header.Set(Header, req.key)
+				}
+				if req.principal != nil {
+					r = r.WithContext(auth.NewContext(r.Context(), req.principal))
+				}
+				rec := httptest.NewRecorder()
+
+				keys.Wrap(next).ServeHTTP(rec, r)
+
+				if rec.Code != tt.wantStatus[i] {
+					t.Errorf("Request %d: status = %d, want %d", i+1, rec.Code, tt.wantStatus[i])
+				}
+			}
+			if runs != tt.wantRuns {
+				t.Errorf("Handler ran %d times, want %d", runs, tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestWrapReplaysResponse(t *testing.T) {
+	keys := &Keys{Store: NewMemoryStore(), Retention: time.Hour}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"1"`)
+		w.Header().Set("RateLimit-Remaining", "3")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	})
+
+	send := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{}`))
+		r.Header.Set(Header, "signup-1")
+		rec := httptest.NewRecorder()
+		keys.Wrap(next).ServeHTTP(rec, r)
+		return rec
+	}
+	first, retry := send(), send()
+
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() {
+		t.Errorf("Replayed %d %s, want %d %s", retry.Code, retry.Body, first.Code, first.Body)
+	}
+	if retry.Header().Get("ETag") != `"1"` || retry.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Replayed headers %v", retry.Header())
+	}
+	if retry.Header().Get("RateLimit-Remaining") != "" {
+		t.Error("Expected headers about the original exchange not to be replayed")
+	}
+	if first.Header().Get("Idempotent-Replayed") != "" || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("Expected only the retry to be marked as replayed")
+	}
+}
+
+func TestWrapInProgress(t *testing.T) {
+	keys := &Keys{Store: NewMemoryStore(), Retention: time.Hour}
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	send := func(handler http.Handler) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader("a"))
+		r.Header.Set(Header, "k")
+		rec := httptest.NewRecorder()
+		keys.Wrap(handler).ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	done := make(chan int)
+	go func() { done <- send(slow) }()
+	<-started
+	if status := send(slow); status != http.StatusConflict {
+		t.Errorf("Concurrent retry: status = %d, want 409", status)
+	}
+	close(release)
+	if status := <-done; status != http.StatusCreated {
+		t.Errorf("First request: status = %d, want 201", status)
+	}
+}
@@ -0,0 +1,80 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps records in process memory. Each replica keeps its own,
+// so use PostgresStore when running more than one.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[memoryKey]*memoryRecord
+	now     func() time.Time
+}
+
+type memoryKey struct {
+	scope, key string
+}
+
+type memoryRecord struct {
+	Record
+	created time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: map[memoryKey]*memoryRecord{},
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryStore) Claim(ctx context.Context, scope, key, fingerprint string, retention time.Duration) (Record, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	k := memoryKey{scope, key}
+	if r, ok := m.records[k]; ok {
+		age := now.Sub(r.created)
+		if age < retention && (r.Status != 0 || age < pendingLease) {
+			return r.Record, false, nil
+		}
+	}
+	m.records[k] = &memoryRecord{Record: Record{Fingerprint: fingerprint}, created: now}
+	return Record{}, true, nil
+}
+
+func (m *MemoryStore) Complete(ctx context.Context, scope, key string, record Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.records[memoryKey{scope, key}]; ok {
+		r.Record = record
+	}
+	return nil
+}
+
+func (m *MemoryStore) Release(ctx context.Context, scope, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, memoryKey{scope, key})
+	return nil
+}
+
+func (m *MemoryStore) Sweep(ctx context.Context, retention time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var swept int64
+	cutoff := m.now().Add(-retention)
+	for k, r := range m.records {
+		if r.created.Before(cutoff) {
+			delete(m.records, k)
+			swept++
+		}
+	}
+	return swept, nil
+}
@@ -0,0 +1,84 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+)
+
+// PostgresStore shares records between replicas through the
+// idempotency_keys table. Claiming is a single upsert, so of two concurrent
+// requests with the same key exactly one claims it.
+type PostgresStore struct {
+	q *database.Queries
+}
+
+func NewPostgresStore(q *database.Queries) *PostgresStore {
+	return &PostgresStore{q: q}
+}
+
+func (s *PostgresStore) Claim(ctx context.Context, scope, key, fingerprint string, retention time.Duration) (Record, bool, error) {
+	_, err := s.q.ClaimIdempotencyKey(ctx, database.ClaimIdempotencyKeyParams{
+		Scope:            scope,
+		Key:              key,
+		Fingerprint:      fingerprint,
+		RetentionSeconds: retention.Seconds(),
+		LeaseSeconds:     pendingLease.Seconds(),
+	})
+	if err == nil {
+		return Record{}, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Record{}, false, err
+	}
+
+	row, err := s.q.GetIdempotencyKey(ctx, database.GetIdempotencyKeyParams{Scope: scope, Key: key})
+	if err != nil {
+		// Released between the two queries: report it as in progress
+		// rather than claim it on a second round trip.
+		if errors.Is(err, sql.ErrNoRows) {
+			return Record{Fingerprint: fingerprint}, false, nil
+		}
+		return Record{}, false, err
+	}
+	record := Record{
+		Fingerprint: row.Fingerprint,
+		Status:      int(row.ResponseStatus),
+		Body:        row.ResponseBody,
+	}
+	if err := json.Unmarshal(row.ResponseHeader, &record.Header); err != nil {
+		return Record{}, false, err
+	}
+	return record, false, nil
+}
+
+func (s *PostgresStore) Complete(ctx context.Context, scope, key string, record Record) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+	// A nil slice would be sent as NULL.
+	body := record.Body
+	if body == nil {
+		body = []byte{}
+	}
+	return s.q.CompleteIdempotencyKey(ctx, database.CompleteIdempotencyKeyParams{
+		Scope:          scope,
+		Key:            key,
+		ResponseStatus: int32(record.Status),
+		ResponseHeader: header,
+		ResponseBody:   body,
+	})
+}
+
+func (s *PostgresStore) Release(ctx context.Context, scope, key string) error {
+	return s.q.DeleteIdempotencyKey(ctx, database.DeleteIdempotencyKeyParams{Scope: scope, Key: key})
+}
+
+func (s *PostgresStore) Sweep(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.q.DeleteExpiredIdempotencyKeys(ctx, retention.Seconds())
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// New builds a logger writing to w in either "json" or "text" format.
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+type contextKey struct{}
+
+// requestState is shared by pointer so that attributes added deep inside a
+// handler, such as the authenticated user, also show up on the access log.
+type requestState struct {
+	logger *slog.Logger
+}
+
+func newContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestState{logger: logger})
+}
+
+// FromContext returns the request-scoped logger, or the default logger when
+// ctx does not belong to a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	if state, ok := ctx.Value(contextKey{}).(*requestState); ok {
+		return state.logger
+	}
+	return slog.Default()
+}
+
+// With adds attributes to the request-scoped logger for the rest of the
+// request, including its access log line.
+func With(ctx context.Context, args ...any) {
+	if state, ok := ctx.Value(contextKey{}).(*requestState); ok {
+		state.logger = state.logger.With(args...)
+	}
+}
+
+// SetUserID records the authenticated user on the request logger.
+func SetUserID(ctx context.Context, userID uuid.UUID) {
+	With(ctx, slog.String("user_id", userID.String()))
+}
@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestMiddleware(t *testing.T) {
+	userID := uuid.New()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpId}", func(w http.ResponseWriter, r *http.Request) {
+		SetUserID(r.Context(), userID)
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+
+	tests := []struct {
+		name          string
+		requestID     string
+		wantRequestID string
+	}{
+		{
+			name:          "Propagates client request ID",
+			requestID:     "abc-123",
+			wantRequestID: "abc-123",
+		},
+		{
+			name:      "Generates request ID when missing",
+			requestID: "",
+		},
+		{
+			name:      "Replaces request ID with control characters",
+			requestID: "bad\tid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := New(&buf, "json", "info")
+			if err != nil {
+				t.Fatalf("Failed to create logger: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps/42", nil)
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			rr := httptest.NewRecorder()
+			Middleware(logger, mux).ServeHTTP(rr, req)
+
+			gotID := rr.Header().Get(RequestIDHeader)
+			if tt.wantRequestID != "" && gotID != tt.wantRequestID {
+				t.Errorf("Expected request ID %q, got %q", tt.wantRequestID, gotID)
+			}
+			if tt.wantRequestID == "" {
+				if _, err := uuid.Parse(gotID); err != nil {
+					t.Errorf("Expected generated UUID request ID, got %q", gotID)
+				}
+			}
+
+			var line map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+				t.Fatalf("Expected one JSON access log line, got %q", buf.String())
+			}
+			want := map[string]any{
+				"msg":        "request",
+				"request_id": gotID,
+				"route":      "GET /api/chirps/{chirpId}",
+				"status":     float64(http.StatusTeapot),
+				"bytes":      float64(len("short and stout")),
+				"user_id":    userID.String(),
+			}
+			for key, value := range want {
+				if line[key] != value {
+					t.Errorf("Expected %s = %v, got %v", key, value, line[key])
+				}
+			}
+			if _, ok := line["duration"]; !ok {
+				t.Error("Expected duration in access log")
+			}
+		})
+	}
+}
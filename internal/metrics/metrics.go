@@ -0,0 +1,244 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const namespace = "chirpy"
+
+// Metrics owns the Prometheus registry and every collector the server
+// exports. The admin page and GET /metrics both read from Registry.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	// FileServerHits is exported through a CounterFunc and only ever
+	// grows. The dev-only reset endpoint zeroes what the admin page shows
+	// by recording a baseline in hitsAtReset instead.
+	FileServerHits atomic.Int64
+	hitsAtReset    atomic.Int64
+
+	RequestsTotal    *prometheus.CounterVec
+	RequestDuration  *prometheus.HistogramVec
+	RequestsInFlight prometheus.Gauge
+	LoginAttempts    *prometheus.CounterVec
+	ChirpsCreated    prometheus.Counter
+	TokensPurged     prometheus.Counter
+	TokenCleanupRuns prometheus.Counter
+	RateLimited      *prometheus.CounterVec
+	// ChirpCacheRequests counts chirp reads by query and by whether the
+	// cache answered them: hit, miss, or bypass for reads that must see the
+	// primary.
+	ChirpCacheRequests *prometheus.CounterVec
+	StreamSubscribers  prometheus.Gauge
+}
+
+// New registers the application collectors, the Go runtime and process
+// collectors, and connection pool stats for db when it is not nil.
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		RequestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route pattern, method and status class.",
+		}, []string{"route", "method", "status"}),
+		RequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route pattern and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		RequestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests currently being served.",
+		}),
+		LoginAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "login_attempts_total",
+			Help:      "Login attempts by result.",
+		}, []string{"result"}),
+		ChirpsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "chirps_created_total",
+			Help:      "Chirps created.",
+		}),
+		TokensPurged: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "refresh_tokens_purged_total",
+			Help:      "Expired or revoked refresh tokens deleted by the cleanup task.",
+		}),
+		TokenCleanupRuns: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "refresh_token_cleanup_runs_total",
+			Help:      "Completed refresh token cleanup runs.",
+		}),
+		RateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_requests_total",
+			Help:      "Requests rejected by the rate limiter, by policy.",
+		}, []string{"policy"}),
+		ChirpCacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "chirp_cache_requests_total",
+			Help:      "Cached chirp reads by query and result.",
+		}, []string{"query", "result"}),
+		StreamSubscribers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "stream_subscribers",
+			Help:      "Clients connected to the chirp event stream.",
+		}),
+	}
+
+	m.Registry.MustRegister(
+		m.RequestsTotal,
+		m.RequestDuration,
+		m.RequestsInFlight,
+		m.LoginAttempts,
+		m.ChirpsCreated,
+		m.TokensPurged,
+		m.TokenCleanupRuns,
+		m.RateLimited,
+		m.ChirpCacheRequests,
+		m.StreamSubscribers,
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fileserver_hits_total",
+			Help:      "Requests served by the /app file server.",
+		}, func() float64 { return float64(m.FileServerHits.Load()) }),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		m.Registry.MustRegister(collectors.NewDBStatsCollector(db, "chirpy"))
+	}
+
+	// Pre-populate both login results so dashboards show zero instead of
+	// no data before the first attempt.
+	m.LoginAttempts.WithLabelValues("success")
+	m.LoginAttempts.WithLabelValues("failure")
+
+	return m
+}
+
+// FileServerHitsSinceReset is the number of file server hits since the last
+// ResetFileServerHits.
+func (m *Metrics) FileServerHitsSinceReset() int64 {
+	return m.FileServerHits.Load() - m.hitsAtReset.Load()
+}
+
+// ResetFileServerHits zeroes FileServerHitsSinceReset. The exported counter
+// keeps counting, so rate() does not mistake a reset for a restart.
+func (m *Metrics) ResetFileServerHits() {
+	m.hitsAtReset.Store(m.FileServerHits.Load())
+}
+
+// Handler serves the registry in the Prometheus text exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// Value sums the samples of a counter or gauge family whose labels match the
+// given name/value pairs, returning 0 when nothing matches.
+func (m *Metrics) Value(name string, labelPairs ...string) float64 {
+	families, err := m.Registry.Gather()
+	if err != nil {
+		return 0
+	}
+
+	var total float64
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if !hasLabels(metric, labelPairs) {
+				continue
+			}
+			switch {
+			case metric.GetCounter() != nil:
+				total += metric.GetCounter().GetValue()
+			case metric.GetGauge() != nil:
+				total += metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return total
+}
+
+func hasLabels(metric *dto.Metric, labelPairs []string) bool {
+	for i := 0; i+1 < len(labelPairs); i += 2 {
+		found := false
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == labelPairs[i] && label.GetValue() == labelPairs[i+1] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Middleware records request counts, latency and in-flight requests. It must
+// wrap the ServeMux directly so the matched route pattern is available once
+// the request has been served.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.RequestsInFlight.Inc()
+		defer m.RequestsInFlight.Dec()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+
+		m.RequestsTotal.WithLabelValues(route, r.Method, statusClass(rec.status)).Inc()
+		m.RequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+func statusClass(code int) string {
+	return strconv.Itoa(code/100) + "xx"
+}
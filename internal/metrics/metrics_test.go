@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := New(nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpId}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	handler := m.Middleware(mux)
+
+	for _, path := range []string{"/api/chirps/1", "/api/chirps/2", "/api/healthz", "/nope"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	tests := []struct {
+		name   string
+		labels []string
+		want   float64
+	}{
+		{
+			name:   "Requests grouped by route pattern",
+			labels: []string{"route", "GET /api/chirps/{chirpId}", "status", "4xx"},
+			want:   2,
+		},
+		{
+			name:   "Implicit 200 counted as 2xx",
+			labels: []string{"route", "GET /api/healthz", "status", "2xx"},
+			want:   1,
+		},
+		{
+			name:   "Unmatched routes share one label",
+			labels: []string{"route", "unmatched"},
+			want:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := m.Value("chirpy_http_requests_total", tt.labels...)
+			if got != tt.want {
+				t.Errorf("Expected %v requests, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if inFlight := m.Value("chirpy_http_requests_in_flight"); inFlight != 0 {
+		t.Errorf("Expected no requests in flight, got %v", inFlight)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m := New(nil)
+	m.FileServerHits.Add(3)
+	m.LoginAttempts.WithLabelValues("success").Inc()
+
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body, _ := io.ReadAll(rr.Body)
+	for _, want := range []string{
+		"chirpy_fileserver_hits_total 3",
+		`chirpy_login_attempts_total{result="success"} 1`,
+		`chirpy_login_attempts_total{result="failure"} 0`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected exposition to contain %q", want)
+		}
+	}
+}
+
+func TestResetFileServerHits(t *testing.T) {
+	m := New(nil)
+	m.FileServerHits.Add(3)
+	m.ResetFileServerHits()
+	m.FileServerHits.Add(2)
+
+	if since := m.FileServerHitsSinceReset(); since != 2 {
+		t.Errorf("Expected 2 hits since the reset, got %d", since)
+	}
+	if total := m.Value("chirpy_fileserver_hits_total"); total != 5 {
+		t.Errorf("Expected the exported counter to keep counting through a reset, got %v", total)
+	}
+}
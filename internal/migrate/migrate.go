@@ -0,0 +1,116 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/sql/schema"
+	sqliteschema "github.com/cloudsmyth/chirpy/sql/sqlite/schema"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// NewProvider returns a goose provider over the embedded migrations for
+// backend. On Postgres every migration run takes an advisory lock first, so
+// replicas started at the same time apply each migration exactly once. A
+// SQLite file has a single writer and needs no lock.
+func NewProvider(db *sql.DB, backend string) (*goose.Provider, error) {
+	if backend == database.BackendSQLite {
+		return goose.NewProvider(goose.DialectSQLite3, db, sqliteschema.FS)
+	}
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, db, schema.FS, goose.WithSessionLocker(locker))
+}
+
+// LatestVersion is the newest migration embedded in the binary.
+func LatestVersion(p *goose.Provider) int64 {
+	sources := p.ListSources()
+	if len(sources) == 0 {
+		return 0
+	}
+	return sources[len(sources)-1].Version
+}
+
+// CheckVersion refuses to run against a database that was migrated by a newer
+// build, since this binary's queries may not match that schema.
+func CheckVersion(ctx context.Context, p *goose.Provider) error {
+	current, err := p.GetDBVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if latest := LatestVersion(p); current > latest {
+		return fmt.Errorf("database schema version %d is newer than the latest migration this binary knows (%d)", current, latest)
+	}
+	return nil
+}
+
+// Run executes one of the migrate subcommands: up, down, status or redo.
+func Run(ctx context.Context, p *goose.Provider, command string, out io.Writer) error {
+	switch command {
+	case "up":
+		results, err := p.Up(ctx)
+		for _, result := range results {
+			fmt.Fprintln(out, result)
+		}
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			fmt.Fprintln(out, "No migrations to apply")
+		}
+		return nil
+
+	case "down":
+		result, err := p.Down(ctx)
+		if errors.Is(err, goose.ErrNoNextVersion) {
+			fmt.Fprintln(out, "No migrations to roll back")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, result)
+		return nil
+
+	case "redo":
+		down, err := p.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, down)
+		up, err := p.UpByOne(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, up)
+		return nil
+
+	case "status":
+		statuses, err := p.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tSTATE\tAPPLIED AT\tSOURCE")
+		for _, status := range statuses {
+			appliedAt := "-"
+			if !status.AppliedAt.IsZero() {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", status.Source.Version, status.State, appliedAt, status.Source.Path)
+		}
+		return tw.Flush()
+
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down, status or redo", command)
+	}
+}
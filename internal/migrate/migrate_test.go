@@ -0,0 +1,105 @@
+package migrate
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/sql/schema"
+	sqliteschema "github.com/cloudsmyth/chirpy/sql/sqlite/schema"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		dbURL   string
+		fsys    fs.FS
+	}{
+		{
+			name:    "Postgres",
+			backend: database.BackendPostgres,
+			dbURL:   "postgres://localhost/chirpy_test",
+			fsys:    schema.FS,
+		},
+		{
+			name:    "SQLite",
+			backend: database.BackendSQLite,
+			dbURL:   "sqlite:" + filepath.Join(t.TempDir(), "chirpy.db"),
+			fsys:    sqliteschema.FS,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := fs.Glob(tt.fsys, "*.sql")
+			if err != nil {
+				t.Fatalf("Failed to list embedded migrations: %v", err)
+			}
+
+			// Opening does not connect, so the provider can be built and
+			// its sources inspected without a running Postgres.
+			db, backend, err := database.Open(tt.dbURL, nil)
+			if err != nil {
+				t.Fatalf("Failed to open database handle: %v", err)
+			}
+			defer db.Close()
+			if backend != tt.backend {
+				t.Errorf("Expected backend %q, got %q", tt.backend, backend)
+			}
+
+			p, err := NewProvider(db, backend)
+			if err != nil {
+				t.Fatalf("Failed to create provider: %v", err)
+			}
+
+			sources := p.ListSources()
+			if len(sources) != len(files) {
+				t.Errorf("Expected %d migrations, got %d", len(files), len(sources))
+			}
+			if got := LatestVersion(p); got != int64(len(files)) {
+				t.Errorf("Expected latest version %d, got %d", len(files), got)
+			}
+
+			if err := Run(context.Background(), p, "sideways", io.Discard); err == nil {
+				t.Error("Expected an error for an unknown command, got none")
+			}
+		})
+	}
+}
+
+// SQLite needs no server, so its migrations can be applied and rolled back
+// for real.
+func TestSQLiteMigrationsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db, backend, err := database.Open("sqlite:"+filepath.Join(t.TempDir(), "chirpy.db"), nil)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	p, err := NewProvider(db, backend)
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	if _, err := p.Up(ctx); err != nil {
+		t.Fatalf("Failed to apply migrations: %v", err)
+	}
+	if err := CheckVersion(ctx, p); err != nil {
+		t.Errorf("Expected the migrated schema to pass the version check, got %v", err)
+	}
+	if _, err := p.DownTo(ctx, 0); err != nil {
+		t.Fatalf("Failed to roll back migrations: %v", err)
+	}
+
+	var tables int
+	if err := db.QueryRow("select count(*) from sqlite_master where type = 'table' and name not in ('goose_db_version', 'sqlite_sequence')").Scan(&tables); err != nil {
+		t.Fatalf("Failed to count tables: %v", err)
+	}
+	if tables != 0 {
+		t.Errorf("Expected no tables after rolling back, got %d", tables)
+	}
+}
@@ -0,0 +1,255 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/logging"
+)
+
+var scopeDescriptions = map[string]string{
+	auth.ScopeChirpsRead:   "Read chirps",
+	auth.ScopeChirpsWrite:  "Post and delete chirps as you",
+	auth.ScopeProfileWrite: "Change your email and password",
+}
+
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Authorize {{.Client}} - Chirpy</title>
+</head>
+<body>
+	<h1>Authorize {{.Client}}</h1>
+	{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+	<p>{{.Client}} would like to:</p>
+	<ul>
+		{{range .Scopes}}<li>{{.}}</li>{{end}}
+	</ul>
+	<form method="post" action="/oauth/authorize">
+		{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+		{{end}}
+		<label>Email <input type="email" name="email" autocomplete="username" required></label>
+		<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+		<button type="submit" name="action" value="approve">Allow</button>
+		<button type="submit" name="action" value="deny" formnovalidate>Deny</button>
+	</form>
+</body>
+</html>
+`))
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Authorization failed - Chirpy</title>
+</head>
+<body>
+	<h1>Authorization failed</h1>
+	<p>{{.}}</p>
+</body>
+</html>
+`))
+
+// authorizeParams are carried from the authorization request through the
+// consent form unchanged.
+var authorizeParams = []string{
+	"response_type",
+	"client_id",
+	"redirect_uri",
+	"scope",
+	"state",
+	"code_challenge",
+	"code_challenge_method",
+}
+
+type authorizeRequest struct {
+	client        Client
+	redirectURI   string
+	state         string
+	scopes        []string
+	codeChallenge string
+	params        map[string]string
+}
+
+// authorizeError is reported to the client by redirecting back to it, as
+// described in RFC 6749 section 4.1.2.1.
+type authorizeError struct {
+	code        string
+	description string
+}
+
+// parseAuthorizeRequest validates an authorization request. A non-nil error
+// means the client or redirect uri cannot be trusted and the user must be
+// shown an error instead of being redirected.
+func (s *Server) parseAuthorizeRequest(ctx context.Context, form url.Values) (*authorizeRequest, *authorizeError, error) {
+	client, err := s.Store.GetClient(ctx, form.Get("client_id"))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil, errors.New("Unknown client")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	redirectURI := form.Get("redirect_uri")
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		return nil, nil, errors.New("The redirect uri is not registered for this client")
+	}
+
+	req := &authorizeRequest{
+		client:        client,
+		redirectURI:   redirectURI,
+		state:         form.Get("state"),
+		codeChallenge: form.Get("code_challenge"),
+		params:        map[string]string{},
+	}
+	for _, name := range authorizeParams {
+		req.params[name] = form.Get(name)
+	}
+
+	if form.Get("response_type") != "code" {
+		return req, &authorizeError{"unsupported_response_type", "Only the code response type is supported"}, nil
+	}
+	if form.Get("code_challenge_method") != "S256" || len(req.codeChallenge) != 43 {
+		return req, &authorizeError{"invalid_request", "PKCE with the S256 method is required"}, nil
+	}
+	req.scopes, err = parseScope(form.Get("scope"))
+	if err != nil {
+		return req, &authorizeError{"invalid_scope", err.Error()}, nil
+	}
+	return req, nil, nil
+}
+
+func (req *authorizeRequest) redirect(w http.ResponseWriter, r *http.Request, query url.Values) {
+	u, _ := url.Parse(req.redirectURI)
+	q := u.Query()
+	for name, values := range query {
+		q[name] = values
+	}
+	if req.state != "" {
+		q.Set("state", req.state)
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (req *authorizeRequest) redirectError(w http.ResponseWriter, r *http.Request, e *authorizeError) {
+	req.redirect(w, r, url.Values{
+		"error":             {e.code},
+		"error_description": {e.description},
+	})
+}
+
+func setPageHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// The consent page takes a password, so it must never be framed.
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+}
+
+func renderError(w http.ResponseWriter, r *http.Request, code int, msg string, err error) {
+	logger := logging.FromContext(r.Context())
+	if code > 499 {
+		logger.Error("Responding with 5XX error", "status", code, "msg", msg, "error", err)
+	} else {
+		logger.Info("Authorization request rejected", "status", code, "msg", msg, "error", err)
+	}
+	setPageHeaders(w)
+	w.WriteHeader(code)
+	errorPage.Execute(w, msg)
+}
+
+func renderConsent(w http.ResponseWriter, code int, req *authorizeRequest, errMsg string) {
+	scopes := make([]string, 0, len(req.scopes))
+	for _, scope := range req.scopes {
+		scopes = append(scopes, scopeDescriptions[scope])
+	}
+	setPageHeaders(w)
+	w.WriteHeader(code)
+	consentPage.Execute(w, struct {
+		Client string
+		Scopes []string
+		Params map[string]string
+		Error  string
+	}{
+		Client: req.client.Name,
+		Scopes: scopes,
+		Params: req.params,
+		Error:  errMsg,
+	})
+}
+
+// AuthorizeHandler shows the consent page for an authorization request.
+func (s *Server) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	req, authErr, err := s.parseAuthorizeRequest(r.Context(), r.URL.Query())
+	if err != nil {
+		renderError(w, r, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if authErr != nil {
+		req.redirectError(w, r, authErr)
+		return
+	}
+
+	renderConsent(w, http.StatusOK, req, "")
+}
+
+// ConsentHandler handles the consent form. The user signs in and decides in
+// the same step; because the form needs the user's password, a forged
+// submission from another site cannot grant anything.
+func (s *Server) ConsentHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderError(w, r, http.StatusBadRequest, "Could not read form", err)
+		return
+	}
+
+	req, authErr, err := s.parseAuthorizeRequest(r.Context(), r.PostForm)
+	if err != nil {
+		renderError(w, r, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if authErr != nil {
+		req.redirectError(w, r, authErr)
+		return
+	}
+
+	if r.PostForm.Get("action") != "approve" {
+		req.redirectError(w, r, &authorizeError{"access_denied", "The user denied the request"})
+		return
+	}
+
+	user, err := s.Users.Authenticate(r.Context(), strings.TrimSpace(r.PostForm.Get("email")), r.PostForm.Get("password"))
+	if errors.Is(err, ErrNotFound) {
+		renderConsent(w, http.StatusUnauthorized, req, "Incorrect email or password")
+		return
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, "Could not sign in", err)
+		return
+	}
+	logging.SetUserID(r.Context(), user.ID)
+
+	code := auth.MakeRefreshToken()
+	if err := s.Store.CreateCode(r.Context(), AuthorizationCode{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      req.client.ID,
+		UserID:        user.ID,
+		RedirectURI:   req.redirectURI,
+		Scopes:        req.scopes,
+		CodeChallenge: req.codeChallenge,
+		ExpiresAt:     time.Now().Add(codeTTL),
+	}); err != nil {
+		renderError(w, r, http.StatusInternalServerError, "Could not create authorization code", err)
+		return
+	}
+
+	req.redirect(w, r, url.Values{"code": {code}})
+}
@@ -0,0 +1,101 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/common"
+)
+
+type clientResponse struct {
+	ClientID string `json:"client_id"`
+	// ClientSecret is only returned when a confidential client is
+	// registered; it is stored hashed and cannot be retrieved again.
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+// validRedirectURI accepts absolute https URIs without a fragment, and plain
+// http only for loopback addresses used by native apps (RFC 8252).
+func validRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("redirect uri %q must be absolute", raw)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect uri %q must not have a fragment", raw)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := u.Hostname(); host == "localhost" || net.ParseIP(host).IsLoopback() {
+			return nil
+		}
+	}
+	return fmt.Errorf("redirect uri %q must use https", raw)
+}
+
+// RegisterClientHandler registers a client owned by the calling user. It
+// must sit behind a middleware that stores the caller's auth.Principal.
+func (s *Server) RegisterClientHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type parameters struct {
+		Name         string   `json:"name" validate:"required,max=100"`
+		RedirectURIs []string `json:"redirect_uris" validate:"required"`
+		Confidential bool     `json:"confidential"`
+	}
+
+	principal := auth.MustPrincipal(r.Context())
+
+	params := parameters{}
+	if !common.DecodeJSON(w, r, &params) {
+		return
+	}
+
+	var fieldErrs []common.FieldError
+	for _, uri := range params.RedirectURIs {
+		if err := validRedirectURI(uri); err != nil {
+			fieldErrs = append(fieldErrs, common.FieldError{Field: "redirect_uris", Code: "invalid", Detail: err.Error()})
+		}
+	}
+	if fieldErrs != nil {
+		common.RespondWithFieldErrors(w, r, fieldErrs)
+		return
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	client := Client{
+		ID:           hex.EncodeToString(id),
+		Name:         params.Name,
+		OwnerID:      principal.UserID,
+		RedirectURIs: params.RedirectURIs,
+	}
+	var secret string
+	if params.Confidential {
+		secret = auth.MakeRefreshToken()
+		client.SecretHash = auth.HashToken(secret)
+	}
+
+	if err := s.Store.CreateClient(r.Context(), client); err != nil {
+		common.RespondWithProblem(w, r, common.CodeInternal, "Could not register client", err)
+		return
+	}
+
+	common.RespondWithJson(w, http.StatusCreated, clientResponse{
+		ClientID:     client.ID,
+		ClientSecret: secret,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIs,
+	})
+}
@@ -0,0 +1,154 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// DatabaseStore keeps clients, codes and grants in the main database and
+// implements Users on top of the users table.
+type DatabaseStore struct {
+	q database.OAuthStore
+}
+
+func NewDatabaseStore(q database.OAuthStore) *DatabaseStore {
+	return &DatabaseStore{q: q}
+}
+
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *DatabaseStore) CreateClient(ctx context.Context, client Client) error {
+	_, err := s.q.CreateOauthClient(ctx, database.CreateOauthClientParams{
+		ID:           client.ID,
+		OwnerID:      client.OwnerID,
+		Name:         client.Name,
+		SecretHash:   sql.NullString{String: client.SecretHash, Valid: client.SecretHash != ""},
+		RedirectUris: client.RedirectURIs,
+	})
+	return err
+}
+
+func (s *DatabaseStore) GetClient(ctx context.Context, id string) (Client, error) {
+	client, err := s.q.GetOauthClient(ctx, id)
+	if err != nil {
+		return Client{}, notFound(err)
+	}
+	return Client{
+		ID:           client.ID,
+		Name:         client.Name,
+		OwnerID:      client.OwnerID,
+		SecretHash:   client.SecretHash.String,
+		RedirectURIs: client.RedirectUris,
+	}, nil
+}
+
+func (s *DatabaseStore) CreateCode(ctx context.Context, code AuthorizationCode) error {
+	return s.q.CreateOauthAuthorizationCode(ctx, database.CreateOauthAuthorizationCodeParams{
+		CodeHash:      code.CodeHash,
+		ClientID:      code.ClientID,
+		UserID:        code.UserID,
+		RedirectUri:   code.RedirectURI,
+		Scopes:        code.Scopes,
+		CodeChallenge: code.CodeChallenge,
+		ExpiresAt:     code.ExpiresAt,
+	})
+}
+
+func (s *DatabaseStore) ConsumeCode(ctx context.Context, codeHash, clientID string) (AuthorizationCode, error) {
+	code, err := s.q.ConsumeOauthAuthorizationCode(ctx, database.ConsumeOauthAuthorizationCodeParams{
+		CodeHash: codeHash,
+		ClientID: clientID,
+	})
+	if err != nil {
+		return AuthorizationCode{}, notFound(err)
+	}
+	return AuthorizationCode{
+		CodeHash:      code.CodeHash,
+		ClientID:      code.ClientID,
+		UserID:        code.UserID,
+		RedirectURI:   code.RedirectUri,
+		Scopes:        code.Scopes,
+		CodeChallenge: code.CodeChallenge,
+		ExpiresAt:     code.ExpiresAt,
+	}, nil
+}
+
+func newGrant(grant database.OauthGrant) Grant {
+	return Grant{
+		ID:        grant.ID,
+		ClientID:  grant.ClientID,
+		UserID:    grant.UserID,
+		TokenHash: grant.TokenHash,
+		Scopes:    grant.Scopes,
+		ExpiresAt: grant.ExpiresAt,
+		Revoked:   grant.RevokedAt.Valid,
+	}
+}
+
+func (s *DatabaseStore) CreateGrant(ctx context.Context, grant Grant) (Grant, error) {
+	created, err := s.q.CreateOauthGrant(ctx, database.CreateOauthGrantParams{
+		ClientID:  grant.ClientID,
+		UserID:    grant.UserID,
+		TokenHash: grant.TokenHash,
+		Scopes:    grant.Scopes,
+		ExpiresAt: grant.ExpiresAt,
+	})
+	if err != nil {
+		return Grant{}, err
+	}
+	return newGrant(created), nil
+}
+
+func (s *DatabaseStore) GetGrant(ctx context.Context, tokenHash string) (Grant, error) {
+	grant, err := s.q.GetOauthGrantByTokenHash(ctx, tokenHash)
+	if err != nil {
+		return Grant{}, notFound(err)
+	}
+	return newGrant(grant), nil
+}
+
+func (s *DatabaseStore) RevokeGrant(ctx context.Context, id uuid.UUID) error {
+	revoked, err := s.q.RevokeOauthGrant(ctx, id)
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *DatabaseStore) Authenticate(ctx context.Context, email, password string) (User, error) {
+	user, err := s.q.GetUserByEmail(ctx, email)
+	if err != nil {
+		return User{}, notFound(err)
+	}
+	if err := auth.CheckHashedPassword(user.HashedPassword, password); err != nil {
+		return User{}, ErrNotFound
+	}
+	if user.DisabledAt.Valid {
+		return User{}, ErrNotFound
+	}
+	return User{ID: user.ID, Role: user.Role}, nil
+}
+
+func (s *DatabaseStore) Get(ctx context.Context, id uuid.UUID) (User, error) {
+	user, err := s.q.GetUserById(ctx, id)
+	if err != nil {
+		return User{}, notFound(err)
+	}
+	if user.DisabledAt.Valid {
+		return User{}, ErrNotFound
+	}
+	return User{ID: user.ID, Role: user.Role}, nil
+}
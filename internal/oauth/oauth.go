@@ -0,0 +1,154 @@
+// Package oauth is an OAuth 2.0 authorization server (RFC 6749) that lets
+// third-party clients act for Chirpy users. It supports the authorization
+// code grant with PKCE (RFC 7636), refresh tokens and token revocation
+// (RFC 7009). Access tokens are scoped JWTs, so the API validates them on
+// the same path as session tokens.
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned by Store and Users lookups that match nothing.
+var ErrNotFound = errors.New("oauth: not found")
+
+type Client struct {
+	ID      string
+	Name    string
+	OwnerID uuid.UUID
+	// SecretHash is empty for public clients, such as mobile apps, which
+	// cannot keep a secret and rely on PKCE alone.
+	SecretHash   string
+	RedirectURIs []string
+}
+
+func (c Client) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        uuid.UUID
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+// Grant is a user's standing authorization of a client, represented to the
+// client by a refresh token.
+type Grant struct {
+	ID        uuid.UUID
+	ClientID  string
+	UserID    uuid.UUID
+	TokenHash string
+	Scopes    []string
+	ExpiresAt time.Time
+	Revoked   bool
+}
+
+type User struct {
+	ID   uuid.UUID
+	Role string
+}
+
+type Store interface {
+	CreateClient(ctx context.Context, client Client) error
+	GetClient(ctx context.Context, id string) (Client, error)
+	CreateCode(ctx context.Context, code AuthorizationCode) error
+	// ConsumeCode removes and returns the code, so each code is redeemed at
+	// most once even under concurrent requests. A code issued to another
+	// client is reported as ErrNotFound and left for its own client.
+	ConsumeCode(ctx context.Context, codeHash, clientID string) (AuthorizationCode, error)
+	CreateGrant(ctx context.Context, grant Grant) (Grant, error)
+	GetGrant(ctx context.Context, tokenHash string) (Grant, error)
+	// RevokeGrant reports ErrNotFound unless it was the one to revoke the
+	// grant, so that only one of several concurrent refreshes succeeds.
+	RevokeGrant(ctx context.Context, id uuid.UUID) error
+}
+
+// Users checks credentials on the consent page and looks users up again when
+// a refresh token is redeemed. Unknown and disabled users, and wrong
+// passwords, are all reported as ErrNotFound.
+type Users interface {
+	Authenticate(ctx context.Context, email, password string) (User, error)
+	Get(ctx context.Context, id uuid.UUID) (User, error)
+}
+
+type Server struct {
+	Store           Store
+	Users           Users
+	Secret          string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+// codeTTL is how long an authorization code may sit between the consent
+// redirect and the token request. RFC 6749 recommends at most ten minutes.
+const codeTTL = 10 * time.Minute
+
+// parseScope splits a space separated scope parameter into known scopes,
+// sorted and without duplicates.
+func parseScope(scope string) ([]string, error) {
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		return nil, errors.New("scope is required")
+	}
+	for _, s := range scopes {
+		if !auth.ValidScope(s) {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	slices.Sort(scopes)
+	return slices.Compact(scopes), nil
+}
+
+func isSubset(scopes, of []string) bool {
+	for _, s := range scopes {
+		if !slices.Contains(of, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// validVerifier checks a PKCE code verifier against RFC 7636 section 4.1.
+func validVerifier(verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// S256Challenge derives the PKCE code challenge for verifier.
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func verifyPKCE(verifier, challenge string) bool {
+	if !validVerifier(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(S256Challenge(verifier)), []byte(challenge)) == 1
+}
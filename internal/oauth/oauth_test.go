@@ -0,0 +1,600 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/api"
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/database/memory"
+	"github.com/google/uuid"
+)
+
+const (
+	testSecret   = "test-secret"
+	testEmail    = "walt@example.com"
+	testPassword = "hunter2"
+	testRedirect = "http://127.0.0.1:8765/callback"
+	testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+type memStore struct {
+	mu      sync.Mutex
+	clients map[string]Client
+	codes   map[string]AuthorizationCode
+	grants  map[string]Grant
+
+	user         User
+	passwordHash string
+}
+
+func (m *memStore) CreateClient(ctx context.Context, client Client) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clients[client.ID] = client
+	return nil
+}
+
+func (m *memStore) GetClient(ctx context.Context, id string) (Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client, ok := m.clients[id]
+	if !ok {
+		return Client{}, ErrNotFound
+	}
+	return client, nil
+}
+
+func (m *memStore) CreateCode(ctx context.Context, code AuthorizationCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[code.CodeHash] = code
+	return nil
+}
+
+func (m *memStore) ConsumeCode(ctx context.Context, codeHash, clientID string) (AuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code, ok := m.codes[codeHash]
+	if !ok || code.ClientID != clientID {
+		return AuthorizationCode{}, ErrNotFound
+	}
+	delete(m.codes, codeHash)
+	return code, nil
+}
+
+func (m *memStore) CreateGrant(ctx context.Context, grant Grant) (Grant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	grant.ID = uuid.New()
+	m.grants[grant.TokenHash] = grant
+	return grant, nil
+}
+
+func (m *memStore) GetGrant(ctx context.Context, tokenHash string) (Grant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	grant, ok := m.grants[tokenHash]
+	if !ok {
+		return Grant{}, ErrNotFound
+	}
+	return grant, nil
+}
+
+func (m *memStore) RevokeGrant(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for hash, grant := range m.grants {
+		if grant.ID == id && !grant.Revoked {
+			grant.Revoked = true
+			m.grants[hash] = grant
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *memStore) Authenticate(ctx context.Context, email, password string) (User, error) {
+	if email != testEmail || auth.CheckHashedPassword(m.passwordHash, password) != nil {
+		return User{}, ErrNotFound
+	}
+	return m.user, nil
+}
+
+func (m *memStore) Get(ctx context.Context, id uuid.UUID) (User, error) {
+	if id != m.user.ID {
+		return User{}, ErrNotFound
+	}
+	return m.user, nil
+}
+
+type fixture struct {
+	server       *httptest.Server
+	http         *http.Client
+	user         User
+	session      string
+	clientID     string
+	clientSecret string
+}
+
+// newFixture serves the OAuth endpoints next to stand-ins for API routes
+// guarded the same way the real ones are, and registers a confidential
+// client through the API.
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	hash, err := auth.HashPassword(testPassword)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	// The API checks that the account behind a token still exists.
+	users := memory.New()
+	account, err := users.CreateUser(context.Background(), database.CreateUserParams{Email: testEmail, HashedPassword: hash})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	store := &memStore{
+		clients:      map[string]Client{},
+		codes:        map[string]AuthorizationCode{},
+		grants:       map[string]Grant{},
+		user:         User{ID: account.ID, Role: auth.RoleUser},
+		passwordHash: hash,
+	}
+	srv := &Server{
+		Store:           store,
+		Users:           store,
+		Secret:          testSecret,
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: 24 * time.Hour,
+	}
+	apiCfg := &api.ApiConfig{Secret: testSecret, Store: users}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, auth.MustPrincipal(r.Context()).UserID.String())
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /oauth/clients", apiCfg.RequireSession(http.HandlerFunc(srv.RegisterClientHandler)))
+	mux.HandleFunc("GET /oauth/authorize", srv.AuthorizeHandler)
+	mux.HandleFunc("POST /oauth/authorize", srv.ConsentHandler)
+	mux.HandleFunc("POST /oauth/token", srv.TokenHandler)
+	mux.HandleFunc("POST /oauth/revoke", srv.RevokeHandler)
+	mux.Handle("POST /api/chirps", apiCfg.RequireAuth(api.RequireScope(auth.ScopeChirpsWrite, ok)))
+	mux.Handle("PUT /api/users", apiCfg.RequireAuth(api.RequireScope(auth.ScopeProfileWrite, ok)))
+	mux.Handle("POST /api/tokens", apiCfg.RequireSession(ok))
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	f := &fixture{
+		server: server,
+		http: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+		user: store.user,
+	}
+
+	f.session, err = auth.MakeJWT(store.user.ID, store.user.Role, "session", testSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	client := f.register(t, "Chirp Scheduler")
+	f.clientID, f.clientSecret = client.ClientID, client.ClientSecret
+	return f
+}
+
+// register registers a confidential client through the API.
+func (f *fixture) register(t *testing.T, name string) clientResponse {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, f.server.URL+"/oauth/clients", strings.NewReader(
+		`{"name": "`+name+`", "redirect_uris": ["`+testRedirect+`"], "confidential": true}`))
+	req.Header.Set("Authorization", "Bearer "+f.session)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.http.Do(req)
+	if err != nil {
+		t.Fatalf("registering client: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("registering client: status %d", resp.StatusCode)
+	}
+	var client clientResponse
+	if err := json.NewDecoder(resp.Body).Decode(&client); err != nil {
+		t.Fatalf("decoding client: %v", err)
+	}
+	return client
+}
+
+func (f *fixture) authorizeParams(scope string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {f.clientID},
+		"redirect_uri":          {testRedirect},
+		"scope":                 {scope},
+		"state":                 {"xyz"},
+		"code_challenge":        {S256Challenge(testVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func (f *fixture) post(t *testing.T, path string, form url.Values, header http.Header) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, f.server.URL+path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := f.http.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s: %v", path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// approve submits the consent form and returns the redirect's query.
+func (f *fixture) approve(t *testing.T, params url.Values) url.Values {
+	t.Helper()
+	form := url.Values{"email": {testEmail}, "password": {testPassword}, "action": {"approve"}}
+	for name, values := range params {
+		form[name] = values
+	}
+	resp := f.post(t, "/oauth/authorize", form, nil)
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("consent: status %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("consent: bad Location: %v", err)
+	}
+	return location.Query()
+}
+
+func (f *fixture) token(t *testing.T, form url.Values) (int, map[string]any) {
+	t.Helper()
+	form.Set("client_id", f.clientID)
+	form.Set("client_secret", f.clientSecret)
+	resp := f.post(t, "/oauth/token", form, nil)
+	body := map[string]any{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func (f *fixture) exchange(t *testing.T, code string) (int, map[string]any) {
+	t.Helper()
+	return f.token(t, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirect},
+		"code_verifier": {testVerifier},
+	})
+}
+
+func (f *fixture) callAPI(t *testing.T, method, path, token string) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, f.server.URL+path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := f.http.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	f := newFixture(t)
+	params := f.authorizeParams(auth.ScopeChirpsWrite)
+
+	resp, err := f.http.Get(f.server.URL + "/oauth/authorize?" + params.Encode())
+	if err != nil {
+		t.Fatalf("GET /oauth/authorize: %v", err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("consent page: status %d", resp.StatusCode)
+	}
+	for _, want := range []string{"Chirp Scheduler", "Post and delete chirps as you"} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("consent page does not mention %q", want)
+		}
+	}
+	if resp.Header.Get("X-Frame-Options") != "DENY" {
+		t.Error("consent page may be framed")
+	}
+
+	wrongPassword := url.Values{"email": {testEmail}, "password": {"nope"}, "action": {"approve"}}
+	for name, values := range params {
+		wrongPassword[name] = values
+	}
+	if resp := f.post(t, "/oauth/authorize", wrongPassword, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong password: status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	query := f.approve(t, params)
+	if query.Get("state") != "xyz" {
+		t.Errorf("state = %q, want %q", query.Get("state"), "xyz")
+	}
+	code := query.Get("code")
+
+	status, tokens := f.exchange(t, code)
+	if status != http.StatusOK {
+		t.Fatalf("exchange: status %d, body %v", status, tokens)
+	}
+	if tokens["scope"] != auth.ScopeChirpsWrite || tokens["token_type"] != "Bearer" {
+		t.Errorf("unexpected token response %v", tokens)
+	}
+	accessToken := tokens["access_token"].(string)
+	refreshToken := tokens["refresh_token"].(string)
+
+	if status := f.callAPI(t, http.MethodPost, "/api/chirps", accessToken); status != http.StatusOK {
+		t.Errorf("in-scope API call: status %d, want %d", status, http.StatusOK)
+	}
+	if status := f.callAPI(t, http.MethodPut, "/api/users", accessToken); status != http.StatusForbidden {
+		t.Errorf("out-of-scope API call: status %d, want %d", status, http.StatusForbidden)
+	}
+	if status := f.callAPI(t, http.MethodPost, "/api/tokens", accessToken); status != http.StatusForbidden {
+		t.Errorf("session-only API call: status %d, want %d", status, http.StatusForbidden)
+	}
+
+	if status, body := f.exchange(t, code); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("reused code: status %d, body %v", status, body)
+	}
+
+	status, refreshed := f.token(t, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}})
+	if status != http.StatusOK {
+		t.Fatalf("refresh: status %d, body %v", status, refreshed)
+	}
+	if status, body := f.token(t, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}}); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("reused refresh token: status %d, body %v", status, body)
+	}
+
+	newRefresh := refreshed["refresh_token"].(string)
+	// Revoke the access token, authenticating with client_secret_basic.
+	basic := &http.Request{Header: http.Header{}}
+	basic.SetBasicAuth(url.QueryEscape(f.clientID), url.QueryEscape(f.clientSecret))
+	revoke := url.Values{"token": {refreshed["access_token"].(string)}}
+	if resp := f.post(t, "/oauth/revoke", revoke, basic.Header); resp.StatusCode != http.StatusOK {
+		t.Errorf("revoke: status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if status, body := f.token(t, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {newRefresh}}); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("refresh after revoke: status %d, body %v", status, body)
+	}
+}
+
+func TestCodeForAnotherClient(t *testing.T) {
+	f := newFixture(t)
+	code := f.approve(t, f.authorizeParams(auth.ScopeChirpsRead)).Get("code")
+
+	other := f.register(t, "Code Thief")
+	resp := f.post(t, "/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirect},
+		"code_verifier": {testVerifier},
+		"client_id":     {other.ClientID},
+		"client_secret": {other.ClientSecret},
+	}, nil)
+	body := map[string]any{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("another client's exchange: status %d, body %v", resp.StatusCode, body)
+	}
+
+	// The attempt must not have used up the code.
+	if status, body := f.exchange(t, code); status != http.StatusOK {
+		t.Errorf("exchange after another client's attempt: status %d, body %v", status, body)
+	}
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	f := newFixture(t)
+	code := f.approve(t, f.authorizeParams(auth.ScopeChirpsRead)).Get("code")
+	status, tokens := f.exchange(t, code)
+	if status != http.StatusOK {
+		t.Fatalf("exchange: status %d, body %v", status, tokens)
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens["refresh_token"].(string)},
+		"client_id":     {f.clientID},
+		"client_secret": {f.clientSecret},
+	}
+
+	const attempts = 10
+	statuses := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := f.http.PostForm(f.server.URL+"/oauth/token", form)
+			if err != nil {
+				statuses <- 0
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	redeemed := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusOK:
+			redeemed++
+		case http.StatusBadRequest:
+		default:
+			t.Errorf("refresh: status %d", status)
+		}
+	}
+	if redeemed != 1 {
+		t.Errorf("Refresh token redeemed %d times, want once", redeemed)
+	}
+}
+
+func TestAuthorizeRejections(t *testing.T) {
+	f := newFixture(t)
+
+	tests := []struct {
+		name      string
+		change    func(url.Values)
+		deny      bool
+		wantCode  int
+		wantError string
+	}{
+		{
+			name:     "Unknown client",
+			change:   func(v url.Values) { v.Set("client_id", "nope") },
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Unregistered redirect uri",
+			change:   func(v url.Values) { v.Set("redirect_uri", "https://evil.example/callback") },
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:      "Missing PKCE",
+			change:    func(v url.Values) { v.Del("code_challenge") },
+			wantCode:  http.StatusFound,
+			wantError: "invalid_request",
+		},
+		{
+			name:      "Plain PKCE",
+			change:    func(v url.Values) { v.Set("code_challenge_method", "plain") },
+			wantCode:  http.StatusFound,
+			wantError: "invalid_request",
+		},
+		{
+			name:      "Unknown scope",
+			change:    func(v url.Values) { v.Set("scope", "admin") },
+			wantCode:  http.StatusFound,
+			wantError: "invalid_scope",
+		},
+		{
+			name:      "Implicit flow",
+			change:    func(v url.Values) { v.Set("response_type", "token") },
+			wantCode:  http.StatusFound,
+			wantError: "unsupported_response_type",
+		},
+		{
+			name:      "User denies",
+			change:    func(url.Values) {},
+			deny:      true,
+			wantCode:  http.StatusFound,
+			wantError: "access_denied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := f.authorizeParams(auth.ScopeChirpsRead)
+			tt.change(params)
+
+			var resp *http.Response
+			if tt.deny {
+				params.Set("action", "deny")
+				resp = f.post(t, "/oauth/authorize", params, nil)
+			} else {
+				var err error
+				resp, err = f.http.Get(f.server.URL + "/oauth/authorize?" + params.Encode())
+				if err != nil {
+					t.Fatalf("GET /oauth/authorize: %v", err)
+				}
+				resp.Body.Close()
+			}
+
+			if resp.StatusCode != tt.wantCode {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+			if tt.wantError == "" {
+				return
+			}
+			location, _ := url.Parse(resp.Header.Get("Location"))
+			if !strings.HasPrefix(location.String(), testRedirect) {
+				t.Errorf("redirected to %q, want %q", location, testRedirect)
+			}
+			if got := location.Query().Get("error"); got != tt.wantError {
+				t.Errorf("error = %q, want %q", got, tt.wantError)
+			}
+			if got := location.Query().Get("state"); got != "xyz" {
+				t.Errorf("state = %q, want %q", got, "xyz")
+			}
+		})
+	}
+}
+
+func TestTokenRejections(t *testing.T) {
+	f := newFixture(t)
+
+	tests := []struct {
+		name       string
+		change     func(url.Values)
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name:       "Wrong code verifier",
+			change:     func(v url.Values) { v.Set("code_verifier", strings.Repeat("x", 43)) },
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+		},
+		{
+			name:       "Different redirect uri",
+			change:     func(v url.Values) { v.Set("redirect_uri", "http://127.0.0.1:9999/callback") },
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+		},
+		{
+			name:       "Wrong client secret",
+			change:     func(v url.Values) { v.Set("client_secret", "guess") },
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "invalid_client",
+		},
+		{
+			name:       "Unsupported grant type",
+			change:     func(v url.Values) { v.Set("grant_type", "password") },
+			wantStatus: http.StatusBadRequest,
+			wantError:  "unsupported_grant_type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := f.approve(t, f.authorizeParams(auth.ScopeChirpsRead)).Get("code")
+			form := url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {code},
+				"redirect_uri":  {testRedirect},
+				"code_verifier": {testVerifier},
+				"client_id":     {f.clientID},
+				"client_secret": {f.clientSecret},
+			}
+			tt.change(form)
+
+			resp := f.post(t, "/oauth/token", form, nil)
+			body := map[string]any{}
+			json.NewDecoder(resp.Body).Decode(&body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if body["error"] != tt.wantError {
+				t.Errorf("error = %v, want %q", body["error"], tt.wantError)
+			}
+		})
+	}
+}
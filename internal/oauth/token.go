@@ -0,0 +1,291 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/logging"
+	"github.com/google/uuid"
+)
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// tokenError is an error response from the token or revocation endpoint,
+// as described in RFC 6749 section 5.2.
+type tokenError struct {
+	status      int
+	code        string
+	description string
+	err         error
+	// basic asks the client to retry with HTTP Basic authentication.
+	basic bool
+}
+
+func invalidGrant(description string) *tokenError {
+	return &tokenError{status: http.StatusBadRequest, code: "invalid_grant", description: description}
+}
+
+func serverError(err error) *tokenError {
+	return &tokenError{status: http.StatusInternalServerError, code: "server_error", err: err}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func respondWithTokenError(w http.ResponseWriter, r *http.Request, e *tokenError) {
+	logger := logging.FromContext(r.Context())
+	if e.status > 499 {
+		logger.Error("Responding with 5XX error", "status", e.status, "error", e.err)
+	} else {
+		logger.Info("Token request rejected", "status", e.status, "oauth_error", e.code, "msg", e.description)
+	}
+	if e.basic {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	writeJSON(w, e.status, struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description,omitempty"`
+	}{e.code, e.description})
+}
+
+// authenticateClient identifies the client with HTTP Basic credentials or
+// client_id and client_secret form fields (RFC 6749 section 2.3.1). Public
+// clients only send their client_id.
+func (s *Server) authenticateClient(ctx context.Context, r *http.Request) (Client, *tokenError) {
+	id, secret, basic := r.BasicAuth()
+	if basic {
+		// Basic credentials are form-encoded before being base64 encoded.
+		var err1, err2 error
+		id, err1 = url.QueryUnescape(id)
+		secret, err2 = url.QueryUnescape(secret)
+		if err1 != nil || err2 != nil {
+			return Client{}, &tokenError{status: http.StatusUnauthorized, code: "invalid_client", description: "Malformed client credentials", basic: true}
+		}
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	invalid := &tokenError{status: http.StatusUnauthorized, code: "invalid_client", description: "Client authentication failed", basic: basic}
+
+	client, err := s.Store.GetClient(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return Client{}, invalid
+	}
+	if err != nil {
+		return Client{}, serverError(err)
+	}
+
+	if client.Confidential() && subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return Client{}, invalid
+	}
+	return client, nil
+}
+
+// issue starts a new grant for user and returns its tokens.
+func (s *Server) issue(ctx context.Context, client Client, user User, scopes []string) (tokenResponse, *tokenError) {
+	refreshToken := auth.MakeRefreshToken()
+	grant, err := s.Store.CreateGrant(ctx, Grant{
+		ClientID:  client.ID,
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(refreshToken),
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(s.RefreshTokenTTL),
+	})
+	if err != nil {
+		return tokenResponse{}, serverError(err)
+	}
+
+	accessToken, err := auth.MakeScopedJWT(user.ID, user.Role, grant.ID.String(), client.ID, scopes, s.Secret, s.AccessTokenTTL)
+	if err != nil {
+		return tokenResponse{}, serverError(err)
+	}
+
+	return tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	}, nil
+}
+
+func (s *Server) exchangeCode(ctx context.Context, client Client, form url.Values) (tokenResponse, *tokenError) {
+	code, err := s.Store.ConsumeCode(ctx, auth.HashToken(form.Get("code")), client.ID)
+	if errors.Is(err, ErrNotFound) {
+		return tokenResponse{}, invalidGrant("Unknown or already used authorization code")
+	}
+	if err != nil {
+		return tokenResponse{}, serverError(err)
+	}
+
+	switch {
+	case time.Now().After(code.ExpiresAt):
+		return tokenResponse{}, invalidGrant("Authorization code has expired")
+	case form.Get("redirect_uri") != code.RedirectURI:
+		return tokenResponse{}, invalidGrant("Redirect uri does not match the authorization request")
+	case !verifyPKCE(form.Get("code_verifier"), code.CodeChallenge):
+		return tokenResponse{}, invalidGrant("Code verifier does not match the code challenge")
+	}
+
+	user, err := s.Users.Get(ctx, code.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return tokenResponse{}, invalidGrant("User is no longer active")
+	}
+	if err != nil {
+		return tokenResponse{}, serverError(err)
+	}
+
+	return s.issue(ctx, client, user, code.Scopes)
+}
+
+// refresh redeems a refresh token. Refresh tokens are single use: each
+// redemption revokes the old grant and starts a new one.
+func (s *Server) refresh(ctx context.Context, client Client, form url.Values) (tokenResponse, *tokenError) {
+	grant, err := s.Store.GetGrant(ctx, auth.HashToken(form.Get("refresh_token")))
+	if errors.Is(err, ErrNotFound) {
+		return tokenResponse{}, invalidGrant("Unknown refresh token")
+	}
+	if err != nil {
+		return tokenResponse{}, serverError(err)
+	}
+
+	switch {
+	case grant.ClientID != client.ID:
+		return tokenResponse{}, invalidGrant("Refresh token was issued to another client")
+	case grant.Revoked:
+		return tokenResponse{}, invalidGrant("Refresh token has been revoked")
+	case time.Now().After(grant.ExpiresAt):
+		return tokenResponse{}, invalidGrant("Refresh token has expired")
+	}
+
+	scopes := grant.Scopes
+	if form.Get("scope") != "" {
+		scopes, err = parseScope(form.Get("scope"))
+		if err != nil || !isSubset(scopes, grant.Scopes) {
+			return tokenResponse{}, &tokenError{status: http.StatusBadRequest, code: "invalid_scope", description: "Scope exceeds the original grant"}
+		}
+	}
+
+	user, err := s.Users.Get(ctx, grant.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return tokenResponse{}, invalidGrant("User is no longer active")
+	}
+	if err != nil {
+		return tokenResponse{}, serverError(err)
+	}
+
+	// A concurrent request may have redeemed the token since GetGrant.
+	err = s.Store.RevokeGrant(ctx, grant.ID)
+	if errors.Is(err, ErrNotFound) {
+		return tokenResponse{}, invalidGrant("Refresh token has been revoked")
+	}
+	if err != nil {
+		return tokenResponse{}, serverError(err)
+	}
+	return s.issue(ctx, client, user, scopes)
+}
+
+// TokenHandler is the token endpoint (RFC 6749 section 3.2).
+func (s *Server) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithTokenError(w, r, &tokenError{status: http.StatusBadRequest, code: "invalid_request", description: "Could not read form", err: err})
+		return
+	}
+
+	client, tokenErr := s.authenticateClient(r.Context(), r)
+	if tokenErr != nil {
+		respondWithTokenError(w, r, tokenErr)
+		return
+	}
+
+	var response tokenResponse
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		response, tokenErr = s.exchangeCode(r.Context(), client, r.PostForm)
+	case "refresh_token":
+		response, tokenErr = s.refresh(r.Context(), client, r.PostForm)
+	default:
+		tokenErr = &tokenError{status: http.StatusBadRequest, code: "unsupported_grant_type", description: "Only authorization_code and refresh_token are supported"}
+	}
+	if tokenErr != nil {
+		respondWithTokenError(w, r, tokenErr)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// RevokeHandler is the revocation endpoint (RFC 7009). Revoking either token
+// ends the whole grant, so the refresh token stops working at once. Access
+// tokens are stateless and stay valid until they expire, which is why they
+// are short lived.
+func (s *Server) RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithTokenError(w, r, &tokenError{status: http.StatusBadRequest, code: "invalid_request", description: "Could not read form", err: err})
+		return
+	}
+
+	client, tokenErr := s.authenticateClient(r.Context(), r)
+	if tokenErr != nil {
+		respondWithTokenError(w, r, tokenErr)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondWithTokenError(w, r, &tokenError{status: http.StatusBadRequest, code: "invalid_request", description: "token is required"})
+		return
+	}
+
+	grantID, ok, err := s.grantFor(r.Context(), client, token)
+	if err != nil {
+		respondWithTokenError(w, r, serverError(err))
+		return
+	}
+	if ok {
+		if err := s.Store.RevokeGrant(r.Context(), grantID); err != nil && !errors.Is(err, ErrNotFound) {
+			respondWithTokenError(w, r, serverError(err))
+			return
+		}
+	}
+
+	// Unknown tokens get the same response, so the endpoint cannot be used
+	// to probe for valid tokens.
+	w.WriteHeader(http.StatusOK)
+}
+
+// grantFor finds the grant behind a refresh or access token issued to
+// client.
+func (s *Server) grantFor(ctx context.Context, client Client, token string) (uuid.UUID, bool, error) {
+	grant, err := s.Store.GetGrant(ctx, auth.HashToken(token))
+	if err == nil {
+		return grant.ID, grant.ClientID == client.ID, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return uuid.Nil, false, err
+	}
+
+	claims, err := auth.ParseJWT(token, s.Secret)
+	if err != nil || claims.ClientID != client.ID {
+		return uuid.Nil, false, nil
+	}
+	grantID, err := uuid.Parse(claims.SessionID)
+	return grantID, err == nil, nil
+}
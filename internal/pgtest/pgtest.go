@@ -0,0 +1,214 @@
+// Package pgtest runs tests against a throwaway Postgres cluster. The cluster
+// is created with the local initdb and pg_ctl binaries on first use, listens
+// only on a Unix socket in a temporary directory and is removed when the test
+// binary exits. Each test gets its own schema with every migration applied.
+//
+// Packages using it hand their TestMain to Main:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(pgtest.Main(m))
+//	}
+//
+// Tests calling DB are skipped when the binaries cannot be found, when
+// running as root, which Postgres refuses, and under -short. Set PG_BIN to
+// the directory holding initdb and pg_ctl if they are not on PATH. Set
+// CHIRPY_REQUIRE_POSTGRES=1, as CI should, to fail those tests instead of
+// skipping them.
+package pgtest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/migrate"
+)
+
+// errUnavailable marks a cluster that cannot be started in this environment,
+// as opposed to one that failed to start.
+var errUnavailable = errors.New("postgres unavailable")
+
+var (
+	startOnce sync.Once
+	shared    *cluster
+	startErr  error
+	schemas   atomic.Int64
+	skipped   atomic.Int64
+)
+
+// required reports whether Postgres tests must run rather than be skipped.
+func required() bool {
+	return os.Getenv("CHIRPY_REQUIRE_POSTGRES") == "1"
+}
+
+type cluster struct {
+	dir   string
+	pgCtl string
+	dsn   string
+	admin *sql.DB
+}
+
+// Main runs m and stops the cluster afterwards if any test started one. It
+// also reports how many tests were skipped for want of Postgres.
+func Main(m *testing.M) int {
+	code := m.Run()
+	if n := skipped.Load(); n > 0 {
+		fmt.Fprintf(os.Stderr, "pgtest: skipped %d postgres tests: %v\n", n, startErr)
+	}
+	if shared != nil {
+		if err := shared.stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "pgtest: stopping postgres: %v\n", err)
+		}
+	}
+	return code
+}
+
+// DB returns a handle whose search_path is a fresh schema holding the
+// migrated tables. The schema is dropped when t finishes.
+func DB(t testing.TB) *sql.DB {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("pgtest: skipping postgres tests in short mode")
+	}
+	startOnce.Do(func() {
+		shared, startErr = start()
+	})
+	if errors.Is(startErr, errUnavailable) {
+		if required() {
+			t.Fatalf("pgtest: CHIRPY_REQUIRE_POSTGRES is set: %v", startErr)
+		}
+		skipped.Add(1)
+		t.Log("pgtest: set CHIRPY_REQUIRE_POSTGRES=1 to fail instead of skipping")
+		t.Skip(startErr)
+	}
+	if startErr != nil {
+		t.Fatalf("pgtest: starting postgres: %v", startErr)
+	}
+
+	ctx := context.Background()
+	schema := fmt.Sprintf("test_%d", schemas.Add(1))
+	if _, err := shared.admin.ExecContext(ctx, "create schema "+schema); err != nil {
+		t.Fatalf("pgtest: creating schema: %v", err)
+	}
+
+	db, err := sql.Open("postgres", shared.dsn+"&search_path="+schema)
+	if err != nil {
+		t.Fatalf("pgtest: opening database: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if _, err := shared.admin.ExecContext(ctx, "drop schema "+schema+" cascade"); err != nil {
+			t.Errorf("pgtest: dropping schema: %v", err)
+		}
+	})
+
+	migrations, err := migrate.NewProvider(db, database.BackendPostgres)
+	if err != nil {
+		t.Fatalf("pgtest: loading migrations: %v", err)
+	}
+	if _, err := migrations.Up(ctx); err != nil {
+		t.Fatalf("pgtest: applying migrations: %v", err)
+	}
+	return db
+}
+
+// binaries finds initdb and pg_ctl in PG_BIN, on PATH or where Debian and
+// Ubuntu packages install them.
+func binaries() (initdb, pgCtl string, err error) {
+	var dirs []string
+	if dir := os.Getenv("PG_BIN"); dir != "" {
+		dirs = append(dirs, dir)
+	} else {
+		if path, err := exec.LookPath("initdb"); err == nil {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+		versions, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+		// Prefer the newest version. Lexical order is right from 10 up.
+		for i := len(versions) - 1; i >= 0; i-- {
+			dirs = append(dirs, versions[i])
+		}
+	}
+
+	for _, dir := range dirs {
+		initdb, pgCtl = filepath.Join(dir, "initdb"), filepath.Join(dir, "pg_ctl")
+		if isExecutable(initdb) && isExecutable(pgCtl) {
+			return initdb, pgCtl, nil
+		}
+	}
+	return "", "", fmt.Errorf("%w: initdb and pg_ctl not found; set PG_BIN", errUnavailable)
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0o111 != 0
+}
+
+func start() (*cluster, error) {
+	initdb, pgCtl, err := binaries()
+	if err != nil {
+		return nil, err
+	}
+	if os.Geteuid() == 0 {
+		return nil, fmt.Errorf("%w: postgres cannot run as root", errUnavailable)
+	}
+
+	// The socket lives in dir, so keep the path well under the 107 byte
+	// limit on Unix socket names.
+	dir, err := os.MkdirTemp("", "chirpy-pg-")
+	if err != nil {
+		return nil, err
+	}
+	c := &cluster{dir: dir, pgCtl: pgCtl}
+	data := filepath.Join(dir, "data")
+
+	if err := run(initdb, "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync"); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	// No TCP listener, no fsync: the cluster is private and disposable.
+	options := fmt.Sprintf("-F -k %s -c listen_addresses=''", dir)
+	if err := run(pgCtl, "-D", data, "-l", filepath.Join(dir, "postgres.log"), "-o", options, "-w", "start"); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	c.dsn = "postgres://postgres@/postgres?sslmode=disable&host=" + url.QueryEscape(dir)
+	c.admin, err = sql.Open("postgres", c.dsn)
+	if err == nil {
+		err = c.admin.Ping()
+	}
+	if err != nil {
+		c.stop()
+		return nil, fmt.Errorf("connecting to postgres: %w", err)
+	}
+	return c, nil
+}
+
+func (c *cluster) stop() error {
+	if c.admin != nil {
+		c.admin.Close()
+	}
+	err := run(c.pgCtl, "-D", filepath.Join(c.dir, "data"), "-m", "immediate", "-w", "stop")
+	if rmErr := os.RemoveAll(c.dir); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w\n%s", filepath.Base(name), strings.Join(args, " "), err, out)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps buckets in process memory. Each replica counts on its
+// own, so use PostgresStore when running more than one.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryStore) Take(ctx context.Context, key string, p Policy) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(p.Limit)}
+		m.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.updated).Seconds()
+		b.tokens = min(float64(p.Limit), b.tokens+elapsed*p.refillRate())
+	}
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return newResult(p, b.tokens, allowed), nil
+}
+
+func (m *MemoryStore) Sweep(ctx context.Context, idle time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var swept int64
+	cutoff := m.now().Add(-idle)
+	for key, b := range m.buckets {
+		if b.updated.Before(cutoff) {
+			delete(m.buckets, key)
+			swept++
+		}
+	}
+	return swept, nil
+}
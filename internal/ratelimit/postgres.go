@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+)
+
+// PostgresStore shares buckets between replicas through the
+// rate_limit_buckets table. Each take is a single upsert, so concurrent
+// requests for the same key serialize on the row lock. The table is unlogged:
+// losing buckets in a crash only resets some limits early.
+type PostgresStore struct {
+	q *database.Queries
+}
+
+func NewPostgresStore(q *database.Queries) *PostgresStore {
+	return &PostgresStore{q: q}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, p Policy) (Result, error) {
+	row, err := s.q.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:        key,
+		Capacity:   float64(p.Limit),
+		RefillRate: p.refillRate(),
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(p, row.Tokens, row.Allowed), nil
+}
+
+func (s *PostgresStore) Sweep(ctx context.Context, idle time.Duration) (int64, error) {
+	return s.q.DeleteIdleRateLimitBuckets(ctx, idle.Seconds())
+}
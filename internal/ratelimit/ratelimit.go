@@ -0,0 +1,206 @@
+// Package ratelimit throttles requests with token buckets. Buckets live in
+// process memory for single instances or in Postgres when several replicas
+// must share them.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/common"
+	"github.com/cloudsmyth/chirpy/internal/logging"
+	"github.com/cloudsmyth/chirpy/internal/metrics"
+)
+
+// Policy allows bursts of up to Limit requests, refilling at Limit requests
+// per Period.
+type Policy struct {
+	// Name identifies the policy in bucket keys, metrics and logs.
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+func (p Policy) refillRate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed. It is
+	// zero when the request was allowed.
+	RetryAfter time.Duration
+}
+
+// newResult describes a bucket left holding tokens after a take.
+func newResult(p Policy, tokens float64, allowed bool) Result {
+	rate := p.refillRate()
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(p.Limit) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return result
+}
+
+type Store interface {
+	// Take refills the bucket for key for the time since it was last used
+	// and then tries to remove one token from it.
+	Take(ctx context.Context, key string, p Policy) (Result, error)
+	// Sweep forgets buckets that have not been used for idle. A bucket idle
+	// for a whole policy period is full, so forgetting it changes nothing.
+	Sweep(ctx context.Context, idle time.Duration) (int64, error)
+}
+
+// Limiter applies policies to routes. Authenticated requests are limited per
+// user and anonymous ones per client address.
+type Limiter struct {
+	Store Store
+	// TrustedProxies are the networks allowed to report the client address
+	// in X-Forwarded-For.
+	TrustedProxies []netip.Prefix
+	Metrics        *metrics.Metrics
+
+	mu        sync.Mutex
+	maxPeriod time.Duration
+}
+
+// Limit wraps next with policy. Place it behind the auth middleware so that
+// authenticated callers get their own bucket. A Limiter without a Store lets
+// everything through.
+func (l *Limiter) Limit(policy Policy, next http.Handler) http.Handler {
+	if l.Store == nil {
+		return next
+	}
+
+	l.mu.Lock()
+	l.maxPeriod = max(l.maxPeriod, policy.Period)
+	l.mu.Unlock()
+
+	limit := strconv.Itoa(policy.Limit)
+	policyHeader := fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Period.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := "ip:" + ClientIP(r, l.TrustedProxies)
+		if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+			key = "user:" + principal.UserID.String()
+		}
+
+		result, err := l.Store.Take(r.Context(), policy.Name+"|"+key, policy)
+		if err != nil {
+			// Failing open keeps the API up when the store is unreachable;
+			// the store being down is reported by its own health checks.
+			logging.FromContext(r.Context()).Warn("Rate limiter unavailable", "policy", policy.Name, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Policy", policyHeader)
+		w.Header().Set("RateLimit-Limit", limit)
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			if l.Metrics != nil {
+				l.Metrics.RateLimited.WithLabelValues(policy.Name).Inc()
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			common.RespondWithProblem(w, r, common.CodeRateLimited, "Rate limit exceeded, retry later", fmt.Errorf("policy %s exceeded by %s", policy.Name, key))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Run sweeps idle buckets every interval until ctx is cancelled.
+func (l *Limiter) Run(ctx context.Context, interval time.Duration) {
+	if l.Store == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			idle := l.maxPeriod
+			l.mu.Unlock()
+
+			swept, err := l.Store.Sweep(ctx, idle)
+			if err != nil {
+				slog.Error("Rate limit bucket sweep failed", "error", err)
+				continue
+			}
+			slog.Debug("Swept idle rate limit buckets", "count", swept)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ClientIP returns the address of the client that made r. X-Forwarded-For is
+// only consulted when the connection comes from a trusted proxy, and is read
+// from the right so that a client cannot spoof its address by sending the
+// header itself: the first untrusted hop is the client.
+func ClientIP(r *http.Request, trusted []netip.Prefix) string {
+	remote, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	addr := remote.Addr().Unmap()
+	if !isTrusted(addr, trusted) {
+		return addr.String()
+	}
+
+	var hops []netip.Addr
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, field := range strings.Split(header, ",") {
+			hop, err := netip.ParseAddr(strings.TrimSpace(field))
+			if err != nil {
+				// An unparsable hop means the chain cannot be trusted past
+				// this point; fall back to the last address we could verify.
+				hops = nil
+				continue
+			}
+			hops = append(hops, hop.Unmap())
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr = hops[i]
+		if !isTrusted(addr, trusted) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/auth"
+	"github.com/cloudsmyth/chirpy/internal/metrics"
+	"github.com/google/uuid"
+)
+
+func TestMemoryStoreRefill(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	policy := Policy{Name: "test", Limit: 3, Period: 3 * time.Second}
+	ctx := context.Background()
+
+	for i := range 3 {
+		result, _ := store.Take(ctx, "key", policy)
+		if !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("take %d: got %+v, want allowed with %d remaining", i, result, 2-i)
+		}
+	}
+
+	result, _ := store.Take(ctx, "key", policy)
+	if result.Allowed {
+		t.Fatal("Expected the fourth take in a burst to be denied")
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("RetryAfter = %s, want 1s", result.RetryAfter)
+	}
+	if result.Reset != 3*time.Second {
+		t.Errorf("Reset = %s, want 3s", result.Reset)
+	}
+
+	if other, _ := store.Take(ctx, "other", policy); !other.Allowed {
+		t.Error("Expected buckets to be independent per key")
+	}
+
+	now = now.Add(time.Second)
+	if result, _ := store.Take(ctx, "key", policy); !result.Allowed {
+		t.Error("Expected a token to be refilled after one second")
+	}
+
+	now = now.Add(time.Hour)
+	if result, _ := store.Take(ctx, "key", policy); result.Remaining != 2 {
+		t.Errorf("Expected the bucket to refill to its limit, got %d remaining", result.Remaining)
+	}
+
+	now = now.Add(time.Minute)
+	swept, _ := store.Sweep(ctx, time.Minute/2)
+	if swept != 2 || len(store.buckets) != 0 {
+		t.Errorf("Sweep removed %d buckets, %d left", swept, len(store.buckets))
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("::1/128"),
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{
+			name:       "Direct connection",
+			remoteAddr: "203.0.113.7:5123",
+			want:       "203.0.113.7",
+		},
+		{
+			name:         "Untrusted peer cannot spoof",
+			remoteAddr:   "203.0.113.7:5123",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "Trusted proxy",
+			remoteAddr:   "10.0.0.2:443",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "Client prepends a fake hop",
+			remoteAddr:   "10.0.0.2:443",
+			forwardedFor: []string{"1.2.3.4, 198.51.100.1"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "Chain of trusted proxies",
+			remoteAddr:   "[::1]:443",
+			forwardedFor: []string{"198.51.100.1, 10.0.0.9", "10.0.0.3"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "Garbage hop",
+			remoteAddr:   "10.0.0.2:443",
+			forwardedFor: []string{"198.51.100.1, nonsense, 10.0.0.5"},
+			want:         "10.0.0.5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := ClientIP(r, trusted); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Policy) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func (failingStore) Sweep(context.Context, time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func TestLimit(t *testing.T) {
+	policy := Policy{Name: "create_chirp", Limit: 2, Period: time.Minute}
+	m := metrics.New(nil)
+	limiter := &Limiter{Store: NewMemoryStore(), Metrics: m}
+	handler := limiter.Limit(policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	do := func(remoteAddr string, principal *auth.Principal) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+		r.RemoteAddr = remoteAddr
+		if principal != nil {
+			r = r.WithContext(auth.NewContext(r.Context(), principal))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	user := &auth.Principal{UserID: uuid.New()}
+	for i := range 2 {
+		// The same user from different addresses shares one bucket.
+		rec := do(fmt.Sprintf("203.0.113.%d:1000", i+1), user)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("request %d: status %d", i, rec.Code)
+		}
+	}
+
+	rec := do("203.0.113.9:1000", user)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	wantHeaders := map[string]string{
+		"RateLimit-Policy":    "2;w=60",
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+		"Retry-After":         "30",
+	}
+	for name, want := range wantHeaders {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if got := m.Value("chirpy_rate_limited_requests_total", "policy", "create_chirp"); got != 1 {
+		t.Errorf("rate limited counter = %v, want 1", got)
+	}
+
+	if rec := do("203.0.113.9:1000", nil); rec.Code != http.StatusCreated {
+		t.Errorf("anonymous caller shares the user's bucket: status %d", rec.Code)
+	}
+
+	failOpen := (&Limiter{Store: failingStore{}}).Limit(policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	rec = httptest.NewRecorder()
+	failOpen.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/chirps", nil))
+	if rec.Code != http.StatusCreated {
+		t.Errorf("store failure: status %d, want the request to be let through", rec.Code)
+	}
+}
@@ -0,0 +1,100 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/lib/pq"
+)
+
+// pingInterval is how often an idle Listener checks its connection, so that
+// a dead one is noticed and replaced without waiting for a notification.
+const pingInterval = 90 * time.Second
+
+// PostgresPublisher sends events through Postgres NOTIFY. Events travel as
+// JSON; a chirp is at most 140 characters, well within the 8000 byte limit
+// on a notification.
+type PostgresPublisher struct {
+	q *database.Queries
+}
+
+var _ Publisher = (*PostgresPublisher)(nil)
+
+func NewPostgresPublisher(q *database.Queries) *PostgresPublisher {
+	return &PostgresPublisher{q: q}
+}
+
+func (p *PostgresPublisher) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return p.q.NotifyChirpEvent(ctx, string(payload))
+}
+
+// Listener feeds a Hub with the events sent by every PostgresPublisher on
+// the same database, this instance's included.
+type Listener struct {
+	hub      *Hub
+	listener *pq.Listener
+}
+
+// NewListener listens on dbURL over a connection of its own, outside the
+// pool, and reconnects whenever it is lost.
+func NewListener(dbURL string, hub *Hub) *Listener {
+	l := &Listener{hub: hub}
+	l.listener = pq.NewListener(dbURL, time.Second, time.Minute, l.report)
+	return l
+}
+
+// Run publishes notifications to the hub until ctx is cancelled. Events
+// sent while the connection was down are lost, so the hub is reset after
+// each reconnect.
+func (l *Listener) Run(ctx context.Context) {
+	defer l.listener.Close()
+
+	if err := l.listener.Listen("chirp_events"); err != nil {
+		slog.Error("Could not listen for chirp events", "error", err)
+		return
+	}
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-l.listener.Notify:
+			// A nil notification follows a reconnect.
+			if n == nil {
+				l.hub.Reset()
+				continue
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+				slog.Warn("Ignoring malformed chirp event", "error", err)
+				continue
+			}
+			l.hub.Publish(ctx, event)
+		case <-ticker.C:
+			go l.listener.Ping()
+		}
+	}
+}
+
+func (l *Listener) report(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventConnected:
+		slog.Info("Listening for chirp events")
+	case pq.ListenerEventDisconnected:
+		slog.Warn("Lost the chirp event connection", "error", err)
+	case pq.ListenerEventReconnected:
+		slog.Info("Reconnected to chirp events; streams will start afresh")
+	case pq.ListenerEventConnectionAttemptFailed:
+		slog.Warn("Could not connect for chirp events", "error", err)
+	}
+}
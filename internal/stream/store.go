@@ -0,0 +1,40 @@
+package stream
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Store publishes an event for every chirp created or deleted through it,
+// once the write has committed. Writes made by other processes, such as the
+// admin commands, publish nothing.
+type Store struct {
+	*database.HookStore
+	publisher Publisher
+}
+
+var _ database.TxStore = (*Store)(nil)
+
+func NewStore(store database.TxStore, p Publisher) *Store {
+	s := &Store{publisher: p}
+	s.HookStore = database.NewHookStore(store, s.publish)
+	return s
+}
+
+// publish sends the events of committed writes. The writes have happened
+// by now, so a failure only costs the streams an event and is not returned.
+func (s *Store) publish(ctx context.Context, writes []database.ChirpWrite) {
+	ctx = context.WithoutCancel(ctx)
+	for _, w := range writes {
+		event := Event{ID: uuid.NewString(), Type: ChirpCreated, Chirp: w.Chirp}
+		if w.Deleted {
+			event.Type = ChirpDeleted
+		}
+		if err := s.publisher.Publish(ctx, event); err != nil {
+			slog.Warn("Could not publish chirp event", "type", event.Type, "chirp", event.Chirp.ID, "error", err)
+		}
+	}
+}
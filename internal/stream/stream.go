@@ -0,0 +1,166 @@
+// Package stream delivers chirp events to Server-Sent Events clients. Store
+// publishes an event for every chirp created or deleted through it, and a
+// Hub hands each event to its subscribers and keeps the most recent ones
+// for clients resuming with Last-Event-ID.
+//
+// A single instance publishes straight to its Hub. Several instances publish
+// through Postgres NOTIFY instead, and each feeds its own Hub from a
+// Listener. Postgres delivers notifications to every listener in the same
+// order, so a client may resume on any instance.
+package stream
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+)
+
+// Event types.
+const (
+	ChirpCreated = "chirp.created"
+	ChirpDeleted = "chirp.deleted"
+)
+
+// Event is a change to a chirp. A deleted chirp may only carry its ID and
+// author.
+type Event struct {
+	ID    string         `json:"id"`
+	Type  string         `json:"type"`
+	Chirp database.Chirp `json:"chirp"`
+}
+
+// Publisher sends events to the hub of every instance.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// ErrTooManySubscribers is returned by Subscribe when the hub already has
+// as many subscribers as it allows.
+var ErrTooManySubscribers = errors.New("stream: too many subscribers")
+
+// subscriberBuffer is how far a subscriber may fall behind before it is
+// dropped. Its client reconnects and catches up from the replay buffer.
+const subscriberBuffer = 64
+
+// Hub fans events out to subscribers and keeps the last size of them for
+// replay. It is the Publisher of a single instance.
+type Hub struct {
+	size           int
+	maxSubscribers int
+
+	mu          sync.Mutex
+	events      []Event
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+var _ Publisher = (*Hub)(nil)
+
+// NewHub returns a hub replaying up to size events to at most
+// maxSubscribers subscribers. Both must be positive.
+func NewHub(size, maxSubscribers int) *Hub {
+	return &Hub{size: size, maxSubscribers: maxSubscribers, subscribers: map[*Subscription]struct{}{}}
+}
+
+// Publish hands event to every subscriber and keeps it for replay. It never
+// blocks: a subscriber too far behind to take the event is dropped.
+func (h *Hub) Publish(_ context.Context, event Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+
+	if len(h.events) == h.size {
+		h.events = slices.Delete(h.events, 0, 1)
+	}
+	h.events = append(h.events, event)
+
+	for sub := range h.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			h.drop(sub)
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a subscription to the events published from now on.
+// When lastEventID is not empty it also returns the buffered events that
+// followed it. ok is false if that event is no longer buffered, in which
+// case the subscriber may have missed events.
+func (h *Hub) Subscribe(lastEventID string) (sub *Subscription, missed []Event, ok bool, err error) {
+	sub = &Subscription{hub: h, events: make(chan Event, subscriberBuffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(sub.events)
+		return sub, nil, true, nil
+	}
+	if len(h.subscribers) >= h.maxSubscribers {
+		return nil, nil, false, ErrTooManySubscribers
+	}
+	h.subscribers[sub] = struct{}{}
+
+	if lastEventID == "" {
+		return sub, nil, true, nil
+	}
+	i := slices.IndexFunc(h.events, func(e Event) bool { return e.ID == lastEventID })
+	if i < 0 {
+		return sub, nil, false, nil
+	}
+	return sub, slices.Clone(h.events[i+1:]), true, nil
+}
+
+// Reset forgets the buffered events and drops every subscriber. It is for
+// when events may have been lost on the way to the hub: the clients
+// reconnect, find their last event gone and start afresh.
+func (h *Hub) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = nil
+	for sub := range h.subscribers {
+		h.drop(sub)
+	}
+}
+
+// Close drops every subscriber and ends any later subscription at once, so
+// that open streams do not hold up a server shutdown.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subscribers {
+		h.drop(sub)
+	}
+}
+
+func (h *Hub) drop(sub *Subscription) {
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Subscription receives the events published to a Hub.
+type Subscription struct {
+	hub    *Hub
+	events chan Event
+}
+
+// Events delivers the events in order. It is closed when the subscription
+// is closed or dropped by the hub.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.drop(s)
+}
@@ -0,0 +1,175 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"github.com/cloudsmyth/chirpy/internal/database/memory"
+)
+
+func publishN(h *Hub, n int) {
+	for i := range n {
+		h.Publish(context.Background(), Event{ID: strconv.Itoa(i + 1), Type: ChirpCreated})
+	}
+}
+
+func ids(events []Event) []string {
+	var got []string
+	for _, event := range events {
+		got = append(got, event.ID)
+	}
+	return got
+}
+
+func TestHubReplay(t *testing.T) {
+	h := NewHub(3, 10)
+	publishN(h, 5)
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		want        []string
+		wantOK      bool
+	}{
+		{name: "New stream", wantOK: true},
+		{name: "Resume", lastEventID: "3", want: []string{"4", "5"}, wantOK: true},
+		{name: "Up to date", lastEventID: "5", wantOK: true},
+		{name: "No longer buffered", lastEventID: "2"},
+		{name: "Unknown", lastEventID: "nope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, missed, ok, err := h.Subscribe(tt.lastEventID)
+			if err != nil {
+				t.Fatalf("Subscribe(%q): %v", tt.lastEventID, err)
+			}
+			defer sub.Close()
+			if got := ids(missed); ok != tt.wantOK || len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+				t.Errorf("Subscribe(%q) = %v, %v, want %v, %v", tt.lastEventID, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestHubDelivery(t *testing.T) {
+	h := NewHub(10, 10)
+	sub, _, _, _ := h.Subscribe("")
+	slow, _, _, _ := h.Subscribe("")
+	closed, _, _, _ := h.Subscribe("")
+	closed.Close()
+
+	publishN(h, 1)
+	if event := <-sub.Events(); event.ID != "1" {
+		t.Errorf("Received %q, want 1", event.ID)
+	}
+	if _, ok := <-closed.Events(); ok {
+		t.Error("Expected a closed subscription to receive nothing")
+	}
+
+	// sub keeps up; slow never reads and falls too far behind.
+	for i := range subscriberBuffer {
+		h.Publish(context.Background(), Event{ID: strconv.Itoa(i + 2)})
+		<-sub.Events()
+	}
+	for range slow.Events() {
+	}
+	if len(h.subscribers) != 1 {
+		t.Errorf("Expected the slow subscriber to be dropped, have %d subscribers", len(h.subscribers))
+	}
+
+	h.Reset()
+	if _, ok := <-sub.Events(); ok {
+		t.Error("Expected Reset to drop every subscriber")
+	}
+	if _, _, ok, _ := h.Subscribe("2"); ok {
+		t.Error("Expected Reset to forget the buffered events")
+	}
+
+	h.Close()
+	late, _, _, _ := h.Subscribe("")
+	if _, ok := <-late.Events(); ok {
+		t.Error("Expected a subscription to a closed hub to end at once")
+	}
+}
+
+func TestHubMaxSubscribers(t *testing.T) {
+	h := NewHub(10, 2)
+	first, _, _, _ := h.Subscribe("")
+	second, _, _, _ := h.Subscribe("")
+	defer second.Close()
+
+	if _, _, _, err := h.Subscribe(""); !errors.Is(err, ErrTooManySubscribers) {
+		t.Fatalf("Subscribe past the cap: err = %v, want ErrTooManySubscribers", err)
+	}
+	first.Close()
+	sub, _, _, err := h.Subscribe("")
+	if err != nil {
+		t.Fatalf("Subscribe after a close: %v", err)
+	}
+	sub.Close()
+}
+
+func TestStorePublishes(t *testing.T) {
+	ctx := context.Background()
+	h := NewHub(10, 10)
+	s := NewStore(memory.New(), h)
+	sub, _, _, _ := h.Subscribe("")
+	defer sub.Close()
+
+	user, err := s.CreateUser(ctx, database.CreateUserParams{Email: "alice@example.com", HashedPassword: "x"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	create := func() database.Chirp {
+		t.Helper()
+		chirp, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", UserID: user.ID})
+		if err != nil {
+			t.Fatalf("CreateChirp: %v", err)
+		}
+		return chirp
+	}
+
+	first, second, third := create(), create(), create()
+	if err := s.DeleteChirpById(ctx, database.DeleteChirpByIdParams{ID: first.ID, UserID: user.ID}); err != nil {
+		t.Fatalf("DeleteChirpById: %v", err)
+	}
+	if _, err := s.DeleteChirp(ctx, second.ID); err != nil {
+		t.Fatalf("DeleteChirp: %v", err)
+	}
+	s.InTx(ctx, func(tx database.Store) error {
+		tx.DeleteChirp(ctx, third.ID)
+		return context.Canceled
+	})
+	if err := s.InTx(ctx, func(tx database.Store) error {
+		_, err := tx.DeleteChirp(ctx, third.ID)
+		return err
+	}); err != nil {
+		t.Fatalf("InTx: %v", err)
+	}
+
+	want := []struct {
+		eventType string
+		chirp     database.Chirp
+	}{
+		{ChirpCreated, first},
+		{ChirpCreated, second},
+		{ChirpCreated, third},
+		{ChirpDeleted, first},
+		{ChirpDeleted, second},
+		{ChirpDeleted, third},
+	}
+	for i, w := range want {
+		event := <-sub.Events()
+		if event.ID == "" || event.Type != w.eventType || event.Chirp.ID != w.chirp.ID || event.Chirp.UserID != user.ID {
+			t.Errorf("Event %d = %+v, want %s of %s", i+1, event, w.eventType, w.chirp.ID)
+		}
+	}
+	select {
+	case event := <-sub.Events():
+		t.Errorf("Unexpected event %+v from a rolled back transaction", event)
+	default:
+	}
+}
@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedDB wraps a database.DBTX so every sqlc query runs inside a client
+// span named after the query.
+type tracedDB struct {
+	db     database.DBTX
+	tracer trace.Tracer
+	system attribute.KeyValue
+}
+
+// WrapDB instruments db, opened for backend by database.Open, for use with
+// database.New.
+func WrapDB(tp trace.TracerProvider, backend string, db database.DBTX) database.DBTX {
+	return &tracedDB{db: db, tracer: tp.Tracer(instrumentationName), system: dbSystem(backend)}
+}
+
+// dbSystem names backend as the db.system attribute does.
+func dbSystem(backend string) attribute.KeyValue {
+	switch backend {
+	case database.BackendPostgres:
+		return semconv.DBSystemPostgreSQL
+	case database.BackendSQLite:
+		return semconv.DBSystemSqlite
+	}
+	return semconv.DBSystemKey.String(backend)
+}
+
+func (t *tracedDB) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, queryName(query),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			t.system,
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+func end(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t *tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	result, err := t.db.ExecContext(ctx, query, args...)
+	if err == nil {
+		if rows, rowsErr := result.RowsAffected(); rowsErr == nil {
+			span.SetAttributes(attribute.Int64("db.rows_affected", rows))
+		}
+	}
+	end(span, err)
+	return result, err
+}
+
+func (t *tracedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := t.start(ctx, query)
+	stmt, err := t.db.PrepareContext(ctx, query)
+	end(span, err)
+	return stmt, err
+}
+
+// QueryContext's span ends when the rows are closed if the database was
+// opened through WrapConnector, and as soon as the query returns otherwise.
+func (t *tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	open := &openRows{span: span}
+	rows, err := t.db.QueryContext(context.WithValue(ctx, openRowsKey{}, open), query, args...)
+	if err != nil || !open.taken {
+		end(span, err)
+	}
+	return rows, err
+}
+
+func (t *tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	row := t.db.QueryRowContext(ctx, query, args...)
+	end(span, row.Err())
+	return row
+}
+
+// queryName pulls the sqlc query name out of the "-- name: GetChirps :many"
+// header sqlc puts at the top of every generated statement.
+func queryName(query string) string {
+	header, _, _ := strings.Cut(query, "\n")
+	if name, ok := strings.CutPrefix(header, "-- name: "); ok {
+		if fields := strings.Fields(name); len(fields) > 0 {
+			return fields[0]
+		}
+	}
+	return "db.query"
+}
@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const instrumentationName = "github.com/cloudsmyth/chirpy"
+
+// NewExporter builds the span exporter named by kind. "otlp" sends spans over
+// OTLP/HTTP and is configured through the standard OTEL_EXPORTER_OTLP_*
+// environment variables; "stdout" pretty-prints spans for local debugging.
+func NewExporter(ctx context.Context, kind string) (sdktrace.SpanExporter, error) {
+	switch kind {
+	case "otlp":
+		return otlptracehttp.New(ctx)
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", kind)
+	}
+}
+
+// NewTracerProvider batches spans to exporter under the chirpy service name.
+func NewTracerProvider(exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName("chirpy"),
+		)),
+	)
+}
+
+// Setup installs the global tracer provider and W3C trace context
+// propagation. With kind "none" a no-op provider is installed so
+// instrumentation stays in place at negligible cost. The returned function
+// flushes buffered spans and must be called on shutdown.
+func Setup(ctx context.Context, kind string) (trace.TracerProvider, func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if kind == "none" {
+		tp := noop.NewTracerProvider()
+		otel.SetTracerProvider(tp)
+		return tp, func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := NewExporter(ctx, kind)
+	if err != nil {
+		return nil, nil, err
+	}
+	tp := NewTracerProvider(exporter)
+	otel.SetTracerProvider(tp)
+	return tp, tp.Shutdown, nil
+}
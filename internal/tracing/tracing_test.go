@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cloudsmyth/chirpy/internal/database"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type fakeResult struct{}
+
+func (fakeResult) LastInsertId() (int64, error) { return 0, nil }
+func (fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+type fakeDB struct{}
+
+func (fakeDB) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return fakeResult{}, nil
+}
+func (fakeDB) PrepareContext(context.Context, string) (*sql.Stmt, error) { return nil, nil }
+func (fakeDB) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, nil
+}
+func (fakeDB) QueryRowContext(context.Context, string, ...interface{}) *sql.Row { return nil }
+
+func TestHandlerAndDB(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	db := WrapDB(tp, database.BackendSQLite, fakeDB{})
+
+	const pattern = "DELETE /api/chirps/{chirpId}"
+	mux := http.NewServeMux()
+	mux.Handle(pattern, Handler(tp, pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		db.ExecContext(r.Context(), "-- name: DeleteChirpById :exec\ndelete from chirps where id = $1")
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodDelete, "/api/chirps/abc", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	dbSpan, serverSpan := spans[0], spans[1]
+
+	if serverSpan.Name != pattern {
+		t.Errorf("Expected server span named %q, got %q", pattern, serverSpan.Name)
+	}
+	if serverSpan.SpanKind != trace.SpanKindServer {
+		t.Errorf("Expected server span kind, got %v", serverSpan.SpanKind)
+	}
+	if serverSpan.SpanContext.TraceID().String() != traceID {
+		t.Errorf("Expected trace %s to be continued, got %s", traceID, serverSpan.SpanContext.TraceID())
+	}
+
+	if dbSpan.Name != "DeleteChirpById" {
+		t.Errorf("Expected db span named after the query, got %q", dbSpan.Name)
+	}
+	if dbSpan.Parent.SpanID() != serverSpan.SpanContext.SpanID() {
+		t.Error("Expected db span to be a child of the server span")
+	}
+	if !slices.Contains(dbSpan.Attributes, semconv.DBSystemSqlite) {
+		t.Errorf("Expected db span to name the sqlite backend, got %v", dbSpan.Attributes)
+	}
+}
+
+func TestQuerySpanEndsOnClose(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	sqlDB, backend, err := database.Open("sqlite:"+filepath.Join(t.TempDir(), "trace.db"), WrapConnector)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer sqlDB.Close()
+	db := WrapDB(tp, backend, sqlDB)
+
+	rows, err := db.QueryContext(context.Background(), "-- name: Count :many\nselect 1 union all select 2")
+	if err != nil {
+		t.Fatalf("QueryContext: %v", err)
+	}
+	if !rows.Next() {
+		t.Fatalf("Expected a row: %v", rows.Err())
+	}
+	if len(exporter.GetSpans()) != 0 {
+		t.Error("Expected the query span to stay open until the rows are closed")
+	}
+	rows.Close()
+	if spans := exporter.GetSpans(); len(spans) != 1 || spans[0].Name != "Count" {
+		t.Errorf("Expected the Count span to end with its rows, got %v", spans)
+	}
+}
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "-- name: GetChirps :many\nselect * from chirps", want: "GetChirps"},
+		{query: "select 1", want: "db.query"},
+	}
+
+	for _, tt := range tests {
+		if got := queryName(tt.query); got != tt.want {
+			t.Errorf("queryName(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
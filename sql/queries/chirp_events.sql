@@ -0,0 +1,3 @@
+-- name: NotifyChirpEvent :exec
+-- Sends a chirp event to every instance listening on chirp_events.
+select pg_notify('chirp_events', sqlc.arg(payload)::text);
@@ -21,3 +21,6 @@ where id = $1 and user_id = $2;
 
 -- name: GetChirpsByAuthor :many 
 select * from chirps where user_id = $1 order by created_at;
+
+-- name: DeleteChirp :execrows
+delete from chirps where id = $1;
@@ -0,0 +1,13 @@
+-- name: FollowUser :exec
+insert into follows (follower_id, followee_id, created_at)
+values ($1, $2, NOW())
+on conflict do nothing;
+
+-- name: UnfollowUser :execrows
+delete from follows
+where follower_id = $1 and followee_id = $2;
+
+-- name: GetFollowedUserIds :many
+select followee_id from follows
+where follower_id = $1
+order by created_at;
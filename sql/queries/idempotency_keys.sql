@@ -0,0 +1,32 @@
+-- name: ClaimIdempotencyKey :one
+-- Records a new request under the key, taking over a record that has
+-- outlived the retention window, or a pending one that has outlived its
+-- lease. Returns no row while a live record holds the key.
+insert into idempotency_keys as k (scope, key, fingerprint, created_at)
+values (sqlc.arg(scope), sqlc.arg(key), sqlc.arg(fingerprint), NOW())
+on conflict (scope, key) do update set
+	fingerprint = excluded.fingerprint,
+	response_status = 0,
+	response_header = '{}',
+	response_body = '',
+	created_at = excluded.created_at
+where k.created_at < NOW() - make_interval(secs => sqlc.arg(retention_seconds)::float8)
+	or (k.response_status = 0 and k.created_at < NOW() - make_interval(secs => sqlc.arg(lease_seconds)::float8))
+returning *;
+
+-- name: GetIdempotencyKey :one
+select * from idempotency_keys
+where scope = $1 and key = $2;
+
+-- name: CompleteIdempotencyKey :exec
+update idempotency_keys
+set (response_status, response_header, response_body) = ($3, $4, $5)
+where scope = $1 and key = $2;
+
+-- name: DeleteIdempotencyKey :exec
+delete from idempotency_keys
+where scope = $1 and key = $2;
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+delete from idempotency_keys
+where created_at < NOW() - make_interval(secs => sqlc.arg(retention_seconds)::float8);
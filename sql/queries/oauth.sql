@@ -0,0 +1,55 @@
+-- name: CreateOauthClient :one
+insert into oauth_clients (id, created_at, updated_at, owner_id, name, secret_hash, redirect_uris)
+values (
+	$1,
+	NOW(),
+	NOW(),
+	$2,
+	$3,
+	$4,
+	$5
+)
+returning *;
+
+-- name: GetOauthClient :one
+select * from oauth_clients where id = $1;
+
+-- name: CreateOauthAuthorizationCode :exec
+insert into oauth_authorization_codes (code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+values (
+	$1,
+	NOW(),
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7
+);
+
+-- name: ConsumeOauthAuthorizationCode :one
+delete from oauth_authorization_codes
+where code_hash = $1 and client_id = $2
+returning *;
+
+-- name: CreateOauthGrant :one
+insert into oauth_grants (id, created_at, updated_at, client_id, user_id, token_hash, scopes, expires_at)
+values (
+	gen_random_uuid(),
+	NOW(),
+	NOW(),
+	$1,
+	$2,
+	$3,
+	$4,
+	$5
+)
+returning *;
+
+-- name: GetOauthGrantByTokenHash :one
+select * from oauth_grants where token_hash = $1;
+
+-- name: RevokeOauthGrant :execrows
+update oauth_grants
+set (revoked_at, updated_at) = (NOW(), NOW())
+where id = $1 and revoked_at is null;
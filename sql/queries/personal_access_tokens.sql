@@ -0,0 +1,35 @@
+-- name: CreatePersonalAccessToken :one
+insert into personal_access_tokens (id, created_at, updated_at, user_id, name, token_hash, scopes, expires_at)
+values (
+	gen_random_uuid(),
+	NOW(),
+	NOW(),
+	$1,
+	$2,
+	$3,
+	$4,
+	$5
+)
+returning *;
+
+-- name: GetPersonalAccessTokenByHash :one
+select personal_access_tokens.*, users.role, users.disabled_at as user_disabled_at
+from personal_access_tokens
+join users on users.id = personal_access_tokens.user_id
+where token_hash = $1;
+
+-- name: ListPersonalAccessTokensByUser :many
+select * from personal_access_tokens
+where user_id = $1 and revoked_at is null
+order by created_at;
+
+-- name: RevokePersonalAccessToken :execrows
+update personal_access_tokens
+set (revoked_at, updated_at) = (NOW(), NOW())
+where id = $1 and user_id = $2 and revoked_at is null;
+
+-- name: TouchPersonalAccessToken :exec
+update personal_access_tokens
+set last_used_at = NOW()
+where id = $1
+and (last_used_at is null or last_used_at < NOW() - interval '1 minute');
@@ -0,0 +1,18 @@
+-- name: TakeRateLimitToken :one
+-- Refills the bucket for the time since it was last used and takes a token
+-- if one is available, all under the row lock taken by the upsert.
+insert into rate_limit_buckets as b (key, tokens, allowed, updated_at)
+values (sqlc.arg(key), sqlc.arg(capacity)::float8 - 1, true, NOW())
+on conflict (key) do update set
+	tokens = case
+		when least(sqlc.arg(capacity)::float8, b.tokens + extract(epoch from NOW() - b.updated_at)::float8 * sqlc.arg(refill_rate)::float8) >= 1
+		then least(sqlc.arg(capacity)::float8, b.tokens + extract(epoch from NOW() - b.updated_at)::float8 * sqlc.arg(refill_rate)::float8) - 1
+		else least(sqlc.arg(capacity)::float8, b.tokens + extract(epoch from NOW() - b.updated_at)::float8 * sqlc.arg(refill_rate)::float8)
+	end,
+	allowed = least(sqlc.arg(capacity)::float8, b.tokens + extract(epoch from NOW() - b.updated_at)::float8 * sqlc.arg(refill_rate)::float8) >= 1,
+	updated_at = NOW()
+returning tokens, allowed;
+
+-- name: DeleteIdleRateLimitBuckets :execrows
+delete from rate_limit_buckets
+where updated_at < NOW() - make_interval(secs => sqlc.arg(idle_seconds)::float8);
@@ -17,3 +17,17 @@ update refresh_tokens
 set (revoked_at, updated_at) = (now(), now())
 where token = $1
 returning *;
+
+-- name: DeleteStaleRefreshTokens :execrows
+delete from refresh_tokens
+where token in (
+	select token from refresh_tokens
+	where expires_at < now()
+	or revoked_at < sqlc.arg(revoked_before)::timestamp
+	limit sqlc.arg(batch_size)
+);
+
+-- name: RevokeRefreshTokensByUser :execrows
+update refresh_tokens
+set (revoked_at, updated_at) = (now(), now())
+where user_id = $1 and revoked_at is null;
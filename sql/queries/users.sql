@@ -26,3 +26,18 @@ update users
 set (is_chirpy_red, updated_at) = ($1, NOW())
 where id = $2
 returning *;
+
+-- name: ListUsers :many
+select * from users order by created_at;
+
+-- name: DisableUserById :one
+update users
+set (disabled_at, updated_at) = (NOW(), NOW())
+where id = $1
+returning *;
+
+-- name: SetUserRole :one
+update users
+set (role, updated_at) = ($1, NOW())
+where id = $2
+returning *;
@@ -0,0 +1,8 @@
+-- +goose Up
+alter table users
+add column role text not null default 'user'
+check (role in ('user', 'moderator', 'admin'));
+
+-- +goose Down
+alter table users
+drop column role;
@@ -0,0 +1,13 @@
+-- +goose Up
+create table oauth_clients (
+	id text primary key,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	owner_id uuid not null references users(id) on delete cascade,
+	name text not null,
+	secret_hash text,
+	redirect_uris text[] not null
+);
+
+-- +goose Down
+drop table oauth_clients;
@@ -0,0 +1,10 @@
+-- +goose Up
+create unlogged table rate_limit_buckets (
+	key text primary key,
+	tokens double precision not null,
+	allowed boolean not null,
+	updated_at timestamp not null
+);
+
+-- +goose Down
+drop table rate_limit_buckets;
@@ -0,0 +1,16 @@
+-- +goose Up
+create table idempotency_keys (
+	scope text not null,
+	key text not null,
+	fingerprint text not null,
+	response_status integer not null default 0,
+	response_header jsonb not null default '{}',
+	response_body bytea not null default '',
+	created_at timestamp not null,
+	primary key (scope, key)
+);
+
+create index idempotency_keys_created_at_idx on idempotency_keys (created_at);
+
+-- +goose Down
+drop table idempotency_keys;
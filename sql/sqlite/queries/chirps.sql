@@ -0,0 +1,26 @@
+-- name: CreateChirp :one
+insert into chirps (id, body, created_at, updated_at, user_id)
+values (
+	sqlc.arg(id),
+	sqlc.arg(body),
+	sqlc.arg(now),
+	sqlc.arg(now),
+	sqlc.arg(user_id)
+)
+returning *;
+
+-- name: GetChirps :many
+select * from chirps order by created_at;
+
+-- name: GetChirpById :one
+select * from chirps where id = ?;
+
+-- name: DeleteChirpById :exec
+delete from chirps
+where id = ? and user_id = ?;
+
+-- name: GetChirpsByAuthor :many
+select * from chirps where user_id = ? order by created_at;
+
+-- name: DeleteChirp :execrows
+delete from chirps where id = ?;
@@ -0,0 +1,13 @@
+-- name: FollowUser :exec
+insert into follows (follower_id, followee_id, created_at)
+values (sqlc.arg(follower_id), sqlc.arg(followee_id), sqlc.arg(now))
+on conflict do nothing;
+
+-- name: UnfollowUser :execrows
+delete from follows
+where follower_id = ? and followee_id = ?;
+
+-- name: GetFollowedUserIds :many
+select followee_id from follows
+where follower_id = ?
+order by created_at;
@@ -0,0 +1,55 @@
+-- name: CreateOauthClient :one
+insert into oauth_clients (id, created_at, updated_at, owner_id, name, secret_hash, redirect_uris)
+values (
+	sqlc.arg(id),
+	sqlc.arg(now),
+	sqlc.arg(now),
+	sqlc.arg(owner_id),
+	sqlc.arg(name),
+	sqlc.arg(secret_hash),
+	sqlc.arg(redirect_uris)
+)
+returning *;
+
+-- name: GetOauthClient :one
+select * from oauth_clients where id = ?;
+
+-- name: CreateOauthAuthorizationCode :exec
+insert into oauth_authorization_codes (code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+values (
+	sqlc.arg(code_hash),
+	sqlc.arg(now),
+	sqlc.arg(client_id),
+	sqlc.arg(user_id),
+	sqlc.arg(redirect_uri),
+	sqlc.arg(scopes),
+	sqlc.arg(code_challenge),
+	sqlc.arg(expires_at)
+);
+
+-- name: ConsumeOauthAuthorizationCode :one
+delete from oauth_authorization_codes
+where code_hash = ? and client_id = ?
+returning *;
+
+-- name: CreateOauthGrant :one
+insert into oauth_grants (id, created_at, updated_at, client_id, user_id, token_hash, scopes, expires_at)
+values (
+	sqlc.arg(id),
+	sqlc.arg(now),
+	sqlc.arg(now),
+	sqlc.arg(client_id),
+	sqlc.arg(user_id),
+	sqlc.arg(token_hash),
+	sqlc.arg(scopes),
+	sqlc.arg(expires_at)
+)
+returning *;
+
+-- name: GetOauthGrantByTokenHash :one
+select * from oauth_grants where token_hash = ?;
+
+-- name: RevokeOauthGrant :execrows
+update oauth_grants
+set revoked_at = sqlc.arg(now), updated_at = sqlc.arg(now)
+where id = sqlc.arg(id) and revoked_at is null;
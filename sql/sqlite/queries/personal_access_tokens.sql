@@ -0,0 +1,35 @@
+-- name: CreatePersonalAccessToken :one
+insert into personal_access_tokens (id, created_at, updated_at, user_id, name, token_hash, scopes, expires_at)
+values (
+	sqlc.arg(id),
+	sqlc.arg(now),
+	sqlc.arg(now),
+	sqlc.arg(user_id),
+	sqlc.arg(name),
+	sqlc.arg(token_hash),
+	sqlc.arg(scopes),
+	sqlc.arg(expires_at)
+)
+returning *;
+
+-- name: GetPersonalAccessTokenByHash :one
+select personal_access_tokens.*, users.role, users.disabled_at as user_disabled_at
+from personal_access_tokens
+join users on users.id = personal_access_tokens.user_id
+where token_hash = ?;
+
+-- name: ListPersonalAccessTokensByUser :many
+select * from personal_access_tokens
+where user_id = ? and revoked_at is null
+order by created_at;
+
+-- name: RevokePersonalAccessToken :execrows
+update personal_access_tokens
+set revoked_at = sqlc.arg(now), updated_at = sqlc.arg(now)
+where id = sqlc.arg(id) and user_id = sqlc.arg(user_id) and revoked_at is null;
+
+-- name: TouchPersonalAccessToken :exec
+update personal_access_tokens
+set last_used_at = sqlc.arg(now)
+where id = sqlc.arg(id)
+and (last_used_at is null or last_used_at < sqlc.arg(stale_before));
@@ -0,0 +1,33 @@
+-- name: CreateRefreshToken :one
+insert into refresh_tokens (token, created_at, updated_at, user_id, expires_at)
+values (
+	sqlc.arg(token),
+	sqlc.arg(now),
+	sqlc.arg(now),
+	sqlc.arg(user_id),
+	sqlc.arg(expires_at)
+)
+returning *;
+
+-- name: GetRefreshByToken :one
+select * from refresh_tokens where token = ?;
+
+-- name: RevokeRefreshByToken :one
+update refresh_tokens
+set revoked_at = sqlc.arg(now), updated_at = sqlc.arg(now)
+where token = sqlc.arg(token)
+returning *;
+
+-- name: DeleteStaleRefreshTokens :execrows
+delete from refresh_tokens
+where token in (
+	select token from refresh_tokens
+	where expires_at < sqlc.arg(now)
+	or revoked_at < sqlc.arg(revoked_before)
+	limit sqlc.arg(batch_size)
+);
+
+-- name: RevokeRefreshTokensByUser :execrows
+update refresh_tokens
+set revoked_at = sqlc.arg(now), updated_at = sqlc.arg(now)
+where user_id = sqlc.arg(user_id) and revoked_at is null;
@@ -0,0 +1,43 @@
+-- name: CreateUser :one
+insert into users (id, created_at, updated_at, email, hashed_password)
+values (
+	sqlc.arg(id),
+	sqlc.arg(now),
+	sqlc.arg(now),
+	sqlc.arg(email),
+	sqlc.arg(hashed_password)
+)
+returning *;
+
+-- name: GetUserByEmail :one
+select * from users where email = ?;
+
+-- name: GetUserById :one
+select * from users where id = ?;
+
+-- name: UpdateUserById :one
+update users
+set email = sqlc.arg(email), hashed_password = sqlc.arg(hashed_password), updated_at = sqlc.arg(now)
+where id = sqlc.arg(id)
+returning *;
+
+-- name: UpgradeUserById :one
+update users
+set is_chirpy_red = sqlc.arg(is_chirpy_red), updated_at = sqlc.arg(now)
+where id = sqlc.arg(id)
+returning *;
+
+-- name: ListUsers :many
+select * from users order by created_at;
+
+-- name: DisableUserById :one
+update users
+set disabled_at = sqlc.arg(now), updated_at = sqlc.arg(now)
+where id = sqlc.arg(id)
+returning *;
+
+-- name: SetUserRole :one
+update users
+set role = sqlc.arg(role), updated_at = sqlc.arg(now)
+where id = sqlc.arg(id)
+returning *;
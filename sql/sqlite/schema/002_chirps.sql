@@ -0,0 +1,11 @@
+-- +goose Up
+create table chirps (
+	id text primary key,
+	body text not null,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	user_id text not null references users(id) on delete cascade
+);
+
+-- +goose Down
+drop table chirps;
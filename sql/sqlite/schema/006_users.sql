@@ -0,0 +1,7 @@
+-- +goose Up
+alter table users
+add column disabled_at timestamp;
+
+-- +goose Down
+alter table users
+drop column disabled_at;
@@ -0,0 +1,18 @@
+-- +goose Up
+create table personal_access_tokens (
+	id text primary key,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	user_id text not null references users(id) on delete cascade,
+	name text not null,
+	token_hash text unique not null,
+	scopes text not null,
+	expires_at timestamp,
+	last_used_at timestamp,
+	revoked_at timestamp
+);
+
+create index personal_access_tokens_user_id_idx on personal_access_tokens (user_id);
+
+-- +goose Down
+drop table personal_access_tokens;
@@ -0,0 +1,14 @@
+-- +goose Up
+create table oauth_authorization_codes (
+	code_hash text primary key,
+	created_at timestamp not null,
+	client_id text not null references oauth_clients(id) on delete cascade,
+	user_id text not null references users(id) on delete cascade,
+	redirect_uri text not null,
+	scopes text not null,
+	code_challenge text not null,
+	expires_at timestamp not null
+);
+
+-- +goose Down
+drop table oauth_authorization_codes;
@@ -0,0 +1,15 @@
+-- +goose Up
+create table oauth_grants (
+	id text primary key,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	client_id text not null references oauth_clients(id) on delete cascade,
+	user_id text not null references users(id) on delete cascade,
+	token_hash text unique not null,
+	scopes text not null,
+	expires_at timestamp not null,
+	revoked_at timestamp
+);
+
+-- +goose Down
+drop table oauth_grants;
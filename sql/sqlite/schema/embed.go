@@ -0,0 +1,12 @@
+// Package schema embeds the SQLite migrations. They mirror sql/schema
+// version for version, with SQLite types: uuids are text generated by the
+// application, timestamps are text written by the driver and arrays are
+// JSON text. 012_rate_limit_buckets and 013_idempotency_keys have no
+// counterpart, as only the memory rate limit and idempotency stores work
+// on SQLite.
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS